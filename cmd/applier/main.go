@@ -4,6 +4,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -136,11 +137,11 @@ func apply(o Option) (err error) {
 
 	templateReader := templateprocessor.NewYamlFileReader(o.directory)
 	if o.outFile != "" {
-		templateProcessor, err := templateprocessor.NewTemplateProcessor(templateReader, &templateprocessor.Options{})
+		templateProcessor, err := templateprocessor.NewTemplateProcessor(templateReader)
 		if err != nil {
 			return err
 		}
-		outV, err := templateProcessor.TemplateResourcesInPathYaml("", []string{}, true, values)
+		outV, err := templateProcessor.TemplateResourcesInPathYaml(context.TODO(), "", []string{}, true, values)
 		if err != nil {
 			return err
 		}
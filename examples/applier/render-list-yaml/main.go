@@ -5,6 +5,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
 
@@ -53,7 +54,7 @@ func renderYamlFile() error {
 
 	//Create a templateProcessor with that reader
 	klog.Infof("Creating TemplateProcessor...")
-	tp, err := templateprocessor.NewTemplateProcessor(yamlReader, &templateprocessor.Options{})
+	tp, err := templateprocessor.NewTemplateProcessor(yamlReader)
 	if err != nil {
 		return err
 	}
@@ -75,6 +76,7 @@ func renderYamlFile() error {
 	//The output is NOT sorted, the order is defined by the templateNames parameter
 	klog.Info("Render resources\n")
 	out, err := tp.TemplateResources(
+		context.TODO(),
 		[]string{"yamlfilereader/serviceaccount.yaml",
 			"yamlfilereader/namespace.yaml"},
 		values)
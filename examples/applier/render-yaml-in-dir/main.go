@@ -5,6 +5,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
 
@@ -53,7 +54,7 @@ func renderYamlFile() error {
 
 	//Create a templateProcessor with that reader
 	klog.Infof("Creating TemplateProcessor...")
-	tp, err := templateprocessor.NewTemplateProcessor(yamlReader, &templateprocessor.Options{})
+	tp, err := templateprocessor.NewTemplateProcessor(yamlReader)
 	if err != nil {
 		return err
 	}
@@ -85,6 +86,7 @@ func renderYamlFile() error {
 	//The output is sorted
 	klog.Info("Render resources\n")
 	out, err := tp.TemplateResourcesInPathYaml(
+		context.TODO(),
 		"yamlfilereader",
 		[]string{"yamlfilereader/clusterrolebinding.yaml"},
 		false,
@@ -1,17 +1,31 @@
 module github.com/open-cluster-management/library-go
 
-go 1.15
+go 1.16
 
 require (
 	github.com/Masterminds/sprig/v3 v3.2.0
+	github.com/docker/distribution v2.7.1+incompatible
+	github.com/evanphx/json-patch v4.5.0+incompatible
 	github.com/ghodss/yaml v1.0.0
 	github.com/go-logr/logr v0.1.0
+	github.com/google/cel-go v0.6.0
+	github.com/google/uuid v1.1.1
+	github.com/googleapis/gnostic v0.4.0
 	github.com/huandu/xstrings v1.3.2 // indirect
+	github.com/jmespath/go-jmespath v0.3.0
 	github.com/onsi/ginkgo v1.12.1
 	github.com/onsi/gomega v1.10.1
-	github.com/pkg/errors v0.8.1
+	github.com/opencontainers/go-digest v1.0.0 // indirect
+	github.com/pkg/errors v0.9.1
+	github.com/pmezard/go-difflib v1.0.0
+	github.com/prometheus/prometheus v0.0.0-20200609090129-a6600f564e3c
+	github.com/robfig/cron/v3 v3.0.1
+	github.com/spdx/tools-golang v0.1.0
 	github.com/stretchr/testify v1.5.1
+	go.mozilla.org/sops/v3 v3.6.1
 	golang.org/x/net v0.0.0-20200625001655-4c5254603344 // indirect
+	golang.org/x/sys v0.0.0-20200420163511-1957bb5e6d1f
+	golang.org/x/time v0.0.0-20200416051211-89c76fbcd5d1
 	google.golang.org/protobuf v1.25.0 // indirect
 	gopkg.in/yaml.v1 v1.0.0-20140924161607-9f9df34309c0
 	k8s.io/api v0.18.6
@@ -75,7 +75,7 @@ func NewApplier(
 	merger Merger,
 	applierOptions *Options,
 ) (*Applier, error) {
-	templateProcessor, err := templateprocessor.NewTemplateProcessor(templateReader, templateProcessorOptions)
+	templateProcessor, err := templateprocessor.NewTemplateProcessor(templateReader, templateprocessor.WithOptions(templateProcessorOptions))
 	if err != nil {
 		return nil, err
 	}
@@ -157,6 +157,7 @@ func (a *Applier) CreateOrUpdateInPath(
 ) error {
 	a.templateProcessor.SetCreateUpdateOrder()
 	us, err := a.templateProcessor.TemplateResourcesInPathUnstructured(
+		context.TODO(),
 		path,
 		excluded,
 		recursive,
@@ -184,6 +185,7 @@ func (a *Applier) CreateInPath(
 ) error {
 	a.templateProcessor.SetCreateUpdateOrder()
 	us, err := a.templateProcessor.TemplateResourcesInPathUnstructured(
+		context.TODO(),
 		path,
 		excluded,
 		recursive,
@@ -211,6 +213,7 @@ func (a *Applier) UpdateInPath(
 ) error {
 	a.templateProcessor.SetCreateUpdateOrder()
 	us, err := a.templateProcessor.TemplateResourcesInPathUnstructured(
+		context.TODO(),
 		path,
 		excluded,
 		recursive,
@@ -238,6 +241,7 @@ func (a *Applier) DeleteInPath(
 ) error {
 	a.templateProcessor.SetDeleteOrder()
 	us, err := a.templateProcessor.TemplateResourcesInPathUnstructured(
+		context.TODO(),
 		path,
 		excluded,
 		recursive,
@@ -304,7 +308,7 @@ func (a *Applier) DeleteResources(
 func (a *Applier) toUnstructureds(assetNames []string,
 	values interface{},
 ) (us []*unstructured.Unstructured, err error) {
-	b, err := a.templateProcessor.TemplateResources(assetNames, values)
+	b, err := a.templateProcessor.TemplateResources(context.TODO(), assetNames, values)
 	if err != nil {
 		return nil, err
 	}
@@ -366,7 +370,7 @@ func (a *Applier) DeleteResource(
 func (a *Applier) toUnstructured(assetName string,
 	values interface{},
 ) (u *unstructured.Unstructured, err error) {
-	b, err := a.templateProcessor.TemplateResource(assetName, values)
+	b, err := a.templateProcessor.TemplateResource(context.TODO(), assetName, values)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,112 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+//AuditRecord is the JSON record written in the Options.AuditLog for each rendered resource
+type AuditRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	//TemplateName the template which rendered the resource, empty if the resource was generated
+	TemplateName      string `json:"templateName"`
+	ResourceGVK       string `json:"resourceGVK"`
+	ResourceNamespace string `json:"resourceNamespace,omitempty"`
+	ResourceName      string `json:"resourceName"`
+	//RenderDurationMs the rendering duration of the template in milliseconds
+	RenderDurationMs int64 `json:"renderDurationMs"`
+	//ValuesHash the sha256 of the JSON encoded values
+	ValuesHash string `json:"valuesHash"`
+}
+
+//TemplateAuditEvent is the JSON event written by TemplateResourcesInPathWithAuditWriter for each rendered template
+type TemplateAuditEvent struct {
+	Timestamp    time.Time `json:"timestamp"`
+	TemplatePath string    `json:"templatePath"`
+	//RenderDurationMs the rendering duration of the template in milliseconds
+	RenderDurationMs int64 `json:"renderDurationMs"`
+	//ResourceCount the number of resources rendered by the template
+	ResourceCount int `json:"resourceCount"`
+	//SHA256 the sha256 of the rendered yaml
+	SHA256 string `json:"sha256"`
+}
+
+//writeTemplateAuditEvents writes a JSON TemplateAuditEvent in w for each rendered template
+func writeTemplateAuditEvents(w io.Writer, renderedTemplates []renderedTemplate) error {
+	encoder := json.NewEncoder(w)
+	for _, r := range renderedTemplates {
+		sum := sha256.Sum256(r.rendered)
+		event := TemplateAuditEvent{
+			Timestamp:        time.Now().UTC(),
+			TemplatePath:     r.templateName,
+			RenderDurationMs: r.duration.Milliseconds(),
+			ResourceCount:    len(r.us),
+			SHA256:           hex.EncodeToString(sum[:]),
+		}
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//writeAuditLog writes an AuditRecord in the Options.AuditLog for each resource
+func (tp *TemplateProcessor) writeAuditLog(
+	renderedTemplates []renderedTemplate,
+	us []*unstructured.Unstructured,
+	values interface{}) error {
+	if tp.options.AuditLog == nil {
+		return nil
+	}
+	valuesHash, err := hashValues(values)
+	if err != nil {
+		return err
+	}
+	origins := templateOrigins(renderedTemplates)
+	now := time.Now().UTC()
+	encoder := json.NewEncoder(tp.options.AuditLog)
+	for _, u := range us {
+		origin := origins[u]
+		record := AuditRecord{
+			Timestamp:         now,
+			TemplateName:      origin.templateName,
+			ResourceGVK:       u.GroupVersionKind().String(),
+			ResourceNamespace: u.GetNamespace(),
+			ResourceName:      u.GetName(),
+			RenderDurationMs:  origin.duration.Milliseconds(),
+			ValuesHash:        valuesHash,
+		}
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//templateOrigins maps each rendered resource to the template which rendered it
+func templateOrigins(renderedTemplates []renderedTemplate) map[*unstructured.Unstructured]renderedTemplate {
+	origins := make(map[*unstructured.Unstructured]renderedTemplate)
+	for _, r := range renderedTemplates {
+		for _, u := range r.us {
+			origins[u] = r
+		}
+	}
+	return origins
+}
+
+//hashValues returns the hex encoded sha256 of the JSON encoded values
+func hashValues(values interface{}) (string, error) {
+	b, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,138 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+func TestTemplateProcessor_writeAuditLog(t *testing.T) {
+	auditLog := &bytes.Buffer{}
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/service": `
+apiVersion: v1
+kind: Service
+metadata:
+  name: {{ .Name }}
+  namespace: myns
+  labels:
+    app: myapp
+  annotations:
+    templateprocessor.io/enable-monitoring: "true"
+spec:
+  ports:
+  - name: metrics
+    port: 8443`,
+	}), WithOptions(&Options{
+		AuditLog:           auditLog,
+		AutoServiceMonitor: true,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := struct{ Name string }{Name: "myservice"}
+	us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantHash, err := hashValues(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := make([]AuditRecord, 0)
+	decoder := json.NewDecoder(auditLog)
+	for decoder.More() {
+		record := AuditRecord{}
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != len(us) {
+		t.Fatalf("Expecting %d records got %d", len(us), len(records))
+	}
+	for _, record := range records {
+		if record.ValuesHash != wantHash {
+			t.Errorf("Expecting valuesHash %s got %s", wantHash, record.ValuesHash)
+		}
+		if record.Timestamp.IsZero() {
+			t.Errorf("Expecting a timestamp for %s", record.ResourceName)
+		}
+		switch record.ResourceGVK {
+		case "/v1, Kind=Service":
+			if record.TemplateName != "test/service" ||
+				record.ResourceNamespace != "myns" ||
+				record.ResourceName != "myservice" {
+				t.Errorf("Unexpected Service record %v", record)
+			}
+		case "monitoring.coreos.com/v1, Kind=ServiceMonitor":
+			if record.TemplateName != "" {
+				t.Errorf("Expecting no templateName for a generated resource got %s", record.TemplateName)
+			}
+		default:
+			t.Errorf("Unexpected record %v", record)
+		}
+	}
+}
+
+func TestTemplateProcessor_TemplateResourcesInPathWithAuditWriter(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/configmaps": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm1
+  namespace: myns
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm2
+  namespace: myns`,
+		"test/empty": `{{ if false }}
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: empty
+{{ end }}`,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditWriter := &bytes.Buffer{}
+	us, err := tp.TemplateResourcesInPathWithAuditWriter(context.TODO(), "test", nil, false, nil, auditWriter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(us) != 2 {
+		t.Errorf("Expecting 2 resources got %d", len(us))
+	}
+	rendered, err := tp.TemplateResource(context.TODO(), "test/configmaps", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(rendered)
+	events := make(map[string]TemplateAuditEvent)
+	decoder := json.NewDecoder(auditWriter)
+	for decoder.More() {
+		event := TemplateAuditEvent{}
+		if err := decoder.Decode(&event); err != nil {
+			t.Fatal(err)
+		}
+		events[event.TemplatePath] = event
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expecting 2 events got %v", events)
+	}
+	if e := events["test/configmaps"]; e.ResourceCount != 2 || e.SHA256 != hex.EncodeToString(sum[:]) || e.Timestamp.IsZero() {
+		t.Errorf("Unexpected event %v", e)
+	}
+	if e := events["test/empty"]; e.ResourceCount != 0 {
+		t.Errorf("Expecting no resource for test/empty got %d", e.ResourceCount)
+	}
+}
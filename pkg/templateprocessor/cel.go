@@ -0,0 +1,108 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+//celObjectVariable the name of the variable holding the resource in the CEL expressions
+const celObjectVariable = "object"
+
+//CELValidation a CEL expression evaluated against each rendered resource,
+//the resource is available in the expression as the variable "object"
+//(ie: "object.kind != 'Deployment' || object.spec.replicas <= 10").
+//The expression must evaluate to true for the resource to be valid.
+type CELValidation struct {
+	Expression string
+	//Message the message reported when the expression doesn't evaluate to true
+	Message string
+}
+
+//CELValidationFailure a resource which failed a CELValidation
+type CELValidationFailure struct {
+	Kind       string
+	Namespace  string
+	Name       string
+	Expression string
+	Message    string
+	//Err the evaluation error if the expression failed to evaluate
+	Err error
+}
+
+func (f CELValidationFailure) String() string {
+	s := fmt.Sprintf("%s %s/%s failed \"%s\": %s", f.Kind, f.Namespace, f.Name, f.Expression, f.Message)
+	if f.Err != nil {
+		s += fmt.Sprintf(" (%s)", f.Err)
+	}
+	return s
+}
+
+//CELValidationError is returned when resources fail the Options.CELValidations
+type CELValidationError struct {
+	Failures []CELValidationFailure
+}
+
+func (e *CELValidationError) Error() string {
+	failures := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		failures[i] = f.String()
+	}
+	return fmt.Sprintf("CEL validations failed: %s", strings.Join(failures, ", "))
+}
+
+//validateCEL evaluates each Options.CELValidations against each resource
+//and returns a CELValidationError listing the resources failing a validation
+func (tp *TemplateProcessor) validateCEL(us []*unstructured.Unstructured) error {
+	if len(tp.options.CELValidations) == 0 {
+		return nil
+	}
+	env, err := cel.NewEnv(cel.Declarations(
+		decls.NewVar(celObjectVariable, decls.NewMapType(decls.String, decls.Dyn))))
+	if err != nil {
+		return err
+	}
+	programs := make([]cel.Program, len(tp.options.CELValidations))
+	for i, v := range tp.options.CELValidations {
+		ast, issues := env.Compile(v.Expression)
+		if issues != nil && issues.Err() != nil {
+			return fmt.Errorf("invalid CEL expression \"%s\": %s", v.Expression, issues.Err())
+		}
+		programs[i], err = env.Program(ast)
+		if err != nil {
+			return fmt.Errorf("invalid CEL expression \"%s\": %s", v.Expression, err)
+		}
+	}
+	failures := make([]CELValidationFailure, 0)
+	for _, u := range us {
+		for i, v := range tp.options.CELValidations {
+			out, _, err := programs[i].Eval(map[string]interface{}{celObjectVariable: u.Object})
+			if err == nil {
+				valid, ok := out.Value().(bool)
+				if ok && valid {
+					continue
+				}
+				if !ok {
+					err = fmt.Errorf("expression returned %v instead of a bool", out.Value())
+				}
+			}
+			failures = append(failures, CELValidationFailure{
+				Kind:       u.GetKind(),
+				Namespace:  u.GetNamespace(),
+				Name:       u.GetName(),
+				Expression: v.Expression,
+				Message:    v.Message,
+				Err:        err,
+			})
+		}
+	}
+	if len(failures) != 0 {
+		return &CELValidationError{Failures: failures}
+	}
+	return nil
+}
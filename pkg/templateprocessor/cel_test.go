@@ -0,0 +1,97 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestTemplateProcessor_validateCEL(t *testing.T) {
+	deployment := func(name string, replicas int64) *unstructured.Unstructured {
+		u := newUnstructured("apps/v1", "Deployment", "myns", name)
+		_ = unstructured.SetNestedField(u.Object, replicas, "spec", "replicas")
+		return u
+	}
+	configMap := newUnstructured("v1", "ConfigMap", "myns", "myconfigmap")
+	tests := []struct {
+		name         string
+		validations  []CELValidation
+		us           []*unstructured.Unstructured
+		wantFailures []string
+		wantErr      bool
+	}{
+		{
+			name: "no validation",
+			us:   []*unstructured.Unstructured{deployment("d1", 20)},
+		},
+		{
+			name: "valid",
+			validations: []CELValidation{
+				{Expression: "object.kind != 'Deployment' || object.spec.replicas <= 10", Message: "too many replicas"},
+			},
+			us: []*unstructured.Unstructured{deployment("d1", 3), configMap},
+		},
+		{
+			name: "invalid",
+			validations: []CELValidation{
+				{Expression: "object.kind != 'Deployment' || object.spec.replicas <= 10", Message: "too many replicas"},
+				{Expression: "object.metadata.name.startsWith('d')", Message: "bad name"},
+			},
+			us:           []*unstructured.Unstructured{deployment("d1", 20), deployment("d2", 1), configMap},
+			wantFailures: []string{"d1", "myconfigmap"},
+			wantErr:      true,
+		},
+		{
+			name: "evaluation error",
+			validations: []CELValidation{
+				{Expression: "object.spec.replicas > 0", Message: "no replicas"},
+			},
+			us:           []*unstructured.Unstructured{configMap},
+			wantFailures: []string{"myconfigmap"},
+			wantErr:      true,
+		},
+		{
+			name: "not a bool",
+			validations: []CELValidation{
+				{Expression: "object.kind", Message: "not a bool"},
+			},
+			us:           []*unstructured.Unstructured{configMap},
+			wantFailures: []string{"myconfigmap"},
+			wantErr:      true,
+		},
+		{
+			name: "invalid expression",
+			validations: []CELValidation{
+				{Expression: "object.kind ==", Message: "invalid"},
+			},
+			us:      []*unstructured.Unstructured{configMap},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp := &TemplateProcessor{options: &Options{CELValidations: tt.validations}}
+			err := tp.validateCEL(tt.us)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateCEL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantFailures == nil {
+				return
+			}
+			celErr, ok := err.(*CELValidationError)
+			if !ok {
+				t.Fatalf("Expecting a CELValidationError got %v", err)
+			}
+			if len(celErr.Failures) != len(tt.wantFailures) {
+				t.Fatalf("Expecting %d failures got %v", len(tt.wantFailures), celErr.Failures)
+			}
+			for i, name := range tt.wantFailures {
+				if celErr.Failures[i].Name != name {
+					t.Errorf("Expecting failure for %s got %s", name, celErr.Failures[i].Name)
+				}
+			}
+		})
+	}
+}
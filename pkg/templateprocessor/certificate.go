@@ -0,0 +1,112 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+)
+
+//minRSAKeyBits the minimum size of the generated RSA keys
+const minRSAKeyBits = 2048
+
+//splitSANs splits the subject alternative names in IP addresses and DNS names
+func splitSANs(sans []string) (ips []net.IP, dnsNames []string) {
+	for _, san := range sans {
+		if ip := net.ParseIP(san); ip != nil {
+			ips = append(ips, ip)
+		} else {
+			dnsNames = append(dnsNames, san)
+		}
+	}
+	return ips, dnsNames
+}
+
+//generateCSR generates an RSA private key of keyBits bits and a certificate signing request
+//for the commonName and the subject alternative names. A new key is generated at each call.
+//It returns a map with the base64 encoded PEM CSR as "csr" and the base64 encoded PEM key as "key".
+func generateCSR(commonName string, sans []string, keyBits int) (map[string]string, error) {
+	if keyBits < minRSAKeyBits {
+		return nil, fmt.Errorf("invalid key size %d, it must be greater or equal to %d", keyBits, minRSAKeyBits)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, keyBits)
+	if err != nil {
+		return nil, err
+	}
+	ips, dnsNames := splitSANs(sans)
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: commonName},
+		DNSNames:    dnsNames,
+		IPAddresses: ips,
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"csr": base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+		"key": base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+	}, nil
+}
+
+//generateSelfSignedCert generates an ECDSA P-256 key and a self-signed certificate for the host
+//and the alternate IPs and DNS names, valid from now for validFor. A new key is generated at each call.
+//It returns a map with the base64 encoded PEM certificate as "cert" and the base64 encoded PEM key as "key".
+func generateSelfSignedCert(
+	host string,
+	alternateIPs []string,
+	alternateDNS []string,
+	validFor time.Duration,
+) (map[string]string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	ips, dnsNames := splitSANs([]string{host})
+	for _, s := range alternateIPs {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid alternate IP %s", s)
+		}
+		ips = append(ips, ip)
+	}
+	dnsNames = append(dnsNames, alternateDNS...)
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	notBefore := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: host},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(validFor),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              dnsNames,
+		IPAddresses:           ips,
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"cert": base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})),
+		"key":  base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes})),
+	}, nil
+}
@@ -0,0 +1,90 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func decodePEM(t *testing.T, s string, blockType string) []byte {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != blockType {
+		t.Fatalf("Expecting a %s PEM block got %s", blockType, string(b))
+	}
+	return block.Bytes
+}
+
+func Test_generateCSR(t *testing.T) {
+	got, err := generateCSR("myservice.myns.svc", []string{"myservice", "10.0.0.1"}, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.ParseCertificateRequest(decodePEM(t, got["csr"], "CERTIFICATE REQUEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		t.Error(err)
+	}
+	if csr.Subject.CommonName != "myservice.myns.svc" {
+		t.Errorf("Expecting common name myservice.myns.svc got %s", csr.Subject.CommonName)
+	}
+	if !reflect.DeepEqual(csr.DNSNames, []string{"myservice"}) ||
+		len(csr.IPAddresses) != 1 || csr.IPAddresses[0].String() != "10.0.0.1" {
+		t.Errorf("Unexpected SANs %v %v", csr.DNSNames, csr.IPAddresses)
+	}
+	key, err := x509.ParsePKCS1PrivateKey(decodePEM(t, got["key"], "RSA PRIVATE KEY"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.N.BitLen() != 2048 {
+		t.Errorf("Expecting a 2048 bits key got %d", key.N.BitLen())
+	}
+	if _, err := generateCSR("myservice.myns.svc", nil, 1024); err == nil {
+		t.Error("Expecting an error for a too small key")
+	}
+}
+
+func Test_generateSelfSignedCert(t *testing.T) {
+	start := time.Now().Truncate(time.Second)
+	got, err := generateSelfSignedCert("myservice.myns.svc", []string{"10.0.0.1"}, []string{"myservice"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(decodePEM(t, got["cert"], "CERTIFICATE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.CheckSignatureFrom(cert); err != nil {
+		t.Error(err)
+	}
+	if cert.Subject.CommonName != "myservice.myns.svc" {
+		t.Errorf("Expecting common name myservice.myns.svc got %s", cert.Subject.CommonName)
+	}
+	if !reflect.DeepEqual(cert.DNSNames, []string{"myservice.myns.svc", "myservice"}) ||
+		len(cert.IPAddresses) != 1 || cert.IPAddresses[0].String() != "10.0.0.1" {
+		t.Errorf("Unexpected SANs %v %v", cert.DNSNames, cert.IPAddresses)
+	}
+	if cert.NotBefore.Before(start) || cert.NotAfter.Sub(cert.NotBefore) != time.Hour {
+		t.Errorf("Expecting a validity from now for 1h got %s to %s", cert.NotBefore, cert.NotAfter)
+	}
+	key, err := x509.ParseECPrivateKey(decodePEM(t, got["key"], "EC PRIVATE KEY"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.PublicKey.Equal(cert.PublicKey) {
+		t.Error("Expecting the certificate to be issued for the key")
+	}
+	if _, err := generateSelfSignedCert("myservice.myns.svc", []string{"notanip"}, nil, time.Hour); err == nil {
+		t.Error("Expecting an error for an invalid alternate IP")
+	}
+}
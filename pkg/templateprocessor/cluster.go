@@ -0,0 +1,344 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+//gvrFor returns the GroupVersionResource of a GroupVersionKind
+func gvrFor(gvk schema.GroupVersionKind) schema.GroupVersionResource {
+	gvr, _ := meta.UnsafeGuessKindToResource(gvk)
+	return gvr
+}
+
+//ResourceCountLimitError is returned when the resources of a kind in the cluster
+//plus the rendered ones exceed the Options.ClusterResourceCountLimit
+type ResourceCountLimitError struct {
+	GroupVersionKind schema.GroupVersionKind
+	ClusterCount     int64
+	RenderedCount    int64
+	Limit            int
+}
+
+func (e *ResourceCountLimitError) Error() string {
+	return fmt.Sprintf("%s: %d resources in the cluster plus %d rendered exceed the limit of %d",
+		e.GroupVersionKind, e.ClusterCount, e.RenderedCount, e.Limit)
+}
+
+//checkClusterResourceCount returns a ResourceCountLimitError if for a kind,
+//the number of resources in the cluster plus the rendered ones exceeds the options.ClusterResourceCountLimit
+func (tp *TemplateProcessor) checkClusterResourceCount(ctx context.Context, us []*unstructured.Unstructured) error {
+	if tp.options.ClusterResourceCountLimit <= 0 || tp.options.DynamicClient == nil {
+		return nil
+	}
+	rendered := make(map[schema.GroupVersionKind]int64)
+	gvks := make([]schema.GroupVersionKind, 0)
+	for _, u := range us {
+		gvk := u.GroupVersionKind()
+		if _, ok := rendered[gvk]; !ok {
+			gvks = append(gvks, gvk)
+		}
+		rendered[gvk]++
+	}
+	for _, gvk := range gvks {
+		l, err := tp.options.DynamicClient.Resource(gvrFor(gvk)).
+			List(ctx, metav1.ListOptions{Limit: 1})
+		if err != nil {
+			return err
+		}
+		count := int64(len(l.Items))
+		if remaining := l.GetRemainingItemCount(); remaining != nil {
+			count += *remaining
+		}
+		if count+rendered[gvk] > int64(tp.options.ClusterResourceCountLimit) {
+			return &ResourceCountLimitError{
+				GroupVersionKind: gvk,
+				ClusterCount:     count,
+				RenderedCount:    rendered[gvk],
+				Limit:            tp.options.ClusterResourceCountLimit,
+			}
+		}
+	}
+	return nil
+}
+
+//LockWarning is raised when a rendered resource is skipped because the live resource is locked
+type LockWarning struct {
+	GroupVersionKind schema.GroupVersionKind
+	Namespace        string
+	Name             string
+	Annotation       string
+}
+
+func (w *LockWarning) Error() string {
+	return fmt.Sprintf("%s %s/%s is locked by the annotation %s, skipped",
+		w.GroupVersionKind, w.Namespace, w.Name, w.Annotation)
+}
+
+//lockedValue the value of the options.LockAnnotation locking a live resource
+const lockedValue = "locked"
+
+//skipLockedResources removes the resources whose live resource has the options.LockAnnotation set to "locked"
+//and raises a LockWarning for each of them
+func (tp *TemplateProcessor) skipLockedResources(
+	ctx context.Context,
+	rs *renderState,
+	us []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	if tp.options.LockAnnotation == "" || tp.options.DynamicClient == nil {
+		return us, nil
+	}
+	results := make([]*unstructured.Unstructured, 0, len(us))
+	for _, u := range us {
+		live, err := tp.options.DynamicClient.Resource(gvrFor(u.GroupVersionKind())).
+			Namespace(u.GetNamespace()).
+			Get(ctx, u.GetName(), metav1.GetOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+		if err == nil && live.GetAnnotations()[tp.options.LockAnnotation] == lockedValue {
+			rs.warn(&LockWarning{
+				GroupVersionKind: u.GroupVersionKind(),
+				Namespace:        u.GetNamespace(),
+				Name:             u.GetName(),
+				Annotation:       tp.options.LockAnnotation,
+			})
+			continue
+		}
+		results = append(results, u)
+	}
+	return results, nil
+}
+
+//ResourceTooOldWarning is raised when the live resource of a rendered resource is older than the options.MaxResourceAge
+type ResourceTooOldWarning struct {
+	GroupVersionKind  schema.GroupVersionKind
+	Namespace         string
+	Name              string
+	CreationTimestamp time.Time
+	MaxAge            time.Duration
+}
+
+func (w *ResourceTooOldWarning) Error() string {
+	return fmt.Sprintf("%s %s/%s created at %s is older than %s",
+		w.GroupVersionKind, w.Namespace, w.Name, w.CreationTimestamp.Format(time.RFC3339), w.MaxAge)
+}
+
+//checkResourceAge raises a ResourceTooOldWarning for each resource whose live resource is older than
+//the options.MaxResourceAge
+func (tp *TemplateProcessor) checkResourceAge(ctx context.Context, rs *renderState, us []*unstructured.Unstructured) error {
+	if tp.options.MaxResourceAge == 0 || tp.options.DynamicClient == nil {
+		return nil
+	}
+	now := time.Now()
+	for _, u := range us {
+		live, err := tp.options.DynamicClient.Resource(gvrFor(u.GroupVersionKind())).
+			Namespace(u.GetNamespace()).
+			Get(ctx, u.GetName(), metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		created := live.GetCreationTimestamp()
+		if created.IsZero() || now.Sub(created.Time) <= tp.options.MaxResourceAge {
+			continue
+		}
+		rs.warn(&ResourceTooOldWarning{
+			GroupVersionKind:  u.GroupVersionKind(),
+			Namespace:         u.GetNamespace(),
+			Name:              u.GetName(),
+			CreationTimestamp: created.Time,
+			MaxAge:            tp.options.MaxResourceAge,
+		})
+	}
+	return nil
+}
+
+//ManagedAnnotation marks the resources of the cluster managed by the templates,
+//a managed resource which is not rendered anymore has to be pruned.
+//It is set on the rendered resources if Options.InjectManagedAnnotation is true
+const ManagedAnnotation = "templateprocessor.io/managed"
+
+//ClusterDiff lists the differences between the rendered resources and the cluster
+type ClusterDiff struct {
+	//ToCreate the rendered resources absent from the cluster
+	ToCreate []*unstructured.Unstructured
+	//ToUpdate the rendered resources which differ from the cluster
+	ToUpdate []*unstructured.Unstructured
+	//ToPrune the resources of the cluster annotated with the ManagedAnnotation which are not rendered
+	ToPrune []*unstructured.Unstructured
+}
+
+//CompareToLiveCluster renders the templates in path and compares the resources with the cluster.
+//A rendered resource differs from the cluster if one of its fields, except the metadata other than
+//the labels and annotations, has a different value in the cluster.
+//The resources to prune are searched among the kinds of the rendered resources and the pruneKinds,
+//the pruneKinds must list the kinds which may not be rendered anymore.
+func (tp *TemplateProcessor) CompareToLiveCluster(
+	ctx context.Context,
+	path string,
+	excluded []string,
+	recursive bool,
+	values interface{},
+	client dynamic.Interface,
+	pruneKinds []schema.GroupVersionKind,
+) (*ClusterDiff, error) {
+	us, err := tp.TemplateResourcesInPathUnstructured(ctx, path, excluded, recursive, values)
+	if err != nil {
+		return nil, err
+	}
+	diff := &ClusterDiff{
+		ToCreate: make([]*unstructured.Unstructured, 0),
+		ToUpdate: make([]*unstructured.Unstructured, 0),
+	}
+	for _, u := range us {
+		live, err := client.Resource(gvrFor(u.GroupVersionKind())).
+			Namespace(u.GetNamespace()).
+			Get(ctx, u.GetName(), metav1.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				diff.ToCreate = append(diff.ToCreate, u)
+				continue
+			}
+			return nil, err
+		}
+		if !matchesLive(u, live) {
+			diff.ToUpdate = append(diff.ToUpdate, u)
+		}
+	}
+	diff.ToPrune, err = pruneList(ctx, us, pruneKinds, client)
+	if err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
+//GeneratePruneList renders the templates in path and returns the resources of the cluster annotated
+//with the ManagedAnnotation which are not rendered anymore and have to be deleted.
+//The resources are searched among the kinds of the rendered resources and the pruneKinds, the pruneKinds must
+//list the kinds which may not be rendered anymore, for example when the last template of a kind is removed.
+//The resources are sorted in the TemplateProcessor order, use SetDeleteOrder to get them in the deletion order.
+func (tp *TemplateProcessor) GeneratePruneList(
+	ctx context.Context,
+	path string,
+	excluded []string,
+	recursive bool,
+	values interface{},
+	client dynamic.Interface,
+	pruneKinds []schema.GroupVersionKind,
+) ([]*unstructured.Unstructured, error) {
+	us, err := tp.TemplateResourcesInPathUnstructured(ctx, path, excluded, recursive, values)
+	if err != nil {
+		return nil, err
+	}
+	toPrune, err := pruneList(ctx, us, pruneKinds, client)
+	if err != nil {
+		return nil, err
+	}
+	tp.sortUnstructuredForApply(toPrune)
+	return toPrune, nil
+}
+
+//pruneList returns the resources of the cluster, of the kinds of the rendered resources and of the pruneKinds,
+//annotated with the ManagedAnnotation which are not rendered
+func pruneList(
+	ctx context.Context,
+	us []*unstructured.Unstructured,
+	pruneKinds []schema.GroupVersionKind,
+	client dynamic.Interface) ([]*unstructured.Unstructured, error) {
+	rendered := make(map[string]bool, len(us))
+	gvks := make([]schema.GroupVersionKind, 0)
+	scanned := make(map[schema.GroupVersionKind]bool)
+	addKind := func(gvk schema.GroupVersionKind) {
+		if !scanned[gvk] {
+			scanned[gvk] = true
+			gvks = append(gvks, gvk)
+		}
+	}
+	for _, u := range us {
+		addKind(u.GroupVersionKind())
+		rendered[resourceIdentity(u)] = true
+	}
+	for _, gvk := range pruneKinds {
+		addKind(gvk)
+	}
+	toPrune := make([]*unstructured.Unstructured, 0)
+	for _, gvk := range gvks {
+		l, err := client.Resource(gvrFor(gvk)).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for i := range l.Items {
+			live := &l.Items[i]
+			if _, ok := live.GetAnnotations()[ManagedAnnotation]; ok && !rendered[resourceIdentity(live)] {
+				toPrune = append(toPrune, live)
+			}
+		}
+	}
+	return toPrune, nil
+}
+
+//matchesLive returns true if the fields of the rendered resource have the same values in the live resource,
+//only the labels and annotations of the metadata are compared
+func matchesLive(u, live *unstructured.Unstructured) bool {
+	for k, v := range u.Object {
+		if k == "metadata" {
+			continue
+		}
+		if !isSubset(v, live.Object[k]) {
+			return false
+		}
+	}
+	for k, v := range u.GetLabels() {
+		if live.GetLabels()[k] != v {
+			return false
+		}
+	}
+	for k, v := range u.GetAnnotations() {
+		if live.GetAnnotations()[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+//isSubset returns true if the maps of a are included in the maps of b and the other values are equal
+func isSubset(a, b interface{}) bool {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range av {
+			if !isSubset(v, bv[k]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !isSubset(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
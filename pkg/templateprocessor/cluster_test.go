@@ -0,0 +1,409 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/rest"
+)
+
+func newUnstructured(apiVersion, kind, namespace, name string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion(apiVersion)
+	u.SetKind(kind)
+	u.SetNamespace(namespace)
+	u.SetName(name)
+	return u
+}
+
+func TestTemplateProcessor_checkClusterResourceCount(t *testing.T) {
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(),
+		newUnstructured("v1", "ServiceAccount", "ns1", "sa1"),
+		newUnstructured("v1", "ServiceAccount", "ns2", "sa2"),
+	)
+	tests := []struct {
+		name    string
+		limit   int
+		wantErr bool
+	}{
+		{
+			name:    "under the limit",
+			limit:   3,
+			wantErr: false,
+		},
+		{
+			name:    "over the limit",
+			limit:   2,
+			wantErr: true,
+		},
+		{
+			name:    "disabled",
+			limit:   0,
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(assets), WithOptions(&Options{
+				DynamicClient:             client,
+				ClusterResourceCountLimit: tt.limit,
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = tp.TemplateResourcesUnstructured(context.TODO(), []string{"test/serviceaccount"}, values)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TemplateResourcesUnstructured() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, ok := err.(*ResourceCountLimitError); err != nil && !ok {
+				t.Errorf("Expecting a ResourceCountLimitError got %T", err)
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_skipLockedResources(t *testing.T) {
+	locked := newUnstructured("v1", "ConfigMap", "myns", "locked")
+	locked.SetAnnotations(map[string]string{"example.com/lock": "locked"})
+	unlocked := newUnstructured("v1", "ConfigMap", "myns", "unlocked")
+	unlocked.SetAnnotations(map[string]string{"example.com/lock": "unlocked"})
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), locked, unlocked)
+	assets := map[string]string{
+		"test/locked": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: locked
+  namespace: myns`,
+		"test/unlocked": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unlocked
+  namespace: myns`,
+		"test/new": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: new
+  namespace: myns`,
+	}
+	tests := []struct {
+		name         string
+		options      *Options
+		wantCount    int
+		wantWarnings int
+	}{
+		{
+			name:      "no lock annotation",
+			options:   &Options{DynamicClient: client},
+			wantCount: 3,
+		},
+		{
+			name:         "lock annotation",
+			options:      &Options{DynamicClient: client, LockAnnotation: "example.com/lock"},
+			wantCount:    2,
+			wantWarnings: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(assets), WithOptions(tt.options))
+			if err != nil {
+				t.Fatal(err)
+			}
+			us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(us) != tt.wantCount {
+				t.Errorf("Expecting %d resources got %d", tt.wantCount, len(us))
+			}
+			if findResource(us, "ConfigMap", "myns", "locked") != nil && tt.wantWarnings != 0 {
+				t.Error("Expecting the locked resource to be skipped")
+			}
+			if len(tp.Warnings()) != tt.wantWarnings {
+				t.Errorf("Expecting %d warnings got %v", tt.wantWarnings, tp.Warnings())
+			}
+			for _, w := range tp.Warnings() {
+				if _, ok := w.(*LockWarning); !ok {
+					t.Errorf("Expecting a LockWarning got %T", w)
+				}
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_CompareToLiveCluster(t *testing.T) {
+	unchanged := newUnstructured("v1", "ConfigMap", "myns", "unchanged")
+	unchanged.Object["data"] = map[string]interface{}{"key": "value"}
+	unchanged.SetLabels(map[string]string{"app": "myapp", "extra": "label"})
+	changed := newUnstructured("v1", "ConfigMap", "myns", "changed")
+	changed.Object["data"] = map[string]interface{}{"key": "oldvalue"}
+	obsolete := newUnstructured("v1", "ConfigMap", "myns", "obsolete")
+	obsolete.SetAnnotations(map[string]string{ManagedAnnotation: "true"})
+	notManaged := newUnstructured("v1", "ConfigMap", "myns", "notmanaged")
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), unchanged, changed, obsolete, notManaged)
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/unchanged": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unchanged
+  namespace: myns
+  labels:
+    app: myapp
+data:
+  key: value`,
+		"test/changed": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: changed
+  namespace: myns
+data:
+  key: newvalue`,
+		"test/new": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: new
+  namespace: myns`,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff, err := tp.CompareToLiveCluster(context.TODO(), "test", nil, false, nil, client, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := func(us []*unstructured.Unstructured) []string {
+		results := make([]string, 0)
+		for _, u := range us {
+			results = append(results, u.GetName())
+		}
+		return results
+	}
+	if got := names(diff.ToCreate); !reflect.DeepEqual(got, []string{"new"}) {
+		t.Errorf("Expecting ToCreate [new] got %v", got)
+	}
+	if got := names(diff.ToUpdate); !reflect.DeepEqual(got, []string{"changed"}) {
+		t.Errorf("Expecting ToUpdate [changed] got %v", got)
+	}
+	if got := names(diff.ToPrune); !reflect.DeepEqual(got, []string{"obsolete"}) {
+		t.Errorf("Expecting ToPrune [obsolete] got %v", got)
+	}
+}
+
+func TestTemplateProcessor_GeneratePruneList(t *testing.T) {
+	managed := map[string]string{ManagedAnnotation: "true"}
+	kept := newUnstructured("v1", "ConfigMap", "myns", "kept")
+	kept.SetAnnotations(managed)
+	obsolete := newUnstructured("v1", "ConfigMap", "myns", "obsolete")
+	obsolete.SetAnnotations(managed)
+	obsoleteSA := newUnstructured("v1", "ServiceAccount", "myns", "obsolete-sa")
+	obsoleteSA.SetAnnotations(managed)
+	otherKind := newUnstructured("v1", "Secret", "myns", "other-kind")
+	otherKind.SetAnnotations(managed)
+	notManaged := newUnstructured("v1", "ConfigMap", "myns", "notmanaged")
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), kept, obsolete, obsoleteSA, otherKind, notManaged)
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/configmap": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: kept
+  namespace: myns`,
+		"test/serviceaccount": `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: sa
+  namespace: myns`,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := func(us []*unstructured.Unstructured) []string {
+		results := make([]string, 0)
+		for _, u := range us {
+			results = append(results, u.GetName())
+		}
+		return results
+	}
+	toPrune, err := tp.GeneratePruneList(context.TODO(), "test", nil, false, nil, client, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(toPrune); !reflect.DeepEqual(got, []string{"obsolete-sa", "obsolete"}) {
+		t.Errorf("Expecting [obsolete-sa obsolete] got %v", got)
+	}
+	tp.SetDeleteOrder()
+	toPrune, err = tp.GeneratePruneList(context.TODO(), "test", nil, false, nil, client, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(toPrune); !reflect.DeepEqual(got, []string{"obsolete", "obsolete-sa"}) {
+		t.Errorf("Expecting [obsolete obsolete-sa] in the delete order got %v", got)
+	}
+	toPrune, err = tp.GeneratePruneList(context.TODO(), "test", nil, false, nil, client,
+		[]schema.GroupVersionKind{{Version: "v1", Kind: "Secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(toPrune); !reflect.DeepEqual(got, []string{"obsolete", "other-kind", "obsolete-sa"}) {
+		t.Errorf("Expecting the Secret kind not rendered anymore to be pruned got %v", got)
+	}
+}
+
+func TestTemplateProcessor_InjectManagedAnnotation(t *testing.T) {
+	assets := make(map[string]string)
+	for _, name := range []string{"kept", "obsolete"} {
+		assets["test/"+name] = `
+{{- if has "` + name + `" .Names }}
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ` + name + `
+  namespace: myns
+{{- end }}`
+	}
+	tp, err := NewTemplateProcessor(NewTestReader(assets), WithOptions(&Options{InjectManagedAnnotation: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false,
+		map[string]interface{}{"Names": []string{"kept", "obsolete"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme())
+	for _, u := range us {
+		if u.GetAnnotations()[ManagedAnnotation] != "true" {
+			t.Errorf("Expecting the ManagedAnnotation on %s", u.GetName())
+		}
+		_, err := client.Resource(gvrFor(u.GroupVersionKind())).Namespace(u.GetNamespace()).
+			Create(context.TODO(), u, metav1.CreateOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	toPrune, err := tp.GeneratePruneList(context.TODO(), "test", nil, false,
+		map[string]interface{}{"Names": []string{"kept"}}, client, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toPrune) != 1 || toPrune[0].GetName() != "obsolete" {
+		t.Errorf("Expecting [obsolete] got %v", toPrune)
+	}
+}
+
+func TestTemplateProcessor_postRenderContext(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer srv.Close()
+	client, err := dynamic.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/configmap": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: mycm
+  namespace: myns`,
+	}), WithOptions(&Options{DynamicClient: client, LockAnnotation: "example.com/lock"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+	defer cancel()
+	_, err = tp.TemplateResourcesInPathUnstructured(ctx, "test", nil, false, nil)
+	if err == nil || ctx.Err() == nil {
+		t.Errorf("Expecting the request to the cluster to be cancelled got %v", err)
+	}
+}
+
+func TestTemplateProcessor_checkResourceAge(t *testing.T) {
+	old := newUnstructured("v1", "ConfigMap", "myns", "old")
+	old.SetCreationTimestamp(metav1.NewTime(time.Now().Add(-48 * time.Hour)))
+	recent := newUnstructured("v1", "ConfigMap", "myns", "recent")
+	recent.SetCreationTimestamp(metav1.NewTime(time.Now().Add(-time.Hour)))
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), old, recent)
+	assets := make(map[string]string)
+	for _, name := range []string{"old", "recent", "new"} {
+		assets["test/"+name] = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ` + name + `
+  namespace: myns`
+	}
+	tests := []struct {
+		name         string
+		options      *Options
+		wantWarnings []string
+	}{
+		{
+			name:    "no max age",
+			options: &Options{DynamicClient: client},
+		},
+		{
+			name:         "max age",
+			options:      &Options{DynamicClient: client, MaxResourceAge: 24 * time.Hour},
+			wantWarnings: []string{"old"},
+		},
+		{
+			name:         "short max age",
+			options:      &Options{DynamicClient: client, MaxResourceAge: time.Minute},
+			wantWarnings: []string{"old", "recent"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(assets), WithOptions(tt.options))
+			if err != nil {
+				t.Fatal(err)
+			}
+			us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(us) != 3 {
+				t.Errorf("Expecting 3 resources got %d", len(us))
+			}
+			names := make([]string, 0)
+			for _, w := range tp.Warnings() {
+				tooOld, ok := w.(*ResourceTooOldWarning)
+				if !ok {
+					t.Fatalf("Expecting a ResourceTooOldWarning got %T", w)
+				}
+				names = append(names, tooOld.Name)
+			}
+			sort.Strings(names)
+			if len(names) != len(tt.wantWarnings) || (len(names) != 0 && !reflect.DeepEqual(names, tt.wantWarnings)) {
+				t.Errorf("Expecting warnings for %v got %v", tt.wantWarnings, names)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ghodss/yaml"
+)
+
+//WeightedReader a TemplateReader and its weight in a CompositeWeightedReader
+type WeightedReader struct {
+	Reader TemplateReader
+	Weight int
+}
+
+//CompositeWeightedReader defines a reader combining several readers,
+//the assets of the readers with a higher weight are preferred
+type CompositeWeightedReader struct {
+	//readers sorted by decreasing weight
+	readers []WeightedReader
+}
+
+var _ TemplateReader = &CompositeWeightedReader{}
+
+//Asset returns the asset of the reader with the highest weight having it
+func (r *CompositeWeightedReader) Asset(name string) ([]byte, error) {
+	for _, wr := range r.readers {
+		if b, err := wr.Reader.Asset(name); err == nil {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("Asset %s not found", name)
+}
+
+//AssetNames returns the names of the assets of all readers, the names of the readers with a higher weight first.
+//The names of the readers with the same weight are sorted alphabetically, a name is returned only once.
+func (r *CompositeWeightedReader) AssetNames() ([]string, error) {
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+	for i := 0; i < len(r.readers); {
+		tier := make([]string, 0)
+		weight := r.readers[i].Weight
+		for ; i < len(r.readers) && r.readers[i].Weight == weight; i++ {
+			readerNames, err := r.readers[i].Reader.AssetNames()
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range readerNames {
+				if !seen[name] {
+					seen[name] = true
+					tier = append(tier, name)
+				}
+			}
+		}
+		sort.Strings(tier)
+		names = append(names, tier...)
+	}
+	return names, nil
+}
+
+//ToJSON converts to JSON using the reader with the highest weight
+func (r *CompositeWeightedReader) ToJSON(b []byte) ([]byte, error) {
+	if len(r.readers) == 0 {
+		return yaml.YAMLToJSON(b)
+	}
+	return r.readers[0].Reader.ToJSON(b)
+}
+
+//NewCompositeWeightedReader constructs a new CompositeWeightedReader
+func NewCompositeWeightedReader(readers ...WeightedReader) *CompositeWeightedReader {
+	sorted := make([]WeightedReader, len(readers))
+	copy(sorted, readers)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Weight > sorted[j].Weight
+	})
+	return &CompositeWeightedReader{readers: sorted}
+}
@@ -0,0 +1,57 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestCompositeWeightedReader(t *testing.T) {
+	fallback := NewTestReader(map[string]string{
+		"test/configmap": "kind: ConfigMap\nmetadata:\n  name: fallback",
+		"test/secret":    "kind: Secret",
+	})
+	primary := NewTestReader(map[string]string{
+		"test/configmap":  "kind: ConfigMap\nmetadata:\n  name: primary",
+		"test/service":    "kind: Service",
+		"test/deployment": "kind: Deployment",
+	})
+	other := NewTestReader(map[string]string{
+		"test/namespace": "kind: Namespace",
+	})
+	r := NewCompositeWeightedReader(
+		WeightedReader{Reader: fallback, Weight: 1},
+		WeightedReader{Reader: primary, Weight: 10},
+		WeightedReader{Reader: other, Weight: 10},
+	)
+	names, err := r.AssetNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"test/configmap", "test/deployment", "test/namespace", "test/service", "test/secret"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("AssetNames() = %v, want %v", names, want)
+	}
+	b, err := r.Asset("test/configmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "kind: ConfigMap\nmetadata:\n  name: primary" {
+		t.Errorf("Expecting the primary asset got %s", string(b))
+	}
+	if _, err := r.Asset("test/secret"); err != nil {
+		t.Errorf("Expecting the fallback asset got %v", err)
+	}
+	if _, err := r.Asset("test/notfound"); err == nil {
+		t.Error("Expecting an error for a missing asset")
+	}
+	tp, err := NewTemplateProcessor(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil); err != nil {
+		t.Error(err)
+	}
+}
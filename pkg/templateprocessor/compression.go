@@ -0,0 +1,60 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+//TemplateResourcesInPathCompressed renders all assets in a path and returns them
+//as a single yaml stream, separated by "---\n", gzip compressed at the given level.
+//The resources are sorted following the order defined in variable kindsOrder
+func (tp *TemplateProcessor) TemplateResourcesInPathCompressed(
+	ctx context.Context,
+	path string,
+	excluded []string,
+	recursive bool,
+	values interface{},
+	level int,
+) ([]byte, error) {
+	us, err := tp.TemplateResourcesInPathUnstructured(ctx, path, excluded, recursive, values)
+	if err != nil {
+		return nil, err
+	}
+	yamls, err := ToYAMLsUnstructured(us)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write([]byte(ConvertArrayOfBytesToString(yamls))); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+//DecompressToUnstructured decompresses a gzip compressed yaml stream
+//as generated by TemplateResourcesInPathCompressed and returns its resources
+func (tp *TemplateProcessor) DecompressToUnstructured(data []byte) ([]*unstructured.Unstructured, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return tp.BytesArrayToUnstructured([][]byte{b})
+}
@@ -0,0 +1,74 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"compress/gzip"
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestTemplateProcessor_TemplateResourcesInPathCompressed(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/configmap": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Name }}
+  namespace: myns
+data:
+  key: value`,
+		"test/namespace": `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: myns`,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := struct{ Name string }{Name: "myconfigmap"}
+	want, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		level   int
+		wantErr bool
+	}{
+		{name: "default compression", level: gzip.DefaultCompression},
+		{name: "best compression", level: gzip.BestCompression},
+		{name: "no compression", level: gzip.NoCompression},
+		{name: "invalid level", level: 42, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tp.TemplateResourcesInPathCompressed(context.TODO(), "test", nil, false, values, tt.level)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TemplateResourcesInPathCompressed() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got, err := tp.DecompressToUnstructured(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("DecompressToUnstructured() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_DecompressToUnstructured_NotCompressed(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tp.DecompressToUnstructured([]byte("kind: ConfigMap")); err == nil {
+		t.Error("Expecting an error for not compressed data")
+	}
+}
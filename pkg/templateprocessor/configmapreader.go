@@ -0,0 +1,66 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+)
+
+//ConfigMapReader defines a reader for the templates stored in a ConfigMap, a key of the ConfigMap is a template
+type ConfigMapReader struct {
+	cm     *corev1.ConfigMap
+	toJSON func([]byte) ([]byte, error)
+}
+
+var _ TemplateReader = &ConfigMapReader{}
+
+//Asset returns the value of the key name in the data of the ConfigMap or else in its binaryData
+func (r *ConfigMapReader) Asset(
+	name string,
+) ([]byte, error) {
+	if v, ok := r.cm.Data[name]; ok {
+		return []byte(v), nil
+	}
+	if v, ok := r.cm.BinaryData[name]; ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("key %s not found in configmap %s/%s", name, r.cm.Namespace, r.cm.Name)
+}
+
+//AssetNames returns the sorted keys of the data and binaryData of the ConfigMap
+func (r *ConfigMapReader) AssetNames() ([]string, error) {
+	keys := make([]string, 0, len(r.cm.Data)+len(r.cm.BinaryData))
+	for k := range r.cm.Data {
+		keys = append(keys, k)
+	}
+	for k := range r.cm.BinaryData {
+		if _, ok := r.cm.Data[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+//ToJSON converts to JSON with the toJSON function of the reader
+func (r *ConfigMapReader) ToJSON(
+	b []byte,
+) ([]byte, error) {
+	return r.toJSON(b)
+}
+
+//NewConfigMapReader constructs a new ConfigMapReader reading the templates from the ConfigMap cm.
+//toJSON converts the templates to JSON, yaml.YAMLToJSON is used if nil.
+func NewConfigMapReader(cm *corev1.ConfigMap, toJSON func([]byte) ([]byte, error)) TemplateReader {
+	if toJSON == nil {
+		toJSON = yaml.YAMLToJSON
+	}
+	return &ConfigMapReader{
+		cm:     cm,
+		toJSON: toJSON,
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestConfigMapReader(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "templates", Namespace: "myns"},
+		Data: map[string]string{
+			"serviceaccount.yaml": `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: {{ .Name }}
+  namespace: myns`,
+			"both.yaml": "from data",
+		},
+		BinaryData: map[string][]byte{
+			"configmap.yaml": []byte(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Name }}
+  namespace: myns`),
+			"both.yaml": []byte("from binaryData"),
+		},
+	}
+	r := NewConfigMapReader(cm, yaml.YAMLToJSON)
+	names, err := r.AssetNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"both.yaml", "configmap.yaml", "serviceaccount.yaml"}) {
+		t.Errorf("Unexpected asset names %v", names)
+	}
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "both.yaml", want: "from data"},
+		{name: "configmap.yaml", want: string(cm.BinaryData["configmap.yaml"])},
+		{name: "serviceaccount.yaml", want: cm.Data["serviceaccount.yaml"]},
+		{name: "missing.yaml", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Asset(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ConfigMapReader.Asset() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("ConfigMapReader.Asset() = %s, want %s", string(got), tt.want)
+			}
+		})
+	}
+	j, err := r.ToJSON([]byte("a: b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(j) != `{"a":"b"}` {
+		t.Errorf("ConfigMapReader.ToJSON() = %s", string(j))
+	}
+	tp, err := NewTemplateProcessor(NewConfigMapReader(cm, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	us, err := tp.TemplateResourcesUnstructured(context.TODO(), []string{"configmap.yaml", "serviceaccount.yaml"}, struct{ Name string }{Name: "myname"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(us) != 2 || us[0].GetName() != "myname" || us[1].GetName() != "myname" {
+		t.Errorf("Unexpected resources %v", us)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+//ResourceDiffType the type of change of a resource between two renderings
+type ResourceDiffType string
+
+const (
+	//ResourceDiffAdded the resource is only rendered with the new values
+	ResourceDiffAdded ResourceDiffType = "Added"
+	//ResourceDiffRemoved the resource is only rendered with the base values
+	ResourceDiffRemoved ResourceDiffType = "Removed"
+	//ResourceDiffChanged the resource is rendered differently with the new values
+	ResourceDiffChanged ResourceDiffType = "Changed"
+)
+
+//ResourceDiff the change of a resource between the rendering with the base values and the new values
+type ResourceDiff struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Type      ResourceDiffType
+	//Diff the unified diff between the indented JSON of the base and the new resource
+	Diff string
+}
+
+//TemplateDiff renders the templates with the baseValues and the newValues and returns the resources
+//added, removed or changed by the newValues. The unchanged resources are not returned.
+//The resources are compared on their JSON, the keys being sorted, so the fields order doesn't matter.
+func (tp *TemplateProcessor) TemplateDiff(
+	ctx context.Context,
+	templateNames []string,
+	baseValues, newValues interface{},
+) ([]ResourceDiff, error) {
+	_, base, err := tp.renderUnstructured(ctx, templateNames, baseValues)
+	if err != nil {
+		return nil, err
+	}
+	_, us, err := tp.renderUnstructured(ctx, templateNames, newValues)
+	if err != nil {
+		return nil, err
+	}
+	baseByIdentity := make(map[string]*unstructured.Unstructured, len(base))
+	for _, u := range base {
+		baseByIdentity[resourceIdentity(u)] = u
+	}
+	diffs := make([]ResourceDiff, 0)
+	rendered := make(map[string]bool, len(us))
+	for _, u := range us {
+		rendered[resourceIdentity(u)] = true
+		b := baseByIdentity[resourceIdentity(u)]
+		diff, err := resourceDiff(b, u)
+		if err != nil {
+			return nil, err
+		}
+		if diff == "" {
+			continue
+		}
+		diffType := ResourceDiffChanged
+		if b == nil {
+			diffType = ResourceDiffAdded
+		}
+		diffs = append(diffs, ResourceDiff{
+			Kind:      u.GetKind(),
+			Namespace: u.GetNamespace(),
+			Name:      u.GetName(),
+			Type:      diffType,
+			Diff:      diff,
+		})
+	}
+	for _, b := range base {
+		if rendered[resourceIdentity(b)] {
+			continue
+		}
+		diff, err := resourceDiff(b, nil)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, ResourceDiff{
+			Kind:      b.GetKind(),
+			Namespace: b.GetNamespace(),
+			Name:      b.GetName(),
+			Type:      ResourceDiffRemoved,
+			Diff:      diff,
+		})
+	}
+	return diffs, nil
+}
+
+//resourceDiff returns the unified diff between the indented JSON of base and u, a nil resource is empty
+func resourceDiff(base, u *unstructured.Unstructured) (string, error) {
+	toLines := func(u *unstructured.Unstructured) ([]string, error) {
+		if u == nil {
+			return []string{}, nil
+		}
+		b, err := json.MarshalIndent(u.Object, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return difflib.SplitLines(string(b)), nil
+	}
+	a, err := toLines(base)
+	if err != nil {
+		return "", err
+	}
+	b, err := toLines(u)
+	if err != nil {
+		return "", err
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        a,
+		B:        b,
+		FromFile: "base",
+		ToFile:   "new",
+		Context:  3,
+	})
+}
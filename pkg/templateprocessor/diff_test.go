@@ -0,0 +1,92 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTemplateProcessor_TemplateDiff(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/unchanged": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unchanged
+  namespace: myns
+data:
+  key: value`,
+		"test/changed": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: changed
+  namespace: myns
+data:
+  replicas: "{{ .Replicas }}"
+  key: value`,
+		"test/optional": `
+{{- if .Optional }}
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Optional }}
+  namespace: myns
+{{- end }}`,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	templateNames := []string{"test/unchanged", "test/changed", "test/optional"}
+	type values struct {
+		Replicas int
+		Optional string
+	}
+	diffs, err := tp.TemplateDiff(context.TODO(), templateNames,
+		values{Replicas: 1, Optional: "removed"},
+		values{Replicas: 2, Optional: "added"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]ResourceDiffType)
+	for _, d := range diffs {
+		got[d.Name] = d.Type
+	}
+	want := map[string]ResourceDiffType{
+		"changed": ResourceDiffChanged,
+		"added":   ResourceDiffAdded,
+		"removed": ResourceDiffRemoved,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expecting %v got %v", want, got)
+	}
+	for _, d := range diffs {
+		switch d.Type {
+		case ResourceDiffChanged:
+			if !strings.Contains(d.Diff, `-    "replicas": "1"`) || !strings.Contains(d.Diff, `+    "replicas": "2"`) {
+				t.Errorf("Unexpected diff for %s:\n%s", d.Name, d.Diff)
+			}
+			if strings.Contains(d.Diff, `-    "key"`) {
+				t.Errorf("Expecting the unchanged fields not to be in the diff:\n%s", d.Diff)
+			}
+		case ResourceDiffAdded:
+			if !strings.Contains(d.Diff, `+    "name": "added",`) || d.Kind != "ConfigMap" || d.Namespace != "myns" {
+				t.Errorf("Unexpected diff for %s:\n%s", d.Name, d.Diff)
+			}
+		case ResourceDiffRemoved:
+			if !strings.Contains(d.Diff, `-    "name": "removed",`) {
+				t.Errorf("Unexpected diff for %s:\n%s", d.Name, d.Diff)
+			}
+		}
+	}
+	diffs, err = tp.TemplateDiff(context.TODO(), templateNames, values{Replicas: 1}, values{Replicas: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("Expecting no diff for the same values got %v", diffs)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"embed"
+	"io/fs"
+	"path"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/klog"
+)
+
+//EmbedFSReader defines a reader for the files embedded with go:embed
+type EmbedFSReader struct {
+	fs   embed.FS
+	root string
+}
+
+var _ TemplateReader = &EmbedFSReader{}
+
+//Asset returns an asset, the name is relative to the root of the reader
+func (r *EmbedFSReader) Asset(
+	name string,
+) ([]byte, error) {
+	return r.fs.ReadFile(path.Join(r.root, name))
+}
+
+//AssetNames returns the name, relative to the root of the reader, of all embedded files under the root
+func (r *EmbedFSReader) AssetNames() ([]string, error) {
+	keys := make([]string, 0)
+	err := fs.WalkDir(r.fs, r.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		key := p
+		if r.root != "." {
+			key = p[len(r.root)+1:]
+		}
+		keys = append(keys, key)
+		return nil
+	})
+	return keys, err
+}
+
+//ToJSON converts to JSON
+func (*EmbedFSReader) ToJSON(
+	b []byte,
+) ([]byte, error) {
+	b, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		klog.Errorf("err:%s\nyaml:\n%s", err, string(b))
+		return nil, err
+	}
+	return b, nil
+}
+
+//NewEmbedFSReader constructs a new EmbedFSReader reading the files of fs under root,
+//root is a slash separated path within fs, use "." to read all files of fs.
+func NewEmbedFSReader(fs embed.FS, root string) TemplateReader {
+	if root == "" {
+		root = "."
+	}
+	return &EmbedFSReader{
+		fs:   fs,
+		root: path.Clean(root),
+	}
+}
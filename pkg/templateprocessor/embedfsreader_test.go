@@ -0,0 +1,90 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+	"embed"
+	"reflect"
+	"testing"
+)
+
+//go:embed testdata
+var embedFSTestdata embed.FS
+
+func TestEmbedFSReader_AssetNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		root    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "sub directory",
+			root: "testdata/embedfsreader",
+			want: []string{"configmap.yaml", "sub/serviceaccount.yaml"},
+		},
+		{
+			name: "whole fs",
+			root: ".",
+			want: []string{"testdata/embedfsreader/configmap.yaml", "testdata/embedfsreader/sub/serviceaccount.yaml"},
+		},
+		{
+			name:    "missing root",
+			root:    "testdata/missing",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewEmbedFSReader(embedFSTestdata, tt.root).AssetNames()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EmbedFSReader.AssetNames() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EmbedFSReader.AssetNames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmbedFSReader_Asset(t *testing.T) {
+	r := NewEmbedFSReader(embedFSTestdata, "testdata/embedfsreader")
+	got, err := r.Asset("sub/serviceaccount.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# Copyright Contributors to the Open Cluster Management project
+
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: {{ .Name }}
+  namespace: myns
+`
+	if string(got) != want {
+		t.Errorf("EmbedFSReader.Asset() = %s, want %s", string(got), want)
+	}
+	if _, err := r.Asset("missing.yaml"); err == nil {
+		t.Error("Expecting an error for a missing asset")
+	}
+}
+
+func TestEmbedFSReader_TemplateResourcesInPathUnstructured(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewEmbedFSReader(embedFSTestdata, "testdata/embedfsreader"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "", nil, true, struct{ Name string }{Name: "myname"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(us) != 2 {
+		t.Fatalf("Expecting 2 resources got %d", len(us))
+	}
+	for _, u := range us {
+		if u.GetName() != "myname" {
+			t.Errorf("Expecting name myname got %s", u.GetName())
+		}
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	openapiv3 "github.com/googleapis/gnostic/OpenAPIv3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+//ExportOpenAPISchemas renders the templates in path and returns, for each kind, a minimal OpenAPI v3 schema
+//generated from the fields present in the rendered resources of that kind.
+//The map is keyed by kind.
+func (tp *TemplateProcessor) ExportOpenAPISchemas(
+	ctx context.Context,
+	path string,
+	excluded []string,
+	recursive bool,
+	values interface{},
+) (map[string]*openapiv3.Schema, error) {
+	us, err := tp.TemplateResourcesInPathUnstructured(ctx, path, excluded, recursive, values)
+	if err != nil {
+		return nil, err
+	}
+	schemas := make(map[string]*openapiv3.Schema)
+	for _, u := range us {
+		schemas[u.GetKind()] = openAPISchemaFor(u.Object, schemas[u.GetKind()])
+	}
+	return schemas, nil
+}
+
+//openAPISchemaFor merges the schema of the value v into the schema s and returns it.
+//A new schema is created if s is nil.
+func openAPISchemaFor(v interface{}, s *openapiv3.Schema) *openapiv3.Schema {
+	if s == nil {
+		s = &openapiv3.Schema{}
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		s.Type = "object"
+		if s.Properties == nil {
+			s.Properties = &openapiv3.Properties{}
+		}
+		for k, e := range t {
+			found := false
+			for _, p := range s.Properties.AdditionalProperties {
+				if p.Name == k {
+					openAPISchemaFor(e, p.Value.GetSchema())
+					found = true
+					break
+				}
+			}
+			if !found {
+				s.Properties.AdditionalProperties = append(s.Properties.AdditionalProperties,
+					&openapiv3.NamedSchemaOrReference{
+						Name:  k,
+						Value: openAPISchemaOrReference(openAPISchemaFor(e, nil)),
+					})
+			}
+		}
+		sort.Slice(s.Properties.AdditionalProperties, func(i, j int) bool {
+			return s.Properties.AdditionalProperties[i].Name < s.Properties.AdditionalProperties[j].Name
+		})
+	case []interface{}:
+		s.Type = "array"
+		var items *openapiv3.Schema
+		if s.Items != nil && len(s.Items.SchemaOrReference) != 0 {
+			items = s.Items.SchemaOrReference[0].GetSchema()
+		}
+		for _, e := range t {
+			items = openAPISchemaFor(e, items)
+		}
+		if items != nil {
+			s.Items = &openapiv3.ItemsItem{
+				SchemaOrReference: []*openapiv3.SchemaOrReference{openAPISchemaOrReference(items)},
+			}
+		}
+	case string:
+		s.Type = "string"
+	case bool:
+		s.Type = "boolean"
+	case int64, int32, int:
+		if s.Type != "number" {
+			s.Type = "integer"
+		}
+	case float64, float32:
+		s.Type = "number"
+	case nil:
+		s.Nullable = true
+	}
+	return s
+}
+
+func openAPISchemaOrReference(s *openapiv3.Schema) *openapiv3.SchemaOrReference {
+	return &openapiv3.SchemaOrReference{
+		Oneof: &openapiv3.SchemaOrReference_Schema{Schema: s},
+	}
+}
+
+//ExportJSONSchemas renders the templates in path and returns the openAPIV3Schema of each rendered
+//CustomResourceDefinition as JSON Schema. The map is keyed by the GroupVersionKind string of the custom resource.
+//Both the spec.validation (apiextensions.k8s.io/v1beta1) and the per version spec.versions[].schema
+//definitions are supported, a per version schema takes precedence.
+func (tp *TemplateProcessor) ExportJSONSchemas(
+	ctx context.Context,
+	path string,
+	excluded []string,
+	recursive bool,
+	values interface{},
+) (map[string][]byte, error) {
+	us, err := tp.TemplateResourcesInPathUnstructured(ctx, path, excluded, recursive, values)
+	if err != nil {
+		return nil, err
+	}
+	schemas := make(map[string][]byte)
+	for _, u := range us {
+		if u.GetKind() != "CustomResourceDefinition" {
+			continue
+		}
+		group, _, _ := unstructured.NestedString(u.Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(u.Object, "spec", "names", "kind")
+		commonSchema, hasCommonSchema, _ := unstructured.NestedMap(u.Object, "spec", "validation", "openAPIV3Schema")
+		versionSchemas := make(map[string]map[string]interface{})
+		if version, ok, _ := unstructured.NestedString(u.Object, "spec", "version"); ok {
+			versionSchemas[version] = nil
+		}
+		versions, _, _ := unstructured.NestedSlice(u.Object, "spec", "versions")
+		for _, v := range versions {
+			version, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, _, _ := unstructured.NestedString(version, "name")
+			versionSchema, _, _ := unstructured.NestedMap(version, "schema", "openAPIV3Schema")
+			versionSchemas[name] = versionSchema
+		}
+		for version, versionSchema := range versionSchemas {
+			if versionSchema == nil {
+				if !hasCommonSchema {
+					continue
+				}
+				versionSchema = commonSchema
+			}
+			b, err := json.Marshal(versionSchema)
+			if err != nil {
+				return nil, err
+			}
+			gvk := schema.GroupVersionKind{Group: group, Version: version, Kind: kind}
+			schemas[gvk.String()] = b
+		}
+	}
+	return schemas, nil
+}
+
+//helmTemplateEscaper escapes the template delimiters present in the rendered resources
+//so helm renders them as is
+var helmTemplateEscaper = strings.NewReplacer("{{", `{{ "{{" }}`, "}}", `{{ "}}" }}`)
+
+//chartFile a file of the chart archive, the name is relative to the chart directory
+type chartFile struct {
+	name string
+	data []byte
+}
+
+//ExportAsHelmChart renders the templates in path and returns a gzip compressed tar archive (.tgz)
+//of a Helm chart containing the rendered resources in its templates directory.
+//The values used for the rendering become the default values.yaml of the chart.
+//The files modification time is the Unix epoch so the same templates and values always produce the same archive.
+func (tp *TemplateProcessor) ExportAsHelmChart(
+	ctx context.Context,
+	chartName string,
+	chartVersion string,
+	path string,
+	excluded []string,
+	recursive bool,
+	values interface{},
+) ([]byte, error) {
+	us, err := tp.TemplateResourcesInPathUnstructured(ctx, path, excluded, recursive, values)
+	if err != nil {
+		return nil, err
+	}
+	chart, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion": "v2",
+		"name":       chartName,
+		"version":    chartVersion,
+		"type":       "application",
+	})
+	if err != nil {
+		return nil, err
+	}
+	valuesYAML := []byte{}
+	if values != nil {
+		valuesYAML, err = yaml.Marshal(values)
+		if err != nil {
+			return nil, err
+		}
+	}
+	files := []chartFile{
+		{name: "Chart.yaml", data: chart},
+		{name: "values.yaml", data: valuesYAML},
+	}
+	for i, u := range us {
+		b, err := yaml.Marshal(u.Object)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, chartFile{
+			name: fmt.Sprintf("templates/%03d-%s-%s.yaml", i, strings.ToLower(u.GetKind()), u.GetName()),
+			data: []byte(helmTemplateEscaper.Replace(string(b))),
+		})
+	}
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    chartName + "/" + f.name,
+			Mode:    0644,
+			Size:    int64(len(f.data)),
+			ModTime: time.Unix(0, 0),
+		}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,198 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	openapiv3 "github.com/googleapis/gnostic/OpenAPIv3"
+)
+
+func openAPIProperty(s *openapiv3.Schema, name string) *openapiv3.Schema {
+	if s == nil || s.Properties == nil {
+		return nil
+	}
+	for _, p := range s.Properties.AdditionalProperties {
+		if p.Name == name {
+			return p.Value.GetSchema()
+		}
+	}
+	return nil
+}
+
+func TestTemplateProcessor_ExportOpenAPISchemas(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(assets))
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemas, err := tp.ExportOpenAPISchemas(context.TODO(), "test", nil, false, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schemas) != 3 {
+		t.Errorf("Expecting 3 schemas got %d", len(schemas))
+	}
+	sa, ok := schemas["ServiceAccount"]
+	if !ok {
+		t.Fatal("Schema for ServiceAccount not found")
+	}
+	if sa.Type != "object" {
+		t.Errorf("Expecting type object got %s", sa.Type)
+	}
+	secrets := openAPIProperty(sa, "secrets")
+	if secrets == nil || secrets.Type != "array" {
+		t.Fatalf("Expecting secrets of type array got %v", secrets)
+	}
+	name := openAPIProperty(secrets.Items.SchemaOrReference[0].GetSchema(), "name")
+	if name == nil || name.Type != "string" {
+		t.Errorf("Expecting secrets.name of type string got %v", name)
+	}
+	rules := openAPIProperty(schemas["ClusterRole"], "rules")
+	if rules == nil || rules.Type != "array" {
+		t.Errorf("Expecting rules of type array got %v", rules)
+	}
+}
+
+func TestTemplateProcessor_ExportJSONSchemas(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"crds/v1beta1": `
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: foos.example.com
+spec:
+  group: example.com
+  names:
+    kind: Foo
+  version: v1
+  validation:
+    openAPIV3Schema:
+      type: object
+      properties:
+        spec:
+          type: object`,
+		"crds/v1": `
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: bars.example.com
+spec:
+  group: example.com
+  names:
+    kind: Bar
+  versions:
+  - name: v1alpha1
+    schema:
+      openAPIV3Schema:
+        type: object
+  - name: v1
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object`,
+		"crds/sa": assetServiceAccount,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemas, err := tp.ExportJSONSchemas(context.TODO(), "crds", nil, false, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schemas) != 3 {
+		t.Errorf("Expecting 3 schemas got %d: %v", len(schemas), schemas)
+	}
+	for _, gvk := range []string{
+		"example.com/v1, Kind=Foo",
+		"example.com/v1, Kind=Bar",
+	} {
+		b, ok := schemas[gvk]
+		if !ok {
+			t.Errorf("Schema for %s not found", gvk)
+			continue
+		}
+		m := make(map[string]interface{})
+		if err := json.Unmarshal(b, &m); err != nil {
+			t.Error(err)
+		}
+		if _, ok := m["properties"]; !ok {
+			t.Errorf("Expecting properties in %s schema got %s", gvk, string(b))
+		}
+	}
+}
+
+func TestTemplateProcessor_ExportAsHelmChart(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/configmap": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Name }}
+  namespace: myns
+data:
+  template: '{{ "{{ .Value }}" }}'`,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]interface{}{"Name": "myconfigmap"}
+	b, err := tp.ExportAsHelmChart(context.TODO(), "mychart", "0.1.0", "test", nil, false, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	tr := tar.NewReader(gr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[h.Name] = string(data)
+	}
+	chart := make(map[string]interface{})
+	if err := yaml.Unmarshal([]byte(files["mychart/Chart.yaml"]), &chart); err != nil {
+		t.Fatal(err)
+	}
+	if chart["name"] != "mychart" || chart["version"] != "0.1.0" || chart["apiVersion"] != "v2" {
+		t.Errorf("Unexpected Chart.yaml %v", chart)
+	}
+	if files["mychart/values.yaml"] != "Name: myconfigmap\n" {
+		t.Errorf("Unexpected values.yaml %q", files["mychart/values.yaml"])
+	}
+	template, ok := files["mychart/templates/000-configmap-myconfigmap.yaml"]
+	if !ok {
+		t.Fatalf("Expecting the ConfigMap template in %v", files)
+	}
+	if !strings.Contains(template, `template: '{{ "{{" }} .Value {{ "}}" }}'`) {
+		t.Errorf("Expecting escaped template delimiters got %s", template)
+	}
+	again, err := tp.ExportAsHelmChart(context.TODO(), "mychart", "0.1.0", "test", nil, false, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, again) {
+		t.Error("Expecting the same chart archive for the same templates and values")
+	}
+}
@@ -0,0 +1,322 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+//EnableMonitoringAnnotation if set to "true" on a Service, a ServiceMonitor is generated when
+//the AutoServiceMonitor option is set
+const EnableMonitoringAnnotation = "templateprocessor.io/enable-monitoring"
+
+//ExposeViaIstioAnnotation if set to "true" on a Service, a VirtualService is generated when
+//the AutoVirtualService option is set
+const ExposeViaIstioAnnotation = "templateprocessor.io/expose-via-istio"
+
+//IstioMatchPrefixAnnotation the uri prefix routed to the Service by the generated VirtualService, default "/"
+const IstioMatchPrefixAnnotation = "templateprocessor.io/istio-match-prefix"
+
+//IstioTimeoutAnnotation the timeout of the route of the generated VirtualService (ie: "10s")
+const IstioTimeoutAnnotation = "templateprocessor.io/istio-timeout"
+
+//generateServiceMonitors returns a ServiceMonitor for each Service annotated with EnableMonitoringAnnotation
+//The ServiceMonitor selects the Service by its labels and scrapes all its ports.
+//No ServiceMonitor is generated if one with the name of the Service is already rendered.
+func (tp *TemplateProcessor) generateServiceMonitors(rs *renderState, us []*unstructured.Unstructured) []*unstructured.Unstructured {
+	results := make([]*unstructured.Unstructured, 0)
+	for _, u := range us {
+		if u.GetKind() != "Service" || u.GetAnnotations()[EnableMonitoringAnnotation] != "true" {
+			continue
+		}
+		if findResource(us, "ServiceMonitor", u.GetNamespace(), u.GetName()) != nil {
+			continue
+		}
+		if len(u.GetLabels()) == 0 {
+			rs.warn(fmt.Errorf("Service %s/%s has no labels, no ServiceMonitor generated", u.GetNamespace(), u.GetName()))
+			continue
+		}
+		endpoints := make([]interface{}, 0)
+		ports, _, _ := unstructured.NestedSlice(u.Object, "spec", "ports")
+		for _, p := range ports {
+			port, ok := p.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if name, ok := port["name"]; ok {
+				endpoints = append(endpoints, map[string]interface{}{"port": name})
+				continue
+			}
+			targetPort, ok := port["targetPort"]
+			if !ok {
+				targetPort = port["port"]
+			}
+			endpoints = append(endpoints, map[string]interface{}{"targetPort": targetPort})
+		}
+		selector := make(map[string]interface{})
+		for k, v := range u.GetLabels() {
+			selector[k] = v
+		}
+		sm := &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": "monitoring.coreos.com/v1",
+				"kind":       "ServiceMonitor",
+				"metadata": map[string]interface{}{
+					"name":      u.GetName(),
+					"namespace": u.GetNamespace(),
+				},
+				"spec": map[string]interface{}{
+					"selector": map[string]interface{}{
+						"matchLabels": selector,
+					},
+					"namespaceSelector": map[string]interface{}{
+						"matchNames": []interface{}{u.GetNamespace()},
+					},
+					"endpoints": endpoints,
+				},
+			},
+		}
+		if len(tp.options.ServiceMonitorLabels) != 0 {
+			sm.SetLabels(tp.options.ServiceMonitorLabels)
+		}
+		results = append(results, sm)
+	}
+	return results
+}
+
+//generatePodDisruptionBudgets returns a PodDisruptionBudget for each Deployment with more than one replica
+//The PodDisruptionBudget has the name and the selector of the Deployment.
+func (tp *TemplateProcessor) generatePodDisruptionBudgets(us []*unstructured.Unstructured) []*unstructured.Unstructured {
+	minAvailable := intstr.FromInt(1)
+	if tp.options.PDBMinAvailable != nil {
+		minAvailable = *tp.options.PDBMinAvailable
+	}
+	results := make([]*unstructured.Unstructured, 0)
+	for _, u := range us {
+		if u.GetKind() != "Deployment" {
+			continue
+		}
+		replicas, found, _ := unstructured.NestedInt64(u.Object, "spec", "replicas")
+		if !found || replicas <= 1 {
+			continue
+		}
+		selector, found, _ := unstructured.NestedMap(u.Object, "spec", "selector")
+		if !found {
+			continue
+		}
+		if findResource(us, "PodDisruptionBudget", u.GetNamespace(), u.GetName()) != nil {
+			continue
+		}
+		var minAvailableValue interface{} = minAvailable.StrVal
+		if minAvailable.Type == intstr.Int {
+			minAvailableValue = int64(minAvailable.IntVal)
+		}
+		results = append(results, &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": "policy/v1beta1",
+				"kind":       "PodDisruptionBudget",
+				"metadata": map[string]interface{}{
+					"name":      u.GetName(),
+					"namespace": u.GetNamespace(),
+				},
+				"spec": map[string]interface{}{
+					"minAvailable": minAvailableValue,
+					"selector":     selector,
+				},
+			},
+		})
+	}
+	return results
+}
+
+//generateVerticalPodAutoscalers returns a VerticalPodAutoscaler in Auto mode for each Deployment and StatefulSet
+//which is not the target of a VerticalPodAutoscaler
+func generateVerticalPodAutoscalers(us []*unstructured.Unstructured) []*unstructured.Unstructured {
+	targeted := make(map[string]bool)
+	for _, u := range us {
+		if u.GetKind() != "VerticalPodAutoscaler" {
+			continue
+		}
+		kind, _, _ := unstructured.NestedString(u.Object, "spec", "targetRef", "kind")
+		name, _, _ := unstructured.NestedString(u.Object, "spec", "targetRef", "name")
+		targeted[resourceKey(kind, u.GetNamespace(), name)] = true
+	}
+	results := make([]*unstructured.Unstructured, 0)
+	for _, u := range us {
+		if (u.GetKind() != "Deployment" && u.GetKind() != "StatefulSet") || targeted[unstructuredKey(u)] {
+			continue
+		}
+		results = append(results, &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": "autoscaling.k8s.io/v1",
+				"kind":       "VerticalPodAutoscaler",
+				"metadata": map[string]interface{}{
+					"name":      u.GetName(),
+					"namespace": u.GetNamespace(),
+				},
+				"spec": map[string]interface{}{
+					"targetRef": map[string]interface{}{
+						"apiVersion": u.GetAPIVersion(),
+						"kind":       u.GetKind(),
+						"name":       u.GetName(),
+					},
+					"updatePolicy": map[string]interface{}{
+						"updateMode": "Auto",
+					},
+				},
+			},
+		})
+	}
+	return results
+}
+
+//generateVirtualServices returns a VirtualService for each Service annotated with ExposeViaIstioAnnotation
+//The VirtualService routes the requests matching the IstioMatchPrefixAnnotation to the first port of the Service.
+//No VirtualService is generated if one with the name of the Service is already rendered.
+func (tp *TemplateProcessor) generateVirtualServices(rs *renderState, us []*unstructured.Unstructured) []*unstructured.Unstructured {
+	results := make([]*unstructured.Unstructured, 0)
+	for _, u := range us {
+		if u.GetKind() != "Service" || u.GetAnnotations()[ExposeViaIstioAnnotation] != "true" {
+			continue
+		}
+		if findResource(us, "VirtualService", u.GetNamespace(), u.GetName()) != nil {
+			continue
+		}
+		host := fmt.Sprintf("%s.%s.svc.cluster.local", u.GetName(), u.GetNamespace())
+		destination := map[string]interface{}{
+			"host": host,
+		}
+		ports, _, _ := unstructured.NestedSlice(u.Object, "spec", "ports")
+		if len(ports) > 0 {
+			if port, ok := ports[0].(map[string]interface{}); ok {
+				destination["port"] = map[string]interface{}{"number": port["port"]}
+			}
+		}
+		prefix := "/"
+		if p, ok := u.GetAnnotations()[IstioMatchPrefixAnnotation]; ok {
+			prefix = p
+		}
+		route := map[string]interface{}{
+			"match": []interface{}{
+				map[string]interface{}{
+					"uri": map[string]interface{}{"prefix": prefix},
+				},
+			},
+			"route": []interface{}{
+				map[string]interface{}{"destination": destination},
+			},
+		}
+		if timeout, ok := u.GetAnnotations()[IstioTimeoutAnnotation]; ok {
+			if _, err := time.ParseDuration(timeout); err != nil {
+				rs.warn(fmt.Errorf("Service %s/%s has an invalid %s annotation %q, no timeout set",
+					u.GetNamespace(), u.GetName(), IstioTimeoutAnnotation, timeout))
+			} else {
+				route["timeout"] = timeout
+			}
+		}
+		spec := map[string]interface{}{
+			"hosts": []interface{}{host},
+			"http":  []interface{}{route},
+		}
+		if tp.options.VirtualServiceGateway != "" {
+			spec["gateways"] = []interface{}{tp.options.VirtualServiceGateway}
+		}
+		results = append(results, &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": "networking.istio.io/v1alpha1",
+				"kind":       "VirtualService",
+				"metadata": map[string]interface{}{
+					"name":      u.GetName(),
+					"namespace": u.GetNamespace(),
+				},
+				"spec": spec,
+			},
+		})
+	}
+	return results
+}
+
+//generateNetworkPolicies returns a NetworkPolicy for each Deployment exposing container ports.
+//The NetworkPolicy allows the ingress on these ports from the pods matching the NetworkPolicySourceLabels.
+func (tp *TemplateProcessor) generateNetworkPolicies(us []*unstructured.Unstructured) []*unstructured.Unstructured {
+	results := make([]*unstructured.Unstructured, 0)
+	for _, u := range us {
+		if u.GetKind() != "Deployment" {
+			continue
+		}
+		spec, ok := podSpec(u)
+		if !ok {
+			continue
+		}
+		ports := make([]interface{}, 0)
+		for _, c := range podAppContainers(spec) {
+			containerPorts, _, _ := unstructured.NestedSlice(c, "ports")
+			for _, p := range containerPorts {
+				containerPort, ok := p.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				port := map[string]interface{}{"port": containerPort["containerPort"]}
+				if protocol, ok := containerPort["protocol"]; ok {
+					port["protocol"] = protocol
+				}
+				ports = append(ports, port)
+			}
+		}
+		if len(ports) == 0 {
+			continue
+		}
+		podSelector, found, _ := unstructured.NestedMap(u.Object, "spec", "selector")
+		if !found {
+			continue
+		}
+		if findResource(us, "NetworkPolicy", u.GetNamespace(), u.GetName()) != nil {
+			continue
+		}
+		sourceLabels := make(map[string]interface{})
+		for k, v := range tp.options.NetworkPolicySourceLabels {
+			sourceLabels[k] = v
+		}
+		results = append(results, &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": "networking.k8s.io/v1",
+				"kind":       "NetworkPolicy",
+				"metadata": map[string]interface{}{
+					"name":      u.GetName(),
+					"namespace": u.GetNamespace(),
+				},
+				"spec": map[string]interface{}{
+					"podSelector": podSelector,
+					"policyTypes": []interface{}{"Ingress"},
+					"ingress": []interface{}{
+						map[string]interface{}{
+							"from": []interface{}{
+								map[string]interface{}{
+									"podSelector": map[string]interface{}{
+										"matchLabels": sourceLabels,
+									},
+								},
+							},
+							"ports": ports,
+						},
+					},
+				},
+			},
+		})
+	}
+	return results
+}
+
+//findResource returns the resource of the given kind, namespace and name, nil if not found
+func findResource(us []*unstructured.Unstructured, kind, namespace, name string) *unstructured.Unstructured {
+	for _, u := range us {
+		if u.GetKind() == kind && u.GetNamespace() == namespace && u.GetName() == name {
+			return u
+		}
+	}
+	return nil
+}
@@ -0,0 +1,413 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestTemplateProcessor_generateServiceMonitors(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/monitored": `
+apiVersion: v1
+kind: Service
+metadata:
+  name: monitored
+  namespace: myns
+  labels:
+    app: myapp
+  annotations:
+    templateprocessor.io/enable-monitoring: "true"
+spec:
+  selector:
+    app: myapp
+  ports:
+  - name: metrics
+    port: 8443
+  - port: 8080
+    targetPort: 9090`,
+		"test/notmonitored": `
+apiVersion: v1
+kind: Service
+metadata:
+  name: notmonitored
+  namespace: myns
+  labels:
+    app: myapp
+spec:
+  selector:
+    app: myapp`,
+		"test/existing": `
+apiVersion: v1
+kind: Service
+metadata:
+  name: existing
+  namespace: myns
+  labels:
+    app: myapp
+  annotations:
+    templateprocessor.io/enable-monitoring: "true"
+spec:
+  selector:
+    app: myapp`,
+		"test/existingmonitor": `
+apiVersion: monitoring.coreos.com/v1
+kind: ServiceMonitor
+metadata:
+  name: existing
+  namespace: myns
+spec:
+  selector:
+    matchLabels:
+      app: myapp`,
+	}), WithOptions(&Options{
+		AutoServiceMonitor:   true,
+		ServiceMonitorLabels: map[string]string{"release": "prometheus"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(us) != 5 {
+		t.Fatalf("Expecting 5 resources got %d", len(us))
+	}
+	if existing := findResource(us, "ServiceMonitor", "myns", "existing"); len(existing.GetLabels()) != 0 {
+		t.Errorf("Expecting the rendered ServiceMonitor to be kept got %v", existing)
+	}
+	sm := findResource(us, "ServiceMonitor", "myns", "monitored")
+	if sm == nil {
+		t.Fatal("ServiceMonitor not generated")
+	}
+	if sm.GetLabels()["release"] != "prometheus" {
+		t.Errorf("Expecting label release=prometheus got %v", sm.GetLabels())
+	}
+	endpoints, _, _ := unstructured.NestedSlice(sm.Object, "spec", "endpoints")
+	want := []interface{}{
+		map[string]interface{}{"port": "metrics"},
+		map[string]interface{}{"targetPort": int64(9090)},
+	}
+	if !reflect.DeepEqual(endpoints, want) {
+		t.Errorf("Expecting endpoints %v got %v", want, endpoints)
+	}
+}
+
+func TestTemplateProcessor_generatePodDisruptionBudgets(t *testing.T) {
+	minAvailable := intstr.FromString("50%")
+	tests := []struct {
+		name             string
+		replicas         int
+		minAvailable     *intstr.IntOrString
+		wantMinAvailable interface{}
+	}{
+		{
+			name:             "default min available",
+			replicas:         2,
+			wantMinAvailable: int64(1),
+		},
+		{
+			name:             "min available percentage",
+			replicas:         3,
+			minAvailable:     &minAvailable,
+			wantMinAvailable: "50%",
+		},
+		{
+			name:     "single replica",
+			replicas: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+				"test/deployment": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: mydeployment
+  namespace: myns
+spec:
+  replicas: {{ .Replicas }}
+  selector:
+    matchLabels:
+      app: myapp`,
+			}), WithOptions(&Options{AutoPDB: true, PDBMinAvailable: tt.minAvailable}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, map[string]int{"Replicas": tt.replicas})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantMinAvailable == nil {
+				if len(us) != 1 {
+					t.Errorf("Expecting no PodDisruptionBudget got %v", us)
+				}
+				return
+			}
+			pdb := findResource(us, "PodDisruptionBudget", "myns", "mydeployment")
+			if len(us) != 2 || pdb == nil {
+				t.Fatalf("Expecting a PodDisruptionBudget got %v", us)
+			}
+			if pdb.Object["spec"].(map[string]interface{})["minAvailable"] != tt.wantMinAvailable {
+				t.Errorf("Expecting minAvailable %v got %v", tt.wantMinAvailable, pdb.Object["spec"])
+			}
+			app, _, _ := unstructured.NestedString(pdb.Object, "spec", "selector", "matchLabels", "app")
+			if app != "myapp" {
+				t.Errorf("Expecting the Deployment selector got %v", pdb.Object["spec"])
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_generateVerticalPodAutoscalers(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/deployment": assetDeployment,
+		"test/statefulset": `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: mystatefulset
+  namespace: myns`,
+		"test/vpa": `
+apiVersion: autoscaling.k8s.io/v1
+kind: VerticalPodAutoscaler
+metadata:
+  name: custom
+  namespace: myns
+spec:
+  targetRef:
+    apiVersion: apps/v1
+    kind: StatefulSet
+    name: mystatefulset
+  updatePolicy:
+    updateMode: "Off"`,
+	}), WithOptions(&Options{AutoVPA: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(us) != 4 {
+		t.Fatalf("Expecting 4 resources got %d", len(us))
+	}
+	vpa := findResource(us, "VerticalPodAutoscaler", "myns", "mydeployment")
+	if vpa == nil {
+		t.Fatal("VerticalPodAutoscaler not generated")
+	}
+	targetRef, _, _ := unstructured.NestedStringMap(vpa.Object, "spec", "targetRef")
+	want := map[string]string{"apiVersion": "apps/v1", "kind": "Deployment", "name": "mydeployment"}
+	if !reflect.DeepEqual(targetRef, want) {
+		t.Errorf("Expecting targetRef %v got %v", want, targetRef)
+	}
+	if findResource(us, "VerticalPodAutoscaler", "myns", "mystatefulset") != nil {
+		t.Error("VerticalPodAutoscaler generated for an already targeted StatefulSet")
+	}
+}
+
+func TestTemplateProcessor_generateVirtualServices(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/exposed": `
+apiVersion: v1
+kind: Service
+metadata:
+  name: exposed
+  namespace: myns
+  annotations:
+    templateprocessor.io/expose-via-istio: "true"
+    templateprocessor.io/istio-match-prefix: /api
+    templateprocessor.io/istio-timeout: 10s
+spec:
+  ports:
+  - port: 8080`,
+		"test/badtimeout": `
+apiVersion: v1
+kind: Service
+metadata:
+  name: badtimeout
+  namespace: myns
+  annotations:
+    templateprocessor.io/expose-via-istio: "true"
+    templateprocessor.io/istio-timeout: ten
+spec:
+  ports:
+  - port: 80`,
+		"test/notexposed": `
+apiVersion: v1
+kind: Service
+metadata:
+  name: notexposed
+  namespace: myns`,
+		"test/existing": `
+apiVersion: v1
+kind: Service
+metadata:
+  name: existing
+  namespace: myns
+  annotations:
+    templateprocessor.io/expose-via-istio: "true"
+spec:
+  ports:
+  - port: 80`,
+		"test/existingvirtualservice": `
+apiVersion: networking.istio.io/v1alpha1
+kind: VirtualService
+metadata:
+  name: existing
+  namespace: myns
+spec:
+  hosts:
+  - existing.example.com`,
+	}), WithOptions(&Options{
+		AutoVirtualService:    true,
+		VirtualServiceGateway: "istio-system/gateway",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(us) != 7 {
+		t.Fatalf("Expecting 7 resources got %d", len(us))
+	}
+	existing := findResource(us, "VirtualService", "myns", "existing")
+	if hosts, _, _ := unstructured.NestedStringSlice(existing.Object, "spec", "hosts"); !reflect.DeepEqual(hosts, []string{"existing.example.com"}) {
+		t.Errorf("Expecting the rendered VirtualService to be kept got %v", existing)
+	}
+	vs := findResource(us, "VirtualService", "myns", "exposed")
+	if vs == nil {
+		t.Fatal("VirtualService not generated")
+	}
+	want := map[string]interface{}{
+		"hosts":    []interface{}{"exposed.myns.svc.cluster.local"},
+		"gateways": []interface{}{"istio-system/gateway"},
+		"http": []interface{}{
+			map[string]interface{}{
+				"match": []interface{}{
+					map[string]interface{}{
+						"uri": map[string]interface{}{"prefix": "/api"},
+					},
+				},
+				"route": []interface{}{
+					map[string]interface{}{
+						"destination": map[string]interface{}{
+							"host": "exposed.myns.svc.cluster.local",
+							"port": map[string]interface{}{"number": int64(8080)},
+						},
+					},
+				},
+				"timeout": "10s",
+			},
+		},
+	}
+	if !reflect.DeepEqual(vs.Object["spec"], want) {
+		t.Errorf("Expecting spec %v got %v", want, vs.Object["spec"])
+	}
+	vs = findResource(us, "VirtualService", "myns", "badtimeout")
+	if vs == nil {
+		t.Fatal("VirtualService not generated")
+	}
+	http, _, _ := unstructured.NestedSlice(vs.Object, "spec", "http")
+	if _, ok := http[0].(map[string]interface{})["timeout"]; ok {
+		t.Error("Expecting no timeout for an invalid timeout annotation")
+	}
+	if len(tp.Warnings()) != 1 {
+		t.Errorf("Expecting 1 warning got %v", tp.Warnings())
+	}
+}
+
+func TestTemplateProcessor_generateNetworkPolicies(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/withports": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: withports
+  namespace: myns
+spec:
+  selector:
+    matchLabels:
+      app: myapp
+  template:
+    metadata:
+      labels:
+        app: myapp
+    spec:
+      containers:
+      - name: web
+        image: web
+        ports:
+        - containerPort: 8080
+        - containerPort: 9090
+          protocol: UDP`,
+		"test/withoutports": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: withoutports
+  namespace: myns
+spec:
+  selector:
+    matchLabels:
+      app: other
+  template:
+    metadata:
+      labels:
+        app: other
+    spec:
+      containers:
+      - name: worker
+        image: worker`,
+	}), WithOptions(&Options{
+		AutoNetworkPolicyFromLabels: true,
+		NetworkPolicySourceLabels:   map[string]string{"role": "frontend"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(us) != 3 {
+		t.Fatalf("Expecting 3 resources got %d", len(us))
+	}
+	np := findResource(us, "NetworkPolicy", "myns", "withports")
+	if np == nil {
+		t.Fatal("NetworkPolicy not generated")
+	}
+	want := map[string]interface{}{
+		"podSelector": map[string]interface{}{
+			"matchLabels": map[string]interface{}{"app": "myapp"},
+		},
+		"policyTypes": []interface{}{"Ingress"},
+		"ingress": []interface{}{
+			map[string]interface{}{
+				"from": []interface{}{
+					map[string]interface{}{
+						"podSelector": map[string]interface{}{
+							"matchLabels": map[string]interface{}{"role": "frontend"},
+						},
+					},
+				},
+				"ports": []interface{}{
+					map[string]interface{}{"port": int64(8080)},
+					map[string]interface{}{"port": int64(9090), "protocol": "UDP"},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(np.Object["spec"], want) {
+		t.Errorf("Expecting spec %v got %v", want, np.Object["spec"])
+	}
+}
@@ -0,0 +1,328 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/klog"
+)
+
+//DependsOnAnnotation lists the resources a resource depends on.
+//The value is a comma separated list of "Kind/Namespace/Name" or "Kind/Name" for cluster scoped resources.
+const DependsOnAnnotation = "templateprocessor.io/depends-on"
+
+//AfterAnnotation names a resource, as "Kind/Namespace/Name" or "Kind/Name" for a cluster scoped resource,
+//the annotated resource must be sorted after.
+const AfterAnnotation = "templateprocessor.io/after"
+
+//DependencyGraph is a directed graph of rendered resources built from the ownerReferences
+//and the DependsOnAnnotation annotations
+type DependencyGraph struct {
+	//Nodes the resources in the graph
+	Nodes []*unstructured.Unstructured
+	//Edges maps the key of a resource to the keys of the resources it depends on
+	Edges map[string][]string
+}
+
+//resourceKey returns the "Kind/Namespace/Name" key of a resource, the namespace is omitted when empty
+func resourceKey(kind, namespace, name string) string {
+	if namespace == "" {
+		return fmt.Sprintf("%s/%s", kind, name)
+	}
+	return fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+}
+
+func unstructuredKey(u *unstructured.Unstructured) string {
+	return resourceKey(u.GetKind(), u.GetNamespace(), u.GetName())
+}
+
+//ExportDependencyGraph renders the templates in path and returns the dependency graph of the rendered resources
+func (tp *TemplateProcessor) ExportDependencyGraph(
+	ctx context.Context,
+	path string,
+	excluded []string,
+	recursive bool,
+	values interface{},
+) (*DependencyGraph, error) {
+	us, err := tp.TemplateResourcesInPathUnstructured(ctx, path, excluded, recursive, values)
+	if err != nil {
+		return nil, err
+	}
+	return NewDependencyGraph(us), nil
+}
+
+//NewDependencyGraph builds the dependency graph of the provided resources,
+//dependencies on resources which are not part of us are ignored
+func NewDependencyGraph(us []*unstructured.Unstructured) *DependencyGraph {
+	g := &DependencyGraph{
+		Nodes: us,
+		Edges: make(map[string][]string),
+	}
+	nodes := make(map[string]bool, len(us))
+	for _, u := range us {
+		nodes[unstructuredKey(u)] = true
+	}
+	addEdge := func(u *unstructured.Unstructured, dependency string) {
+		if !nodes[dependency] {
+			klog.V(2).Infof("dependency %s of %s not found in the resources", dependency, unstructuredKey(u))
+			return
+		}
+		key := unstructuredKey(u)
+		for _, d := range g.Edges[key] {
+			if d == dependency {
+				return
+			}
+		}
+		g.Edges[key] = append(g.Edges[key], dependency)
+	}
+	for _, u := range us {
+		for _, o := range u.GetOwnerReferences() {
+			owner := resourceKey(o.Kind, u.GetNamespace(), o.Name)
+			if !nodes[owner] {
+				owner = resourceKey(o.Kind, "", o.Name)
+			}
+			addEdge(u, owner)
+		}
+		if dependsOn, ok := u.GetAnnotations()[DependsOnAnnotation]; ok {
+			for _, d := range strings.Split(dependsOn, ",") {
+				if d = strings.TrimSpace(d); d != "" {
+					addEdge(u, d)
+				}
+			}
+		}
+	}
+	return g
+}
+
+//ResourceCycleError is returned when the rendered resources reference each other in a cycle
+type ResourceCycleError struct {
+	//Cycle the keys of the resources in the cycle, the first resource is repeated at the end
+	Cycle []string
+}
+
+func (e *ResourceCycleError) Error() string {
+	return fmt.Sprintf("Resource cycle detected: %s", strings.Join(e.Cycle, " -> "))
+}
+
+//newReferenceGraph returns the dependency graph of the resources completed with the references
+//between resources: the subjects and roleRef of the role bindings, the imagePullSecrets of
+//the service accounts and the serviceAccountName and volumes of the workloads
+func newReferenceGraph(us []*unstructured.Unstructured) *DependencyGraph {
+	g := NewDependencyGraph(us)
+	nodes := make(map[string]bool, len(us))
+	for _, u := range us {
+		nodes[unstructuredKey(u)] = true
+	}
+	addEdge := func(u *unstructured.Unstructured, kind, namespace, name string) {
+		reference := resourceKey(kind, namespace, name)
+		if !nodes[reference] {
+			return
+		}
+		key := unstructuredKey(u)
+		for _, d := range g.Edges[key] {
+			if d == reference {
+				return
+			}
+		}
+		g.Edges[key] = append(g.Edges[key], reference)
+	}
+	for _, u := range us {
+		switch u.GetKind() {
+		case "RoleBinding", "ClusterRoleBinding":
+			subjects, _, _ := unstructured.NestedSlice(u.Object, "subjects")
+			for _, subject := range mapsIn(subjects) {
+				if subject["kind"] != "ServiceAccount" {
+					continue
+				}
+				name, _ := subject["name"].(string)
+				namespace, _ := subject["namespace"].(string)
+				if namespace == "" {
+					namespace = u.GetNamespace()
+				}
+				addEdge(u, "ServiceAccount", namespace, name)
+			}
+			kind, _, _ := unstructured.NestedString(u.Object, "roleRef", "kind")
+			name, _, _ := unstructured.NestedString(u.Object, "roleRef", "name")
+			if kind == "Role" {
+				addEdge(u, kind, u.GetNamespace(), name)
+			} else {
+				addEdge(u, kind, "", name)
+			}
+		case "ServiceAccount":
+			for _, ips := range mapsIn(u.Object["imagePullSecrets"]) {
+				name, _ := ips["name"].(string)
+				addEdge(u, "Secret", u.GetNamespace(), name)
+			}
+		}
+		spec, ok := podSpec(u)
+		if !ok {
+			continue
+		}
+		if name, ok := spec["serviceAccountName"].(string); ok {
+			addEdge(u, "ServiceAccount", u.GetNamespace(), name)
+		}
+		for _, v := range mapsIn(spec["volumes"]) {
+			if cm, ok := v["configMap"].(map[string]interface{}); ok {
+				name, _ := cm["name"].(string)
+				addEdge(u, "ConfigMap", u.GetNamespace(), name)
+			}
+			if secret, ok := v["secret"].(map[string]interface{}); ok {
+				name, _ := secret["secretName"].(string)
+				addEdge(u, "Secret", u.GetNamespace(), name)
+			}
+		}
+	}
+	return g
+}
+
+//FindCycle returns the keys of the resources of the first cycle found with a depth first search,
+//the first resource is repeated at the end. Nil is returned if the graph has no cycle.
+func (g *DependencyGraph) FindCycle() []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(g.Nodes))
+	path := make([]string, 0)
+	var visit func(key string) []string
+	visit = func(key string) []string {
+		state[key] = visiting
+		path = append(path, key)
+		for _, d := range g.Edges[key] {
+			switch state[d] {
+			case visiting:
+				for i, p := range path {
+					if p == d {
+						return append(append([]string{}, path[i:]...), d)
+					}
+				}
+			case unvisited:
+				if cycle := visit(d); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[key] = visited
+		return nil
+	}
+	for _, u := range g.Nodes {
+		if key := unstructuredKey(u); state[key] == unvisited {
+			if cycle := visit(key); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+//detectResourceCycles returns a ResourceCycleError if the resources reference each other in a cycle
+func detectResourceCycles(us []*unstructured.Unstructured) error {
+	if cycle := newReferenceGraph(us).FindCycle(); cycle != nil {
+		return &ResourceCycleError{Cycle: cycle}
+	}
+	return nil
+}
+
+//TopologicalOrder returns the resources sorted such that each resource comes after the resources it depends on.
+//Each step the first resource, in the nodes order, whose dependencies are sorted is appended,
+//so a resource is moved only after its dependencies and the other resources keep their relative order.
+//A DuplicateResourceError is returned if two nodes have the same key
+//and an error is returned if the graph contains a cycle.
+func (g *DependencyGraph) TopologicalOrder() ([]*unstructured.Unstructured, error) {
+	keys := make(map[string]bool, len(g.Nodes))
+	for _, u := range g.Nodes {
+		key := unstructuredKey(u)
+		if keys[key] {
+			return nil, &DuplicateResourceError{Key: key}
+		}
+		keys[key] = true
+	}
+	results := make([]*unstructured.Unstructured, 0, len(g.Nodes))
+	done := make(map[string]bool, len(g.Nodes))
+	for len(results) < len(g.Nodes) {
+		progress := false
+		for _, u := range g.Nodes {
+			key := unstructuredKey(u)
+			if done[key] {
+				continue
+			}
+			ready := true
+			for _, d := range g.Edges[key] {
+				if !done[d] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				done[key] = true
+				results = append(results, u)
+				progress = true
+				break
+			}
+		}
+		if !progress {
+			remaining := make([]string, 0)
+			for _, u := range g.Nodes {
+				if !done[unstructuredKey(u)] {
+					remaining = append(remaining, unstructuredKey(u))
+				}
+			}
+			return nil, fmt.Errorf("Dependency cycle detected between %v", remaining)
+		}
+	}
+	return results, nil
+}
+
+//orderAfterAnnotations moves the resources annotated with AfterAnnotation after the resource they name,
+//the other resources keep their relative order. A resource naming a resource not in us is not moved.
+func orderAfterAnnotations(us []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	g := &DependencyGraph{
+		Nodes: us,
+		Edges: make(map[string][]string),
+	}
+	nodes := make(map[string]bool, len(us))
+	for _, u := range us {
+		nodes[unstructuredKey(u)] = true
+	}
+	for _, u := range us {
+		after, ok := u.GetAnnotations()[AfterAnnotation]
+		if !ok {
+			continue
+		}
+		after = strings.TrimSpace(after)
+		if !nodes[after] {
+			klog.V(2).Infof("resource %s to sort %s after not found in the resources", after, unstructuredKey(u))
+			continue
+		}
+		g.Edges[unstructuredKey(u)] = append(g.Edges[unstructuredKey(u)], after)
+	}
+	if len(g.Edges) == 0 {
+		return us, nil
+	}
+	return g.TopologicalOrder()
+}
+
+//ToMermaid returns the graph as a mermaid flowchart, the arrows go from a dependency to its dependents
+func (g *DependencyGraph) ToMermaid() string {
+	var sb strings.Builder
+	sb.WriteString("graph TD\n")
+	ids := make(map[string]string, len(g.Nodes))
+	for i, u := range g.Nodes {
+		key := unstructuredKey(u)
+		ids[key] = fmt.Sprintf("n%d", i)
+		sb.WriteString(fmt.Sprintf("  %s[\"%s\"]\n", ids[key], key))
+	}
+	for _, u := range g.Nodes {
+		key := unstructuredKey(u)
+		for _, d := range g.Edges[key] {
+			sb.WriteString(fmt.Sprintf("  %s --> %s\n", ids[d], ids[key]))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,332 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var assetsDependencies = map[string]string{
+	"graph/deployment": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: mydeployment
+  namespace: myns
+  annotations:
+    templateprocessor.io/depends-on: "ServiceAccount/myns/mysa, ConfigMap/myns/mycm"`,
+	"graph/sa": `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: mysa
+  namespace: myns
+  annotations:
+    templateprocessor.io/depends-on: "Namespace/myns"`,
+	"graph/cm": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: mycm
+  namespace: myns
+  ownerReferences:
+  - apiVersion: v1
+    kind: ServiceAccount
+    name: mysa
+    uid: "1"`,
+	"graph/ns": `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: myns`,
+}
+
+func TestTemplateProcessor_ExportDependencyGraph(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(assetsDependencies), WithCreateUpdateKindsOrder(
+		[]string{"Deployment", "ConfigMap", "ServiceAccount", "Namespace"},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := tp.ExportDependencyGraph(context.TODO(), "graph", nil, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	us, err := g.TopologicalOrder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Namespace", "ServiceAccount", "ConfigMap", "Deployment"}
+	for i, u := range us {
+		if u.GetKind() != want[i] {
+			t.Errorf("Expecting %s at position %d got %s", want[i], i, u.GetKind())
+		}
+	}
+	m := g.ToMermaid()
+	if !strings.HasPrefix(m, "graph TD\n") || !strings.Contains(m, "n2 --> n1") {
+		t.Errorf("Unexpected mermaid graph:\n%s", m)
+	}
+}
+
+func TestDependencyGraph_TopologicalOrderCycle(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"graph/sa": `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: mysa
+  namespace: myns
+  annotations:
+    templateprocessor.io/depends-on: "ConfigMap/myns/mycm"`,
+		"graph/cm": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: mycm
+  namespace: myns
+  annotations:
+    templateprocessor.io/depends-on: "ServiceAccount/myns/mysa"`,
+	}), WithOptions(&Options{DetectResourceCycles: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tp.ExportDependencyGraph(context.TODO(), "graph", nil, false, nil)
+	if _, ok := err.(*ResourceCycleError); !ok {
+		t.Errorf("Expecting a ResourceCycleError got %v", err)
+	}
+	sa := newUnstructured("v1", "ServiceAccount", "myns", "mysa")
+	sa.SetAnnotations(map[string]string{DependsOnAnnotation: "ConfigMap/myns/mycm"})
+	cm := newUnstructured("v1", "ConfigMap", "myns", "mycm")
+	cm.SetAnnotations(map[string]string{DependsOnAnnotation: "ServiceAccount/myns/mysa"})
+	if _, err := NewDependencyGraph([]*unstructured.Unstructured{sa, cm}).TopologicalOrder(); err == nil {
+		t.Error("Expecting a cycle error")
+	}
+}
+
+func TestDependencyGraph_TopologicalOrderDuplicate(t *testing.T) {
+	cm := newUnstructured("v1", "ConfigMap", "myns", "mycm")
+	sa := newUnstructured("v1", "ServiceAccount", "myns", "mysa")
+	sa.SetAnnotations(map[string]string{DependsOnAnnotation: "ConfigMap/myns/mycm"})
+	_, err := NewDependencyGraph([]*unstructured.Unstructured{cm, sa, cm.DeepCopy()}).TopologicalOrder()
+	e, ok := err.(*DuplicateResourceError)
+	if !ok {
+		t.Fatalf("Expecting a DuplicateResourceError got %v", err)
+	}
+	if e.Key != "ConfigMap/myns/mycm" {
+		t.Errorf("Expecting key ConfigMap/myns/mycm got %s", e.Key)
+	}
+}
+
+func TestTemplateProcessor_detectResourceCycles(t *testing.T) {
+	assets := map[string]string{
+		"test/serviceaccount": `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: mysa
+  namespace: myns
+imagePullSecrets:
+- name: mysecret`,
+		"test/rolebinding": `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: myrb
+  namespace: myns
+subjects:
+- kind: ServiceAccount
+  name: mysa
+roleRef:
+  kind: Role
+  name: myrole`,
+		"test/secret": `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: mysecret
+  namespace: myns
+  ownerReferences:
+  - kind: RoleBinding
+    name: myrb`,
+	}
+	tests := []struct {
+		name    string
+		detect  bool
+		wantErr bool
+	}{
+		{name: "disabled", detect: false},
+		{name: "enabled", detect: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(assets), WithOptions(&Options{DetectResourceCycles: tt.detect}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TemplateResourcesInPathUnstructured() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, ok := err.(*ResourceCycleError); err != nil && !ok {
+				t.Errorf("Expecting a ResourceCycleError got %T", err)
+			}
+		})
+	}
+}
+
+func TestDependencyGraph_FindCycle(t *testing.T) {
+	sa := newUnstructured("v1", "ServiceAccount", "myns", "mysa")
+	sa.Object["imagePullSecrets"] = []interface{}{map[string]interface{}{"name": "mysecret"}}
+	rb := newUnstructured("rbac.authorization.k8s.io/v1", "RoleBinding", "myns", "myrb")
+	rb.Object["subjects"] = []interface{}{map[string]interface{}{"kind": "ServiceAccount", "name": "mysa"}}
+	rb.Object["roleRef"] = map[string]interface{}{"kind": "Role", "name": "myrole"}
+	role := newUnstructured("rbac.authorization.k8s.io/v1", "Role", "myns", "myrole")
+	secret := newUnstructured("v1", "Secret", "myns", "mysecret")
+	cyclicSecret := newUnstructured("v1", "Secret", "myns", "mysecret")
+	cyclicSecret.SetOwnerReferences([]metav1.OwnerReference{{Kind: "RoleBinding", Name: "myrb"}})
+	tests := []struct {
+		name      string
+		us        []*unstructured.Unstructured
+		wantCycle []string
+	}{
+		{
+			name: "no cycle",
+			us:   []*unstructured.Unstructured{sa, rb, role, secret},
+		},
+		{
+			name: "cycle",
+			us:   []*unstructured.Unstructured{sa, rb, role, cyclicSecret},
+			wantCycle: []string{
+				"ServiceAccount/myns/mysa",
+				"Secret/myns/mysecret",
+				"RoleBinding/myns/myrb",
+				"ServiceAccount/myns/mysa",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cycle := newReferenceGraph(tt.us).FindCycle()
+			if !reflect.DeepEqual(cycle, tt.wantCycle) {
+				t.Errorf("FindCycle() = %v, want %v", cycle, tt.wantCycle)
+			}
+			err := detectResourceCycles(tt.us)
+			if (err != nil) != (tt.wantCycle != nil) {
+				t.Errorf("detectResourceCycles() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_orderAfterAnnotationsStable(t *testing.T) {
+	nsA := newUnstructured("v1", "Namespace", "", "a")
+	nsA.SetAnnotations(map[string]string{AfterAnnotation: "Namespace/b"})
+	us := []*unstructured.Unstructured{
+		nsA,
+		newUnstructured("v1", "Namespace", "", "b"),
+		newUnstructured("v1", "ConfigMap", "a", "cm"),
+		newUnstructured("v1", "ConfigMap", "b", "cm"),
+		newUnstructured("apps/v1", "Deployment", "a", "d"),
+	}
+	sorted, err := orderAfterAnnotations(us)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]string, len(sorted))
+	for i, u := range sorted {
+		keys[i] = unstructuredKey(u)
+	}
+	want := []string{"Namespace/b", "Namespace/a", "ConfigMap/a/cm", "ConfigMap/b/cm", "Deployment/a/d"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("Expecting %v got %v", want, keys)
+	}
+}
+
+func TestTemplateProcessor_orderAfterAnnotations(t *testing.T) {
+	tests := []struct {
+		name      string
+		after     string
+		wantNames []string
+		wantErr   bool
+	}{
+		{
+			name:      "no annotation",
+			wantNames: []string{"myns", "cm1", "cm2", "cm3"},
+		},
+		{
+			name:      "after a resource of the same kind",
+			after:     "ConfigMap/myns/cm3",
+			wantNames: []string{"myns", "cm2", "cm3", "cm1"},
+		},
+		{
+			name:      "resource not found",
+			after:     "ConfigMap/myns/notfound",
+			wantNames: []string{"myns", "cm1", "cm2", "cm3"},
+		},
+		{
+			name:    "cycle",
+			after:   "ConfigMap/myns/cm2",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+				"test/namespace": `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: myns`,
+				"test/cm1": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm1
+  namespace: myns
+{{- if .After }}
+  annotations:
+    templateprocessor.io/after: {{ .After }}
+{{- end }}`,
+				"test/cm2": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm2
+  namespace: myns
+{{- if eq .After "ConfigMap/myns/cm2" }}
+  annotations:
+    templateprocessor.io/after: ConfigMap/myns/cm1
+{{- end }}`,
+				"test/cm3": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm3
+  namespace: myns`,
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, map[string]string{"After": tt.after})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TemplateResourcesInPathUnstructured() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			names := make([]string, len(us))
+			for i, u := range us {
+				names[i] = u.GetName()
+			}
+			if strings.Join(names, ",") != strings.Join(tt.wantNames, ",") {
+				t.Errorf("Expecting %v got %v", tt.wantNames, names)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/klog"
+)
+
+//httpReaderIndex the asset listing the paths of the templates served by the HTTP server
+const httpReaderIndex = "index.json"
+
+//HTTPReader defines a reader for the templates served by an HTTP server
+type HTTPReader struct {
+	baseURL *url.URL
+	client  *http.Client
+}
+
+var _ TemplateReader = &HTTPReader{}
+
+//Asset returns the body of a GET request on baseURL/name
+func (r *HTTPReader) Asset(
+	name string,
+) ([]byte, error) {
+	u := *r.baseURL
+	u.Path = path.Join("/", u.Path, name)
+	resp, err := r.client.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("GET %s: unexpected status %s", u.String(), resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+//AssetNames returns the paths listed in baseURL/index.json, a JSON array of strings
+func (r *HTTPReader) AssetNames() ([]string, error) {
+	b, err := r.Asset(httpReaderIndex)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0)
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", httpReaderIndex, err)
+	}
+	return keys, nil
+}
+
+//ToJSON converts to JSON
+func (*HTTPReader) ToJSON(
+	b []byte,
+) ([]byte, error) {
+	b, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		klog.Errorf("err:%s\nyaml:\n%s", err, string(b))
+		return nil, err
+	}
+	return b, nil
+}
+
+//NewHTTPReader constructs a new HTTPReader reading the templates from baseURL.
+//The client is used for the requests, http.DefaultClient if nil,
+//a client with a custom Transport can be provided to configure the TLS verification.
+func NewHTTPReader(baseURL string, client *http.Client) (TemplateReader, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("baseURL %s is not an absolute URL", baseURL)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPReader{
+		baseURL: u,
+		client:  client,
+	}, nil
+}
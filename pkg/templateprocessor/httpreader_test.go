@@ -0,0 +1,119 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func newTemplatesServer(files map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+}
+
+func TestNewHTTPReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		wantErr bool
+	}{
+		{name: "valid", baseURL: "https://example.com/templates"},
+		{name: "unparseable", baseURL: "http://[::1", wantErr: true},
+		{name: "relative", baseURL: "templates", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewHTTPReader(tt.baseURL, nil); (err != nil) != tt.wantErr {
+				t.Errorf("NewHTTPReader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHTTPReader(t *testing.T) {
+	server := newTemplatesServer(map[string]string{
+		"/templates/index.json": `["test/configmap.yaml", "test/sub/serviceaccount.yaml"]`,
+		"/templates/test/configmap.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Name }}
+  namespace: myns`,
+		"/templates/test/sub/serviceaccount.yaml": `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: {{ .Name }}
+  namespace: myns`,
+		"/invalid/index.json": `{"not": "an array"}`,
+	})
+	defer server.Close()
+	r, err := NewHTTPReader(server.URL+"/templates/", server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := r.AssetNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"test/configmap.yaml", "test/sub/serviceaccount.yaml"}) {
+		t.Errorf("Unexpected asset names %v", names)
+	}
+	if _, err := r.Asset("test/missing.yaml"); err == nil {
+		t.Error("Expecting an error for a missing asset")
+	}
+	tp, err := NewTemplateProcessor(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, true, struct{ Name string }{Name: "myname"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(us) != 2 {
+		t.Fatalf("Expecting 2 resources got %d", len(us))
+	}
+	for _, u := range us {
+		if u.GetName() != "myname" {
+			t.Errorf("Expecting name myname got %s", u.GetName())
+		}
+	}
+	r, err = NewHTTPReader(server.URL+"/invalid", server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.AssetNames(); err == nil {
+		t.Error("Expecting an error for an invalid index.json")
+	}
+}
+
+func TestHTTPReader_TLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`["test/configmap.yaml"]`))
+	}))
+	defer server.Close()
+	r, err := NewHTTPReader(server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.AssetNames(); err == nil {
+		t.Error("Expecting a certificate verification error with the default client")
+	}
+	r, err = NewHTTPReader(server.URL, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.AssetNames(); err != nil {
+		t.Errorf("Expecting the client trusting the server certificate to succeed, got %v", err)
+	}
+}
@@ -0,0 +1,380 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+//GeneratedAtAnnotation the annotation holding the time of the rendering, injected when
+//the InjectGenerationTimestamp option is set
+const GeneratedAtAnnotation = "templateprocessor.io/generated-at"
+
+//TemplateVersionAnnotation the annotation holding the options.TemplateVersion
+const TemplateVersionAnnotation = "templateprocessor.io/template-version"
+
+//ProbeDelayWarning is raised when an injected liveness probe doesn't start after the readiness probe of the container
+type ProbeDelayWarning struct {
+	Kind                         string
+	Namespace                    string
+	Name                         string
+	Container                    string
+	LivenessInitialDelaySeconds  int64
+	ReadinessInitialDelaySeconds int64
+}
+
+func (w *ProbeDelayWarning) Error() string {
+	return fmt.Sprintf("%s %s/%s container %s: liveness probe initialDelaySeconds %d is not greater than readiness probe initialDelaySeconds %d",
+		w.Kind, w.Namespace, w.Name, w.Container, w.LivenessInitialDelaySeconds, w.ReadinessInitialDelaySeconds)
+}
+
+//injectProbes sets the probe returned by the injector in the probeField of the containers which don't have one.
+//check is called for each container receiving the probe.
+func injectProbes(
+	us []*unstructured.Unstructured,
+	probeField string,
+	injector func(*unstructured.Unstructured) *corev1.Probe,
+	check func(u *unstructured.Unstructured, container map[string]interface{}, probe *corev1.Probe) error,
+) error {
+	if injector == nil {
+		return nil
+	}
+	for _, u := range us {
+		spec, ok := podSpec(u)
+		if !ok {
+			continue
+		}
+		probe := injector(u)
+		if probe == nil {
+			continue
+		}
+		p, err := runtime.DefaultUnstructuredConverter.ToUnstructured(probe)
+		if err != nil {
+			return err
+		}
+		for _, c := range podAppContainers(spec) {
+			if _, ok := c[probeField]; ok {
+				continue
+			}
+			c[probeField] = runtime.DeepCopyJSONValue(p)
+			if err := check(u, c, probe); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//injectLivenessProbes sets the probe returned by options.LivenessProbeInjector on the containers without liveness probe
+func (tp *TemplateProcessor) injectLivenessProbes(rs *renderState, us []*unstructured.Unstructured) error {
+	return injectProbes(us, "livenessProbe", tp.options.LivenessProbeInjector,
+		func(u *unstructured.Unstructured, c map[string]interface{}, probe *corev1.Probe) error {
+			readinessDelay, found, _ := unstructured.NestedInt64(c, "readinessProbe", "initialDelaySeconds")
+			if found && int64(probe.InitialDelaySeconds) <= readinessDelay {
+				name, _, _ := unstructured.NestedString(c, "name")
+				rs.warn(&ProbeDelayWarning{
+					Kind:                         u.GetKind(),
+					Namespace:                    u.GetNamespace(),
+					Name:                         u.GetName(),
+					Container:                    name,
+					LivenessInitialDelaySeconds:  int64(probe.InitialDelaySeconds),
+					ReadinessInitialDelaySeconds: readinessDelay,
+				})
+			}
+			return nil
+		})
+}
+
+//injectStartupProbes sets the probe returned by options.StartupProbeInjector on the containers without startup probe.
+//An error is returned if the injected probe gives up before options.MaxStartupSeconds.
+func (tp *TemplateProcessor) injectStartupProbes(us []*unstructured.Unstructured) error {
+	return injectProbes(us, "startupProbe", tp.options.StartupProbeInjector,
+		func(u *unstructured.Unstructured, c map[string]interface{}, probe *corev1.Probe) error {
+			//Kubernetes defaults
+			failureThreshold, periodSeconds := probe.FailureThreshold, probe.PeriodSeconds
+			if failureThreshold == 0 {
+				failureThreshold = 3
+			}
+			if periodSeconds == 0 {
+				periodSeconds = 10
+			}
+			if int(failureThreshold*periodSeconds) < tp.options.MaxStartupSeconds {
+				name, _, _ := unstructured.NestedString(c, "name")
+				return fmt.Errorf("%s %s/%s container %s: startup probe failureThreshold*periodSeconds %d is lower than the maximum startup time %ds",
+					u.GetKind(), u.GetNamespace(), u.GetName(), name, failureThreshold*periodSeconds, tp.options.MaxStartupSeconds)
+			}
+			return nil
+		})
+}
+
+//injectRevisionHistoryLimit sets the options.RevisionHistoryLimit on the Deployments and StatefulSets
+//without spec.revisionHistoryLimit
+func (tp *TemplateProcessor) injectRevisionHistoryLimit(us []*unstructured.Unstructured) error {
+	if tp.options.RevisionHistoryLimit == nil {
+		return nil
+	}
+	for _, u := range us {
+		if u.GetKind() != "Deployment" && u.GetKind() != "StatefulSet" {
+			continue
+		}
+		if _, found, _ := unstructured.NestedFieldNoCopy(u.Object, "spec", "revisionHistoryLimit"); found {
+			continue
+		}
+		if err := unstructured.SetNestedField(u.Object, int64(*tp.options.RevisionHistoryLimit), "spec", "revisionHistoryLimit"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//defaultAntiAffinityTopologyKey the default topology key of the injected pod anti-affinity
+const defaultAntiAffinityTopologyKey = "kubernetes.io/hostname"
+
+//injectPodAntiAffinity adds a preferred pod anti-affinity on the pod template labels to the Deployments and StatefulSets
+//without affinity, so their pods are spread across the options.AntiAffinityTopologyKey topology
+func (tp *TemplateProcessor) injectPodAntiAffinity(us []*unstructured.Unstructured) {
+	topologyKey := tp.options.AntiAffinityTopologyKey
+	if topologyKey == "" {
+		topologyKey = defaultAntiAffinityTopologyKey
+	}
+	for _, u := range us {
+		if u.GetKind() != "Deployment" && u.GetKind() != "StatefulSet" {
+			continue
+		}
+		spec, ok := podSpec(u)
+		if !ok {
+			continue
+		}
+		if _, ok := spec["affinity"]; ok {
+			continue
+		}
+		podLabels, _ := podTemplateLabels(u)
+		if len(podLabels) == 0 {
+			continue
+		}
+		matchLabels := make(map[string]interface{}, len(podLabels))
+		for k, v := range podLabels {
+			matchLabels[k] = v
+		}
+		spec["affinity"] = map[string]interface{}{
+			"podAntiAffinity": map[string]interface{}{
+				"preferredDuringSchedulingIgnoredDuringExecution": []interface{}{
+					map[string]interface{}{
+						"weight": int64(100),
+						"podAffinityTerm": map[string]interface{}{
+							"labelSelector": map[string]interface{}{
+								"matchLabels": matchLabels,
+							},
+							"topologyKey": topologyKey,
+						},
+					},
+				},
+			},
+		}
+	}
+}
+
+const (
+	//serviceAccountTokenVolumeName the name of the injected projected service account token volume
+	serviceAccountTokenVolumeName = "serviceaccount-token"
+	//serviceAccountTokenMountPath the path the service account token is mounted at by default
+	serviceAccountTokenMountPath = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+//injectServiceAccountToken adds a projected service account token volume, with the options.TokenExpirationSeconds
+//expiry, to the pod templates without one. The volume is mounted in each container at the default service account
+//path and the automount of the long-lived token is disabled, unless automountServiceAccountToken is explicitly set.
+func (tp *TemplateProcessor) injectServiceAccountToken(us []*unstructured.Unstructured) {
+	for _, u := range us {
+		spec, ok := podSpec(u)
+		if !ok || hasProjectedServiceAccountToken(spec) {
+			continue
+		}
+		token := map[string]interface{}{
+			"path": "token",
+		}
+		if tp.options.TokenExpirationSeconds != nil {
+			token["expirationSeconds"] = *tp.options.TokenExpirationSeconds
+		}
+		volumes, _ := spec["volumes"].([]interface{})
+		spec["volumes"] = append(volumes, map[string]interface{}{
+			"name": serviceAccountTokenVolumeName,
+			"projected": map[string]interface{}{
+				"sources": []interface{}{
+					map[string]interface{}{"serviceAccountToken": token},
+					map[string]interface{}{
+						"configMap": map[string]interface{}{
+							"name": "kube-root-ca.crt",
+							"items": []interface{}{
+								map[string]interface{}{"key": "ca.crt", "path": "ca.crt"},
+							},
+						},
+					},
+					map[string]interface{}{
+						"downwardAPI": map[string]interface{}{
+							"items": []interface{}{
+								map[string]interface{}{
+									"path":     "namespace",
+									"fieldRef": map[string]interface{}{"fieldPath": "metadata.namespace"},
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+		if _, ok := spec["automountServiceAccountToken"]; !ok {
+			spec["automountServiceAccountToken"] = false
+		}
+		for _, c := range podContainers(spec) {
+			mounts, _ := c["volumeMounts"].([]interface{})
+			mounted := false
+			for _, m := range mapsIn(mounts) {
+				if m["mountPath"] == serviceAccountTokenMountPath {
+					mounted = true
+					break
+				}
+			}
+			if mounted {
+				continue
+			}
+			c["volumeMounts"] = append(mounts, map[string]interface{}{
+				"name":      serviceAccountTokenVolumeName,
+				"mountPath": serviceAccountTokenMountPath,
+				"readOnly":  true,
+			})
+		}
+	}
+}
+
+//hasProjectedServiceAccountToken returns true if a volume of the pod spec projects a service account token
+func hasProjectedServiceAccountToken(spec map[string]interface{}) bool {
+	for _, v := range mapsIn(spec["volumes"]) {
+		projected, ok := v["projected"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, source := range mapsIn(projected["sources"]) {
+			if _, ok := source["serviceAccountToken"]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//injectRuntimeClassName sets the options.RuntimeClassName on the pod templates which don't specify a runtimeClassName
+func (tp *TemplateProcessor) injectRuntimeClassName(us []*unstructured.Unstructured) {
+	if tp.options.RuntimeClassName == nil {
+		return
+	}
+	for _, u := range us {
+		spec, ok := podSpec(u)
+		if !ok {
+			continue
+		}
+		if _, ok := spec["runtimeClassName"]; ok {
+			continue
+		}
+		spec["runtimeClassName"] = *tp.options.RuntimeClassName
+	}
+}
+
+//knownSecretTypes the Secret types defined by Kubernetes
+var knownSecretTypes = map[corev1.SecretType]bool{
+	corev1.SecretTypeOpaque:              true,
+	corev1.SecretTypeServiceAccountToken: true,
+	corev1.SecretTypeDockercfg:           true,
+	corev1.SecretTypeDockerConfigJson:    true,
+	corev1.SecretTypeBasicAuth:           true,
+	corev1.SecretTypeSSHAuth:             true,
+	corev1.SecretTypeTLS:                 true,
+	corev1.SecretTypeBootstrapToken:      true,
+}
+
+//injectDefaultSecretType sets the options.DefaultSecretType as type of the Secrets which don't specify a type
+func (tp *TemplateProcessor) injectDefaultSecretType(us []*unstructured.Unstructured) {
+	if tp.options.DefaultSecretType == "" {
+		return
+	}
+	for _, u := range us {
+		if u.GetKind() != "Secret" || u.GroupVersionKind().Group != "" {
+			continue
+		}
+		if t, ok := u.Object["type"]; ok && t != "" {
+			continue
+		}
+		u.Object["type"] = string(tp.options.DefaultSecretType)
+	}
+}
+
+//injectPodOverhead sets the options.PodOverhead as spec.overhead of the pod templates which don't specify an overhead
+func (tp *TemplateProcessor) injectPodOverhead(us []*unstructured.Unstructured) {
+	if tp.options.PodOverhead == nil {
+		return
+	}
+	for _, u := range us {
+		spec, ok := podSpec(u)
+		if !ok {
+			continue
+		}
+		if _, ok := spec["overhead"]; ok {
+			continue
+		}
+		overhead := make(map[string]interface{}, len(*tp.options.PodOverhead))
+		for name, quantity := range *tp.options.PodOverhead {
+			overhead[string(name)] = quantity.String()
+		}
+		spec["overhead"] = overhead
+	}
+}
+
+//injectGenerationTimestamp sets the GeneratedAtAnnotation on each resource,
+//all resources get the same timestamp formatted with the options.GenerationTimestampFormat
+func (tp *TemplateProcessor) injectGenerationTimestamp(us []*unstructured.Unstructured) {
+	format := tp.options.GenerationTimestampFormat
+	if format == "" {
+		format = time.RFC3339
+	}
+	now := time.Now().UTC().Format(format)
+	for _, u := range us {
+		annotations := u.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[GeneratedAtAnnotation] = now
+		u.SetAnnotations(annotations)
+	}
+}
+
+//injectManagedAnnotation sets the ManagedAnnotation on each resource
+func injectManagedAnnotation(us []*unstructured.Unstructured) {
+	for _, u := range us {
+		annotations := u.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[ManagedAnnotation] = "true"
+		u.SetAnnotations(annotations)
+	}
+}
+
+//injectTemplateVersion sets the options.TemplateVersion as TemplateVersionAnnotation on each resource
+func (tp *TemplateProcessor) injectTemplateVersion(us []*unstructured.Unstructured) {
+	if tp.options.TemplateVersion == "" {
+		return
+	}
+	for _, u := range us {
+		annotations := u.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[TemplateVersionAnnotation] = tp.options.TemplateVersion
+		u.SetAnnotations(annotations)
+	}
+}
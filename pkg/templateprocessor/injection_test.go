@@ -0,0 +1,643 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var assetDeployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: mydeployment
+  namespace: myns
+spec:
+  replicas: 2
+  selector:
+    matchLabels:
+      app: myapp
+  template:
+    metadata:
+      labels:
+        app: myapp
+    spec:
+      initContainers:
+      - name: init
+        image: busybox
+      containers:
+      - name: withprobes
+        image: myimage
+        readinessProbe:
+          initialDelaySeconds: 10
+          httpGet:
+            path: /ready
+            port: 8080
+        livenessProbe:
+          httpGet:
+            path: /custom
+            port: 8080
+      - name: withoutprobes
+        image: myimage
+        ports:
+        - containerPort: 8080
+          protocol: TCP
+        readinessProbe:
+          initialDelaySeconds: 10
+          httpGet:
+            path: /ready
+            port: 8080`
+
+func deploymentContainer(t *testing.T, u *unstructured.Unstructured, name string) map[string]interface{} {
+	spec, ok := podSpec(u)
+	if !ok {
+		t.Fatalf("No pod spec in %v", u)
+	}
+	for _, c := range podContainers(spec) {
+		if c["name"] == name {
+			return c
+		}
+	}
+	t.Fatalf("Container %s not found", name)
+	return nil
+}
+
+func TestTemplateProcessor_injectLivenessProbes(t *testing.T) {
+	tests := []struct {
+		name         string
+		initialDelay int32
+		wantWarnings int
+	}{
+		{
+			name:         "inject",
+			initialDelay: 30,
+			wantWarnings: 0,
+		},
+		{
+			name:         "inject with warning",
+			initialDelay: 5,
+			wantWarnings: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{"test/deployment": assetDeployment}),
+				WithOptions(&Options{
+					LivenessProbeInjector: func(u *unstructured.Unstructured) *corev1.Probe {
+						return &corev1.Probe{
+							InitialDelaySeconds: tt.initialDelay,
+							Handler: corev1.Handler{
+								Exec: &corev1.ExecAction{Command: []string{"true"}},
+							},
+						}
+					},
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path, _, _ := unstructured.NestedString(deploymentContainer(t, us[0], "withprobes"), "livenessProbe", "httpGet", "path")
+			if path != "/custom" {
+				t.Errorf("Existing liveness probe must not be replaced, got path %s", path)
+			}
+			delay, _, _ := unstructured.NestedInt64(deploymentContainer(t, us[0], "withoutprobes"), "livenessProbe", "initialDelaySeconds")
+			if delay != int64(tt.initialDelay) {
+				t.Errorf("Expecting injected initialDelaySeconds %d got %d", tt.initialDelay, delay)
+			}
+			if _, ok := deploymentContainer(t, us[0], "init")["livenessProbe"]; ok {
+				t.Error("Liveness probe must not be injected in init containers")
+			}
+			if len(tp.Warnings()) != tt.wantWarnings {
+				t.Errorf("Expecting %d warnings got %v", tt.wantWarnings, tp.Warnings())
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_injectStartupProbes(t *testing.T) {
+	tests := []struct {
+		name             string
+		failureThreshold int32
+		periodSeconds    int32
+		maxStartup       int
+		wantErr          bool
+	}{
+		{
+			name:             "inject",
+			failureThreshold: 30,
+			periodSeconds:    10,
+			maxStartup:       300,
+		},
+		{
+			name:       "inject with kubernetes defaults",
+			maxStartup: 30,
+		},
+		{
+			name:             "too short",
+			failureThreshold: 3,
+			periodSeconds:    10,
+			maxStartup:       60,
+			wantErr:          true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{"test/deployment": assetDeployment}),
+				WithOptions(&Options{
+					StartupProbeInjector: func(u *unstructured.Unstructured) *corev1.Probe {
+						return &corev1.Probe{
+							FailureThreshold: tt.failureThreshold,
+							PeriodSeconds:    tt.periodSeconds,
+							Handler: corev1.Handler{
+								Exec: &corev1.ExecAction{Command: []string{"true"}},
+							},
+						}
+					},
+					MaxStartupSeconds: tt.maxStartup,
+				}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TemplateResourcesInPathUnstructured() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			for _, name := range []string{"withprobes", "withoutprobes"} {
+				if _, ok := deploymentContainer(t, us[0], name)["startupProbe"]; !ok {
+					t.Errorf("Expecting a startup probe in container %s", name)
+				}
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_injectRevisionHistoryLimit(t *testing.T) {
+	limit := int32(3)
+	tests := []struct {
+		name      string
+		limit     *int32
+		wantLimit map[string]int64
+	}{
+		{
+			name:      "not set",
+			wantLimit: map[string]int64{"StatefulSet": 5},
+		},
+		{
+			name:      "set",
+			limit:     &limit,
+			wantLimit: map[string]int64{"Deployment": 3, "StatefulSet": 5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+				"test/deployment": assetDeployment,
+				"test/statefulset": `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: mystatefulset
+  namespace: myns
+spec:
+  revisionHistoryLimit: 5`,
+			}), WithOptions(&Options{RevisionHistoryLimit: tt.limit}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, u := range us {
+				got, found, _ := unstructured.NestedInt64(u.Object, "spec", "revisionHistoryLimit")
+				want, wantFound := tt.wantLimit[u.GetKind()]
+				if found != wantFound || got != want {
+					t.Errorf("%s: expecting revisionHistoryLimit %d got %d", u.GetKind(), want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_injectPodAntiAffinity(t *testing.T) {
+	tests := []struct {
+		name            string
+		topologyKey     string
+		wantTopologyKey string
+	}{
+		{
+			name:            "default topology key",
+			wantTopologyKey: "kubernetes.io/hostname",
+		},
+		{
+			name:            "custom topology key",
+			topologyKey:     "topology.kubernetes.io/zone",
+			wantTopologyKey: "topology.kubernetes.io/zone",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+				"test/deployment": assetDeployment,
+				"test/statefulset": `
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: mystatefulset
+  namespace: myns
+spec:
+  template:
+    metadata:
+      labels:
+        app: mystatefulset
+    spec:
+      affinity:
+        nodeAffinity: {}
+      containers:
+      - name: app
+        image: app`,
+			}), WithOptions(&Options{InjectPodAntiAffinity: true, AntiAffinityTopologyKey: tt.topologyKey}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			deployment := findResource(us, "Deployment", "myns", "mydeployment")
+			terms, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "affinity",
+				"podAntiAffinity", "preferredDuringSchedulingIgnoredDuringExecution")
+			want := []interface{}{
+				map[string]interface{}{
+					"weight": int64(100),
+					"podAffinityTerm": map[string]interface{}{
+						"labelSelector": map[string]interface{}{
+							"matchLabels": map[string]interface{}{"app": "myapp"},
+						},
+						"topologyKey": tt.wantTopologyKey,
+					},
+				},
+			}
+			if !reflect.DeepEqual(terms, want) {
+				t.Errorf("Expecting %v got %v", want, terms)
+			}
+			statefulset := findResource(us, "StatefulSet", "myns", "mystatefulset")
+			affinity, _, _ := unstructured.NestedMap(statefulset.Object, "spec", "template", "spec", "affinity")
+			if !reflect.DeepEqual(affinity, map[string]interface{}{"nodeAffinity": map[string]interface{}{}}) {
+				t.Errorf("Expecting the existing affinity unchanged got %v", affinity)
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_injectServiceAccountToken(t *testing.T) {
+	expiration := int64(600)
+	tests := []struct {
+		name           string
+		expiration     *int64
+		wantExpiration interface{}
+	}{
+		{name: "default expiration"},
+		{name: "custom expiration", expiration: &expiration, wantExpiration: int64(600)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+				"test/deployment": assetDeployment,
+				"test/automount": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: automount
+  namespace: myns
+spec:
+  template:
+    spec:
+      automountServiceAccountToken: true
+      containers:
+      - name: app
+        image: myimage`,
+				"test/pod": `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: mypod
+  namespace: myns
+spec:
+  containers:
+  - name: app
+    image: myimage
+  volumes:
+  - name: token
+    projected:
+      sources:
+      - serviceAccountToken:
+          path: token`,
+			}), WithOptions(&Options{InjectServiceAccountToken: true, TokenExpirationSeconds: tt.expiration}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, u := range us {
+				spec, _ := podSpec(u)
+				volumes := mapsIn(spec["volumes"])
+				if u.GetKind() == "Pod" {
+					if len(volumes) != 1 || spec["automountServiceAccountToken"] != nil {
+						t.Errorf("Expecting the Pod to be unchanged got %v", spec)
+					}
+					continue
+				}
+				if len(volumes) != 1 || volumes[0]["name"] != serviceAccountTokenVolumeName {
+					t.Fatalf("Expecting the %s volume got %v", serviceAccountTokenVolumeName, volumes)
+				}
+				sources := mapsIn(volumes[0]["projected"].(map[string]interface{})["sources"])
+				token := sources[0]["serviceAccountToken"].(map[string]interface{})
+				if token["expirationSeconds"] != tt.wantExpiration {
+					t.Errorf("Expecting expirationSeconds %v got %v", tt.wantExpiration, token["expirationSeconds"])
+				}
+				wantAutomount := u.GetName() == "automount"
+				if spec["automountServiceAccountToken"] != wantAutomount {
+					t.Errorf("Expecting automountServiceAccountToken %v got %v", wantAutomount, spec["automountServiceAccountToken"])
+				}
+				for _, c := range podContainers(spec) {
+					mounts := mapsIn(c["volumeMounts"])
+					if len(mounts) != 1 || mounts[0]["mountPath"] != serviceAccountTokenMountPath {
+						t.Errorf("Expecting container %s to mount the token got %v", c["name"], mounts)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_injectRuntimeClassName(t *testing.T) {
+	gvisor := "gvisor"
+	tests := []struct {
+		name             string
+		runtimeClassName *string
+		want             map[string]interface{}
+	}{
+		{
+			name: "not set",
+			want: map[string]interface{}{"Deployment": nil, "Pod": "kata"},
+		},
+		{
+			name:             "set",
+			runtimeClassName: &gvisor,
+			want:             map[string]interface{}{"Deployment": "gvisor", "Pod": "kata"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+				"test/deployment": assetDeployment,
+				"test/pod": `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: mypod
+  namespace: myns
+spec:
+  runtimeClassName: kata
+  containers:
+  - name: app
+    image: myimage`,
+			}), WithOptions(&Options{RuntimeClassName: tt.runtimeClassName}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, u := range us {
+				spec, _ := podSpec(u)
+				if spec["runtimeClassName"] != tt.want[u.GetKind()] {
+					t.Errorf("%s: expecting runtimeClassName %v got %v", u.GetKind(), tt.want[u.GetKind()], spec["runtimeClassName"])
+				}
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_injectDefaultSecretType(t *testing.T) {
+	assets := map[string]string{
+		"test/untyped": `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: untyped
+  namespace: myns`,
+		"test/typed": `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: typed
+  namespace: myns
+type: kubernetes.io/tls`,
+	}
+	tests := []struct {
+		name              string
+		defaultSecretType corev1.SecretType
+		want              map[string]interface{}
+		wantErr           bool
+	}{
+		{
+			name: "not set",
+			want: map[string]interface{}{"untyped": nil, "typed": "kubernetes.io/tls"},
+		},
+		{
+			name:              "set",
+			defaultSecretType: corev1.SecretTypeOpaque,
+			want:              map[string]interface{}{"untyped": "Opaque", "typed": "kubernetes.io/tls"},
+		},
+		{
+			name:              "unknown type",
+			defaultSecretType: "example.com/unknown",
+			wantErr:           true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(assets), WithOptions(&Options{DefaultSecretType: tt.defaultSecretType}))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewTemplateProcessor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, u := range us {
+				if u.Object["type"] != tt.want[u.GetName()] {
+					t.Errorf("%s: expecting type %v got %v", u.GetName(), tt.want[u.GetName()], u.Object["type"])
+				}
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_injectPodOverhead(t *testing.T) {
+	overhead := corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("250m"),
+		corev1.ResourceMemory: resource.MustParse("120Mi"),
+	}
+	tests := []struct {
+		name     string
+		overhead *corev1.ResourceList
+		want     map[string]interface{}
+	}{
+		{
+			name: "not set",
+			want: map[string]interface{}{
+				"Pod": map[string]interface{}{"cpu": "100m"},
+			},
+		},
+		{
+			name:     "set",
+			overhead: &overhead,
+			want: map[string]interface{}{
+				"Deployment": map[string]interface{}{"cpu": "250m", "memory": "120Mi"},
+				"Pod":        map[string]interface{}{"cpu": "100m"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+				"test/deployment": assetDeployment,
+				"test/pod": `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: mypod
+  namespace: myns
+spec:
+  overhead:
+    cpu: 100m
+  containers:
+  - name: app
+    image: myimage`,
+			}), WithOptions(&Options{PodOverhead: tt.overhead}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, u := range us {
+				spec, _ := podSpec(u)
+				want, ok := tt.want[u.GetKind()]
+				if !ok {
+					if _, found := spec["overhead"]; found {
+						t.Errorf("%s: expecting no overhead got %v", u.GetKind(), spec["overhead"])
+					}
+					continue
+				}
+				if !reflect.DeepEqual(spec["overhead"], want) {
+					t.Errorf("%s: expecting overhead %v got %v", u.GetKind(), want, spec["overhead"])
+				}
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_injectGenerationTimestamp(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		layout string
+	}{
+		{name: "default format", layout: time.RFC3339},
+		{name: "custom format", format: "2006-01-02", layout: "2006-01-02"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+				"test/deployment": assetDeployment,
+				"test/configmap": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: myconfigmap
+  namespace: myns`,
+			}), WithOptions(&Options{InjectGenerationTimestamp: true, GenerationTimestampFormat: tt.format}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			timestamp := us[0].GetAnnotations()[GeneratedAtAnnotation]
+			if _, err := time.Parse(tt.layout, timestamp); err != nil {
+				t.Errorf("Expecting a %s timestamp got %q: %s", tt.layout, timestamp, err)
+			}
+			for _, u := range us {
+				if got := u.GetAnnotations()[GeneratedAtAnnotation]; got != timestamp {
+					t.Errorf("%s: expecting timestamp %s got %s", u.GetKind(), timestamp, got)
+				}
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_injectTemplateVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+	}{
+		{name: "not set"},
+		{name: "set", version: "v1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+				"test/deployment": assetDeployment,
+				"test/configmap": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: myconfigmap
+  namespace: myns
+  annotations:
+    existing: annotation`,
+			}), WithOptions(&Options{TemplateVersion: tt.version}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, u := range us {
+				got, ok := u.GetAnnotations()[TemplateVersionAnnotation]
+				if got != tt.version || ok != (tt.version != "") {
+					t.Errorf("%s: expecting version %q got %q", u.GetKind(), tt.version, got)
+				}
+				if u.GetKind() == "ConfigMap" && u.GetAnnotations()["existing"] != "annotation" {
+					t.Errorf("Expecting the existing annotations to be kept got %v", u.GetAnnotations())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+// Copyright Contributors to the Open Cluster Management project
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package templateprocessor
+
+import (
+	"io/ioutil"
+)
+
+//mmapFile reads the file in memory as memory-mapping is not supported on this platform
+func mmapFile(path string, size int64) ([]byte, error) {
+	return ioutil.ReadFile(path)
+}
+
+//munmap is a no-op as memory-mapping is not supported on this platform
+func munmap(b []byte) error {
+	return nil
+}
@@ -0,0 +1,33 @@
+// Copyright Contributors to the Open Cluster Management project
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package templateprocessor
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+//mmapFile memory-maps read-only the file of the given size
+func mmapFile(path string, size int64) ([]byte, error) {
+	if size == 0 {
+		return []byte{}, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return unix.Mmap(int(f.Fd()), 0, int(size), unix.PROT_READ, unix.MAP_SHARED)
+}
+
+//munmap unmaps a memory-mapped file
+func munmap(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+	return unix.Munmap(b)
+}
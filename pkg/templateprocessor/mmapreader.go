@@ -0,0 +1,100 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/klog"
+)
+
+//MMapReader defines a reader which memory-maps the files of a directory instead of loading them in the heap.
+//It is useful when the directory contains large assets. The assets returned by Asset are read-only
+//and must not be used once the reader is closed.
+type MMapReader struct {
+	dir string
+	//files the memory-mapped content of the files keyed by their path relative to dir
+	files map[string][]byte
+}
+
+var _ TemplateReader = &MMapReader{}
+
+//Asset returns the memory-mapped content of an asset
+func (r *MMapReader) Asset(
+	name string,
+) ([]byte, error) {
+	b, ok := r.files[filepath.Clean(name)]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: filepath.Join(r.dir, name), Err: os.ErrNotExist}
+	}
+	return b, nil
+}
+
+//AssetNames returns the name of all assets
+func (r *MMapReader) AssetNames() ([]string, error) {
+	keys := make([]string, 0, len(r.files))
+	for k := range r.files {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+//ToJSON converts to JSON
+func (*MMapReader) ToJSON(
+	b []byte,
+) ([]byte, error) {
+	b, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		klog.Errorf("err:%s\nyaml:\n%s", err, string(b))
+		return nil, err
+	}
+	return b, nil
+}
+
+//Close unmaps all files, the assets must not be used afterwards
+func (r *MMapReader) Close() error {
+	var firstErr error
+	for k, b := range r.files {
+		if err := munmap(b); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(r.files, k)
+	}
+	return firstErr
+}
+
+//NewMMapReader constructs a new MMapReader which memory-maps, read-only, all files in dir and its sub-directories.
+//The reader must be closed to release the memory maps.
+func NewMMapReader(dir string) (*MMapReader, error) {
+	r := &MMapReader{
+		dir:   dir,
+		files: make(map[string][]byte),
+	}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		b, err := mmapFile(path, info.Size())
+		if err != nil {
+			return err
+		}
+		r.files[name] = b
+		return nil
+	})
+	if err != nil {
+		_ = r.Close()
+		return nil, err
+	}
+	return r, nil
+}
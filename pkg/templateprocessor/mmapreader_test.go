@@ -0,0 +1,79 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMMapReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mmapreader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"configmap.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Name }}
+  namespace: myns`,
+		"sub/empty.yaml": "",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := NewMMapReader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	names, err := r.AssetNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"configmap.yaml", filepath.Join("sub", "empty.yaml")}) {
+		t.Errorf("Unexpected asset names %v", names)
+	}
+	b, err := r.Asset("configmap.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != files["configmap.yaml"] {
+		t.Errorf("Expecting %s got %s", files["configmap.yaml"], string(b))
+	}
+	if _, err := r.Asset("missing.yaml"); !os.IsNotExist(err) {
+		t.Errorf("Expecting a not exist error got %v", err)
+	}
+	tp, err := NewTemplateProcessor(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "", nil, true, struct{ Name string }{Name: "myconfigmap"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(us) != 1 || us[0].GetName() != "myconfigmap" {
+		t.Errorf("Expecting the myconfigmap ConfigMap got %v", us)
+	}
+	if err := r.Close(); err != nil {
+		t.Error(err)
+	}
+	if names, _ := r.AssetNames(); len(names) != 0 {
+		t.Errorf("Expecting no asset after Close got %v", names)
+	}
+	if _, err := NewMMapReader(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expecting an error for a missing directory")
+	}
+}
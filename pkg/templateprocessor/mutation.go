@@ -0,0 +1,579 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog"
+)
+
+//injectNameAffixes adds the options.NamePrefix and options.NameSuffix to the name of each resource
+//The prefix or suffix is not added if the name already has it.
+func (tp *TemplateProcessor) injectNameAffixes(us []*unstructured.Unstructured) {
+	if tp.options.NamePrefix == "" && tp.options.NameSuffix == "" {
+		return
+	}
+	for _, u := range us {
+		name := u.GetName()
+		if !strings.HasPrefix(name, tp.options.NamePrefix) {
+			name = tp.options.NamePrefix + name
+		}
+		if !strings.HasSuffix(name, tp.options.NameSuffix) {
+			name = name + tp.options.NameSuffix
+		}
+		klog.V(5).Infof("renaming %s/%s to %s", u.GetKind(), u.GetName(), name)
+		u.SetName(name)
+	}
+}
+
+//stripNamespacePrefix removes the options.StripNamespacePrefix from the namespace of each resource
+func (tp *TemplateProcessor) stripNamespacePrefix(us []*unstructured.Unstructured) {
+	prefix := tp.options.StripNamespacePrefix
+	if prefix == "" {
+		return
+	}
+	for _, u := range us {
+		if u.GetKind() == "Namespace" && u.GetNamespace() == "" {
+			u.SetName(strings.TrimPrefix(u.GetName(), prefix))
+			continue
+		}
+		if u.GetNamespace() != "" {
+			u.SetNamespace(strings.TrimPrefix(u.GetNamespace(), prefix))
+		}
+	}
+}
+
+//resourceIdentity returns a string identifying the resource by its gvk, namespace and name
+func resourceIdentity(u *unstructured.Unstructured) string {
+	return fmt.Sprintf("%s/%s/%s", u.GroupVersionKind().String(), u.GetNamespace(), u.GetName())
+}
+
+//deduplicateResources removes the duplicate resources, only the last occurrence is kept
+func deduplicateResources(us []*unstructured.Unstructured) []*unstructured.Unstructured {
+	last := make(map[string]int, len(us))
+	for i, u := range us {
+		last[resourceIdentity(u)] = i
+	}
+	results := make([]*unstructured.Unstructured, 0, len(last))
+	for i, u := range us {
+		if last[resourceIdentity(u)] != i {
+			klog.Warningf("Duplicate resource %s removed", resourceIdentity(u))
+			continue
+		}
+		results = append(results, u)
+	}
+	return results
+}
+
+//aggregateClusterRoles sets the rules of each ClusterRole having an aggregationRule
+//to the rules of the rendered ClusterRoles matching its clusterRoleSelectors,
+//as the Kubernetes aggregation controller would do.
+func aggregateClusterRoles(us []*unstructured.Unstructured) error {
+	for _, u := range us {
+		if u.GetKind() != "ClusterRole" {
+			continue
+		}
+		selectors, found, _ := unstructured.NestedSlice(u.Object, "aggregationRule", "clusterRoleSelectors")
+		if !found {
+			continue
+		}
+		rules := make([]interface{}, 0)
+		for _, s := range selectors {
+			m, ok := s.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			labelSelector := &metav1.LabelSelector{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m, labelSelector); err != nil {
+				return fmt.Errorf("ClusterRole %s has an invalid clusterRoleSelector: %s", u.GetName(), err)
+			}
+			selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+			if err != nil {
+				return fmt.Errorf("ClusterRole %s has an invalid clusterRoleSelector: %s", u.GetName(), err)
+			}
+			for _, cr := range us {
+				if cr == u || cr.GetKind() != "ClusterRole" || !selector.Matches(labels.Set(cr.GetLabels())) {
+					continue
+				}
+				crRules, _, _ := unstructured.NestedSlice(cr.Object, "rules")
+				for _, rule := range crRules {
+					if !containsRule(rules, rule) {
+						rules = append(rules, rule)
+					}
+				}
+			}
+		}
+		klog.V(5).Infof("ClusterRole %s aggregates %d rules", u.GetName(), len(rules))
+		if err := unstructured.SetNestedSlice(u.Object, rules, "rules"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func containsRule(rules []interface{}, rule interface{}) bool {
+	for _, r := range rules {
+		if reflect.DeepEqual(r, rule) {
+			return true
+		}
+	}
+	return false
+}
+
+//versionConfigMapsAndSecrets suffixes the name of each ConfigMap and Secret with a hash of its content,
+//marks it immutable and updates the references to it in the pod specs of the workloads of the same namespace.
+func versionConfigMapsAndSecrets(us []*unstructured.Unstructured) error {
+	renamed := map[string]map[string]string{
+		"ConfigMap": make(map[string]string),
+		"Secret":    make(map[string]string),
+	}
+	for _, u := range us {
+		if u.GetKind() != "ConfigMap" && u.GetKind() != "Secret" {
+			continue
+		}
+		content := make(map[string]interface{})
+		for _, field := range []string{"data", "binaryData", "stringData", "type"} {
+			if v, ok := u.Object[field]; ok {
+				content[field] = v
+			}
+		}
+		b, err := json.Marshal(content)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(b)
+		name := fmt.Sprintf("%s-%s", u.GetName(), hex.EncodeToString(sum[:])[:10])
+		klog.V(5).Infof("versioning %s %s/%s to %s", u.GetKind(), u.GetNamespace(), u.GetName(), name)
+		renamed[u.GetKind()][u.GetNamespace()+"/"+u.GetName()] = name
+		u.SetName(name)
+		u.Object["immutable"] = true
+	}
+	for _, u := range us {
+		spec, ok := podSpec(u)
+		if !ok {
+			continue
+		}
+		rename := func(kind string, ref map[string]interface{}, field string) {
+			name, ok := ref[field].(string)
+			if !ok {
+				return
+			}
+			if newName, ok := renamed[kind][u.GetNamespace()+"/"+name]; ok {
+				ref[field] = newName
+			}
+		}
+		for _, v := range mapsIn(spec["volumes"]) {
+			if cm, ok := v["configMap"].(map[string]interface{}); ok {
+				rename("ConfigMap", cm, "name")
+			}
+			if secret, ok := v["secret"].(map[string]interface{}); ok {
+				rename("Secret", secret, "secretName")
+			}
+			projected, _ := v["projected"].(map[string]interface{})
+			for _, source := range mapsIn(projected["sources"]) {
+				if cm, ok := source["configMap"].(map[string]interface{}); ok {
+					rename("ConfigMap", cm, "name")
+				}
+				if secret, ok := source["secret"].(map[string]interface{}); ok {
+					rename("Secret", secret, "name")
+				}
+			}
+		}
+		for _, ips := range mapsIn(spec["imagePullSecrets"]) {
+			rename("Secret", ips, "name")
+		}
+		for _, c := range podContainers(spec) {
+			for _, envFrom := range mapsIn(c["envFrom"]) {
+				if cm, ok := envFrom["configMapRef"].(map[string]interface{}); ok {
+					rename("ConfigMap", cm, "name")
+				}
+				if secret, ok := envFrom["secretRef"].(map[string]interface{}); ok {
+					rename("Secret", secret, "name")
+				}
+			}
+			for _, env := range mapsIn(c["env"]) {
+				valueFrom, _ := env["valueFrom"].(map[string]interface{})
+				if cm, ok := valueFrom["configMapKeyRef"].(map[string]interface{}); ok {
+					rename("ConfigMap", cm, "name")
+				}
+				if secret, ok := valueFrom["secretKeyRef"].(map[string]interface{}); ok {
+					rename("Secret", secret, "name")
+				}
+			}
+		}
+	}
+	return nil
+}
+
+//NameNormalizedWarning is raised when names or namespaces of rendered resources are normalized to DNS-1123 labels
+type NameNormalizedWarning struct {
+	//Mappings maps the original names to the normalized names
+	Mappings map[string]string
+}
+
+func (w *NameNormalizedWarning) Error() string {
+	originals := make([]string, 0, len(w.Mappings))
+	for original := range w.Mappings {
+		originals = append(originals, original)
+	}
+	sort.Strings(originals)
+	mappings := make([]string, len(originals))
+	for i, original := range originals {
+		mappings[i] = fmt.Sprintf("%q -> %q", original, w.Mappings[original])
+	}
+	return fmt.Sprintf("Names normalized: %s", strings.Join(mappings, ", "))
+}
+
+//invalidDNS1123LabelChars matches the characters not allowed in a DNS-1123 label
+var invalidDNS1123LabelChars = regexp.MustCompile("[^a-z0-9-]")
+
+//normalizeDNS1123Label lowercases the name, replaces the invalid characters by '-',
+//truncates it to 63 characters and trims the leading and trailing '-'
+func normalizeDNS1123Label(name string) string {
+	n := invalidDNS1123LabelChars.ReplaceAllString(strings.ToLower(name), "-")
+	if len(n) > validation.DNS1123LabelMaxLength {
+		n = n[:validation.DNS1123LabelMaxLength]
+	}
+	return strings.Trim(n, "-")
+}
+
+//normalizeResourceNames normalizes the names and namespaces of the resources to DNS-1123 labels
+//and raises a NameNormalizedWarning listing the normalized names
+func (tp *TemplateProcessor) normalizeResourceNames(rs *renderState, us []*unstructured.Unstructured) {
+	mappings := make(map[string]string)
+	normalize := func(name string) string {
+		if name == "" {
+			return name
+		}
+		normalized := normalizeDNS1123Label(name)
+		if normalized != name {
+			mappings[name] = normalized
+		}
+		return normalized
+	}
+	for _, u := range us {
+		u.SetName(normalize(u.GetName()))
+		u.SetNamespace(normalize(u.GetNamespace()))
+	}
+	if len(mappings) != 0 {
+		rs.warn(&NameNormalizedWarning{Mappings: mappings})
+	}
+}
+
+//BinaryDataKeysAnnotation the comma separated list of the ConfigMap data keys to move to the binaryData
+//when Options.MoveBase64ToBinaryData is set, it overrides the detection of the binary values.
+//An empty list disables the move for the ConfigMap.
+const BinaryDataKeysAnnotation = "templateprocessor.io/binary-data-keys"
+
+//binaryDataKeys returns the keys of the data to move to the binaryData, the keys listed in the
+//BinaryDataKeysAnnotation if set, else the keys whose value is the base64 encoding of non UTF-8 bytes.
+func binaryDataKeys(u *unstructured.Unstructured, data map[string]string) ([]string, error) {
+	if keys, ok := u.GetAnnotations()[BinaryDataKeysAnnotation]; ok {
+		results := make([]string, 0)
+		for _, k := range strings.Split(keys, ",") {
+			k = strings.TrimSpace(k)
+			v, ok := data[k]
+			if !ok {
+				continue
+			}
+			if _, err := base64.StdEncoding.DecodeString(v); err != nil {
+				return nil, fmt.Errorf("ConfigMap %s/%s key %s is not base64 encoded: %v", u.GetNamespace(), u.GetName(), k, err)
+			}
+			results = append(results, k)
+		}
+		return results, nil
+	}
+	results := make([]string, 0)
+	for k, v := range data {
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err == nil && !utf8.Valid(b) {
+			results = append(results, k)
+		}
+	}
+	sort.Strings(results)
+	return results, nil
+}
+
+//moveBase64ToBinaryData moves the ConfigMap data values which are the base64 encoding of non UTF-8 bytes
+//to the binaryData of the ConfigMap. The values are kept base64 encoded as the binaryData of an unstructured
+//ConfigMap is the base64 encoding of the bytes stored by the API server.
+//As a short text such as "true" is also the base64 encoding of non UTF-8 bytes, the keys to move
+//can be listed explicitly with the BinaryDataKeysAnnotation.
+func moveBase64ToBinaryData(us []*unstructured.Unstructured) error {
+	for _, u := range us {
+		if u.GetKind() != "ConfigMap" || u.GroupVersionKind().Group != "" {
+			continue
+		}
+		data, _, err := unstructured.NestedStringMap(u.Object, "data")
+		if err != nil {
+			return err
+		}
+		keys, err := binaryDataKeys(u, data)
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		binaryData, _, err := unstructured.NestedStringMap(u.Object, "binaryData")
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			v := data[k]
+			if _, ok := binaryData[k]; ok {
+				return fmt.Errorf("ConfigMap %s/%s key %s is in both data and binaryData", u.GetNamespace(), u.GetName(), k)
+			}
+			if binaryData == nil {
+				binaryData = make(map[string]string)
+			}
+			binaryData[k] = v
+			delete(data, k)
+		}
+		if len(data) == 0 {
+			unstructured.RemoveNestedField(u.Object, "data")
+		} else if err := unstructured.SetNestedStringMap(u.Object, data, "data"); err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedStringMap(u.Object, binaryData, "binaryData"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//sanitizeLabels replaces each invalid label value by the hex encoded sha256 of the value truncated to 32 characters
+func (tp *TemplateProcessor) sanitizeLabels(rs *renderState, us []*unstructured.Unstructured) {
+	for _, u := range us {
+		labels := u.GetLabels()
+		sanitized := false
+		for k, v := range labels {
+			if errs := validation.IsValidLabelValue(v); len(errs) == 0 {
+				continue
+			}
+			sum := sha256.Sum256([]byte(v))
+			labels[k] = hex.EncodeToString(sum[:])[:32]
+			sanitized = true
+			rs.warn(fmt.Errorf("%s %s/%s label %s value %q is invalid, replaced by %s",
+				u.GetKind(), u.GetNamespace(), u.GetName(), k, v, labels[k]))
+		}
+		if sanitized {
+			u.SetLabels(labels)
+		}
+	}
+}
+
+//ResourceVersionMigration migrates the rendered resources of a GroupVersionResource to another version
+type ResourceVersionMigration struct {
+	//From the GroupVersionResource of the resources to migrate
+	From schema.GroupVersionResource
+	//To the GroupVersionResource the resources are migrated to
+	To schema.GroupVersionResource
+	//Transform if set, transforms the resource before its apiVersion is set to the To group and version
+	Transform func(*unstructured.Unstructured) (*unstructured.Unstructured, error)
+}
+
+//migrateResourceVersions applies the options.ResourceVersionMigrations to the resources
+func (tp *TemplateProcessor) migrateResourceVersions(us []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	if len(tp.options.ResourceVersionMigrations) == 0 {
+		return us, nil
+	}
+	results := make([]*unstructured.Unstructured, len(us))
+	for i, u := range us {
+		gvr := gvrFor(u.GroupVersionKind())
+		for _, m := range tp.options.ResourceVersionMigrations {
+			if gvr != m.From {
+				continue
+			}
+			if m.Transform != nil {
+				migrated, err := m.Transform(u)
+				if err != nil {
+					return nil, fmt.Errorf("%s %s/%s migration to %s failed: %s",
+						u.GetKind(), u.GetNamespace(), u.GetName(), m.To, err)
+				}
+				u = migrated
+			}
+			klog.V(5).Infof("migrating %s %s/%s to %s", u.GetKind(), u.GetNamespace(), u.GetName(), m.To.GroupVersion())
+			u.SetAPIVersion(m.To.GroupVersion().String())
+			break
+		}
+		results[i] = u
+	}
+	return results, nil
+}
+
+//preferredAPIVersions maps the deprecated group versions of a kind to its preferred apiVersion,
+//the resources whose schema differs are converted by the apiVersionConversions
+var preferredAPIVersions = map[schema.GroupVersionKind]string{
+	{Group: "extensions", Version: "v1beta1", Kind: "Ingress"}:                           "networking.k8s.io/v1",
+	{Group: "networking.k8s.io", Version: "v1beta1", Kind: "Ingress"}:                    "networking.k8s.io/v1",
+	{Group: "extensions", Version: "v1beta1", Kind: "NetworkPolicy"}:                     "networking.k8s.io/v1",
+	{Group: "extensions", Version: "v1beta1", Kind: "PodSecurityPolicy"}:                 "policy/v1beta1",
+	{Group: "rbac.authorization.k8s.io", Version: "v1beta1", Kind: "Role"}:               "rbac.authorization.k8s.io/v1",
+	{Group: "rbac.authorization.k8s.io", Version: "v1beta1", Kind: "ClusterRole"}:        "rbac.authorization.k8s.io/v1",
+	{Group: "rbac.authorization.k8s.io", Version: "v1beta1", Kind: "RoleBinding"}:        "rbac.authorization.k8s.io/v1",
+	{Group: "rbac.authorization.k8s.io", Version: "v1beta1", Kind: "ClusterRoleBinding"}: "rbac.authorization.k8s.io/v1",
+	{Group: "scheduling.k8s.io", Version: "v1beta1", Kind: "PriorityClass"}:              "scheduling.k8s.io/v1",
+	{Group: "storage.k8s.io", Version: "v1beta1", Kind: "StorageClass"}:                  "storage.k8s.io/v1",
+	{Group: "batch", Version: "v2alpha1", Kind: "CronJob"}:                               "batch/v1beta1",
+	{Group: "extensions", Version: "v1beta1", Kind: "Deployment"}:                        "apps/v1",
+	{Group: "extensions", Version: "v1beta1", Kind: "DaemonSet"}:                         "apps/v1",
+	{Group: "extensions", Version: "v1beta1", Kind: "ReplicaSet"}:                        "apps/v1",
+	{Group: "apps", Version: "v1beta1", Kind: "Deployment"}:                              "apps/v1",
+	{Group: "apps", Version: "v1beta1", Kind: "StatefulSet"}:                             "apps/v1",
+	{Group: "apps", Version: "v1beta2", Kind: "Deployment"}:                              "apps/v1",
+	{Group: "apps", Version: "v1beta2", Kind: "StatefulSet"}:                             "apps/v1",
+	{Group: "apps", Version: "v1beta2", Kind: "DaemonSet"}:                               "apps/v1",
+	{Group: "apps", Version: "v1beta2", Kind: "ReplicaSet"}:                              "apps/v1",
+}
+
+//apiVersionConversions converts the resources of the deprecated group versions whose schema differs
+//from the preferred apiVersion, an error is returned if the resource can't be converted
+var apiVersionConversions = map[schema.GroupVersionKind]func(u *unstructured.Unstructured) error{
+	{Group: "extensions", Version: "v1beta1", Kind: "Ingress"}:        convertIngressToV1,
+	{Group: "networking.k8s.io", Version: "v1beta1", Kind: "Ingress"}: convertIngressToV1,
+	{Group: "extensions", Version: "v1beta1", Kind: "Deployment"}:     defaultWorkloadSelector,
+	{Group: "extensions", Version: "v1beta1", Kind: "DaemonSet"}:      defaultWorkloadSelector,
+	{Group: "extensions", Version: "v1beta1", Kind: "ReplicaSet"}:     defaultWorkloadSelector,
+	{Group: "apps", Version: "v1beta1", Kind: "Deployment"}:           defaultWorkloadSelector,
+	{Group: "apps", Version: "v1beta1", Kind: "StatefulSet"}:          defaultWorkloadSelector,
+}
+
+//defaultWorkloadSelector sets the spec.selector.matchLabels of a workload without spec.selector
+//to the labels of its pod template, as the selector is required by apps/v1.
+//The other apps/v1 defaults, such as the updateStrategy or the revisionHistoryLimit, differ from the
+//deprecated versions defaults, the templates must set them to keep the deprecated behavior.
+func defaultWorkloadSelector(u *unstructured.Unstructured) error {
+	if _, found, _ := unstructured.NestedFieldNoCopy(u.Object, "spec", "selector"); found {
+		return nil
+	}
+	labels, _, err := unstructured.NestedStringMap(u.Object, "spec", "template", "metadata", "labels")
+	if err != nil {
+		return err
+	}
+	if len(labels) == 0 {
+		return fmt.Errorf("no spec.selector and no spec.template.metadata.labels to default it")
+	}
+	return unstructured.SetNestedStringMap(u.Object, labels, "spec", "selector", "matchLabels")
+}
+
+//convertIngressToV1 converts a v1beta1 Ingress to networking.k8s.io/v1: the spec.backend is renamed
+//spec.defaultBackend, the serviceName and servicePort of the backends become the service name and port
+//and the paths without pathType get the ImplementationSpecific pathType, the v1beta1 default
+func convertIngressToV1(u *unstructured.Unstructured) error {
+	spec, ok := u.Object["spec"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if backend, ok := spec["backend"].(map[string]interface{}); ok {
+		convertIngressBackend(backend)
+		spec["defaultBackend"] = backend
+		delete(spec, "backend")
+	}
+	for _, rule := range mapsIn(spec["rules"]) {
+		http, ok := rule["http"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, path := range mapsIn(http["paths"]) {
+			if backend, ok := path["backend"].(map[string]interface{}); ok {
+				convertIngressBackend(backend)
+			}
+			if _, ok := path["pathType"]; !ok {
+				path["pathType"] = "ImplementationSpecific"
+			}
+		}
+	}
+	return nil
+}
+
+//convertIngressBackend converts the serviceName and servicePort of a v1beta1 Ingress backend
+//to the service of a networking.k8s.io/v1 backend, a string servicePort is a port name
+func convertIngressBackend(backend map[string]interface{}) {
+	serviceName, ok := backend["serviceName"]
+	if !ok {
+		return
+	}
+	service := map[string]interface{}{"name": serviceName}
+	switch port := backend["servicePort"].(type) {
+	case nil:
+	case string:
+		service["port"] = map[string]interface{}{"name": port}
+	default:
+		service["port"] = map[string]interface{}{"number": port}
+	}
+	delete(backend, "serviceName")
+	delete(backend, "servicePort")
+	backend["service"] = service
+}
+
+//DeprecatedAPIWarning is raised when a resource uses a deprecated apiVersion
+type DeprecatedAPIWarning struct {
+	Kind       string
+	Namespace  string
+	Name       string
+	APIVersion string
+	//PreferredAPIVersion the preferred apiVersion of the kind
+	PreferredAPIVersion string
+	//Normalized true if the resource was normalized to the PreferredAPIVersion,
+	//false if the template must be migrated manually
+	Normalized bool
+	//Reason why the resource was not normalized
+	Reason string
+}
+
+func (w *DeprecatedAPIWarning) Error() string {
+	if !w.Normalized {
+		return fmt.Sprintf("%s %s/%s uses the deprecated apiVersion %s, it must be migrated manually to %s: %s",
+			w.Kind, w.Namespace, w.Name, w.APIVersion, w.PreferredAPIVersion, w.Reason)
+	}
+	return fmt.Sprintf("%s %s/%s uses the deprecated apiVersion %s, normalized to %s",
+		w.Kind, w.Namespace, w.Name, w.APIVersion, w.PreferredAPIVersion)
+}
+
+//normalizeGVK converts the resources using a deprecated apiVersion to the preferred apiVersion of their kind,
+//the resources which can't be converted are only reported
+func (tp *TemplateProcessor) normalizeGVK(rs *renderState, us []*unstructured.Unstructured) {
+	for _, u := range us {
+		preferred, ok := preferredAPIVersions[u.GroupVersionKind()]
+		if !ok {
+			continue
+		}
+		w := &DeprecatedAPIWarning{
+			Kind:                u.GetKind(),
+			Namespace:           u.GetNamespace(),
+			Name:                u.GetName(),
+			APIVersion:          u.GetAPIVersion(),
+			PreferredAPIVersion: preferred,
+			Normalized:          true,
+		}
+		if convert, ok := apiVersionConversions[u.GroupVersionKind()]; ok {
+			converted := u.DeepCopy()
+			if err := convert(converted); err != nil {
+				w.Normalized = false
+				w.Reason = err.Error()
+				rs.warn(w)
+				continue
+			}
+			u.Object = converted.Object
+		}
+		rs.warn(w)
+		u.SetAPIVersion(preferred)
+	}
+}
@@ -0,0 +1,863 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestTemplateProcessor_injectNameAffixes(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   *Options
+		values    map[string]string
+		wantNames map[string]string
+	}{
+		{
+			name:    "suffix",
+			options: &Options{NameSuffix: "-dev"},
+			values:  map[string]string{"Name": "myname"},
+			wantNames: map[string]string{
+				"ServiceAccount": "myname-dev",
+			},
+		},
+		{
+			name:    "prefix and suffix",
+			options: &Options{NamePrefix: "team-", NameSuffix: "-dev"},
+			values:  map[string]string{"Name": "myname"},
+			wantNames: map[string]string{
+				"ServiceAccount": "team-myname-dev",
+			},
+		},
+		{
+			name:    "no double suffix",
+			options: &Options{NamePrefix: "team-", NameSuffix: "-dev"},
+			values:  map[string]string{"Name": "team-myname-dev"},
+			wantNames: map[string]string{
+				"ServiceAccount": "team-myname-dev",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+				"test/sa": `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: {{ .Name }}
+  namespace: myns`,
+			}), WithOptions(tt.options))
+			if err != nil {
+				t.Fatal(err)
+			}
+			us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, tt.values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, u := range us {
+				if u.GetName() != tt.wantNames[u.GetKind()] {
+					t.Errorf("got name %s, want %s", u.GetName(), tt.wantNames[u.GetKind()])
+				}
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_stripNamespacePrefix(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/ns": `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: dev-myns`,
+		"test/sa": `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: mysa
+  namespace: dev-myns`,
+		"test/clusterrole": `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: dev-myclusterrole`,
+	}), WithOptions(&Options{StripNamespacePrefix: "dev-"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range us {
+		switch u.GetKind() {
+		case "Namespace":
+			if u.GetName() != "myns" {
+				t.Errorf("Expecting namespace name myns got %s", u.GetName())
+			}
+		case "ServiceAccount":
+			if u.GetNamespace() != "myns" {
+				t.Errorf("Expecting namespace myns got %s", u.GetNamespace())
+			}
+		case "ClusterRole":
+			if u.GetName() != "dev-myclusterrole" {
+				t.Errorf("Expecting cluster scoped name unchanged got %s", u.GetName())
+			}
+		}
+	}
+}
+
+func TestTemplateProcessor_deduplicateResources(t *testing.T) {
+	reader := NewTestReader(map[string]string{
+		"test/sa1": `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: mysa
+  namespace: myns
+secrets:
+- name: first`,
+		"test/sa2": `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: mysa
+  namespace: myns
+secrets:
+- name: last`,
+	})
+	tests := []struct {
+		name    string
+		options *Options
+		wantLen int
+	}{
+		{
+			name:    "deduplicate",
+			options: &Options{DeduplicateResources: true},
+			wantLen: 1,
+		},
+		{
+			name:    "keep duplicates",
+			options: &Options{},
+			wantLen: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(reader, WithOptions(tt.options))
+			if err != nil {
+				t.Fatal(err)
+			}
+			us, err := tp.TemplateResourcesUnstructured(context.TODO(), []string{"test/sa1", "test/sa2"}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(us) != tt.wantLen {
+				t.Fatalf("Expecting %d resources got %d", tt.wantLen, len(us))
+			}
+			if tt.wantLen == 1 {
+				secrets, _, _ := unstructured.NestedSlice(us[0].Object, "secrets")
+				if secrets[0].(map[string]interface{})["name"] != "last" {
+					t.Errorf("Expecting the last occurrence to be kept got %v", secrets)
+				}
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_aggregateClusterRoles(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/aggregated": `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: aggregated
+aggregationRule:
+  clusterRoleSelectors:
+  - matchLabels:
+      aggregate-to-monitoring: "true"
+rules: []`,
+		"test/pods": `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: pods
+  labels:
+    aggregate-to-monitoring: "true"
+rules:
+- apiGroups: [""]
+  resources: ["pods"]
+  verbs: ["get", "list"]`,
+		"test/services": `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: services
+  labels:
+    aggregate-to-monitoring: "true"
+rules:
+- apiGroups: [""]
+  resources: ["pods"]
+  verbs: ["get", "list"]
+- apiGroups: [""]
+  resources: ["services"]
+  verbs: ["get"]`,
+		"test/other": `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: other
+rules:
+- apiGroups: [""]
+  resources: ["secrets"]
+  verbs: ["get"]`,
+	}), WithOptions(&Options{AggregateClusterRoles: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aggregated := findResource(us, "ClusterRole", "", "aggregated")
+	if aggregated == nil {
+		t.Fatal("ClusterRole aggregated not found")
+	}
+	rules, _, _ := unstructured.NestedSlice(aggregated.Object, "rules")
+	want := []interface{}{
+		map[string]interface{}{
+			"apiGroups": []interface{}{""},
+			"resources": []interface{}{"pods"},
+			"verbs":     []interface{}{"get", "list"},
+		},
+		map[string]interface{}{
+			"apiGroups": []interface{}{""},
+			"resources": []interface{}{"services"},
+			"verbs":     []interface{}{"get"},
+		},
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("Expecting rules %v got %v", want, rules)
+	}
+}
+
+func TestTemplateProcessor_versionConfigMapsAndSecrets(t *testing.T) {
+	assets := map[string]string{
+		"test/configmap": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: mycm
+  namespace: myns
+data:
+  key: {{ .Value }}`,
+		"test/secret": `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: mysecret
+  namespace: myns
+stringData:
+  password: mypassword`,
+		"test/deployment": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: mydeployment
+  namespace: myns
+spec:
+  template:
+    spec:
+      volumes:
+      - name: config
+        configMap:
+          name: mycm
+      - name: credentials
+        secret:
+          secretName: mysecret
+      containers:
+      - name: app
+        image: app
+        envFrom:
+        - configMapRef:
+            name: mycm
+        env:
+        - name: PASSWORD
+          valueFrom:
+            secretKeyRef:
+              name: mysecret
+              key: password
+        - name: OTHER
+          valueFrom:
+            configMapKeyRef:
+              name: othercm
+              key: other`,
+	}
+	render := func(value string) []*unstructured.Unstructured {
+		tp, err := NewTemplateProcessor(NewTestReader(assets), WithOptions(&Options{ImmutableConfigMapVersioning: true}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, map[string]string{"Value": value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return us
+	}
+	us := render("v1")
+	var cm, secret, deployment *unstructured.Unstructured
+	for _, u := range us {
+		switch u.GetKind() {
+		case "ConfigMap":
+			cm = u
+		case "Secret":
+			secret = u
+		case "Deployment":
+			deployment = u
+		}
+	}
+	if !strings.HasPrefix(cm.GetName(), "mycm-") || len(cm.GetName()) != len("mycm-")+10 {
+		t.Errorf("Expecting a versioned ConfigMap name got %s", cm.GetName())
+	}
+	if immutable, _, _ := unstructured.NestedBool(cm.Object, "immutable"); !immutable {
+		t.Error("Expecting the ConfigMap to be immutable")
+	}
+	if !strings.HasPrefix(secret.GetName(), "mysecret-") {
+		t.Errorf("Expecting a versioned Secret name got %s", secret.GetName())
+	}
+	spec, _ := podSpec(deployment)
+	volumes := mapsIn(spec["volumes"])
+	if volumes[0]["configMap"].(map[string]interface{})["name"] != cm.GetName() ||
+		volumes[1]["secret"].(map[string]interface{})["secretName"] != secret.GetName() {
+		t.Errorf("Expecting the volumes to reference the versioned names got %v", volumes)
+	}
+	container := podContainers(spec)[0]
+	if mapsIn(container["envFrom"])[0]["configMapRef"].(map[string]interface{})["name"] != cm.GetName() {
+		t.Errorf("Expecting envFrom to reference the versioned ConfigMap got %v", container["envFrom"])
+	}
+	env := mapsIn(container["env"])
+	if name, _, _ := unstructured.NestedString(env[0], "valueFrom", "secretKeyRef", "name"); name != secret.GetName() {
+		t.Errorf("Expecting the env to reference the versioned Secret got %s", name)
+	}
+	if name, _, _ := unstructured.NestedString(env[1], "valueFrom", "configMapKeyRef", "name"); name != "othercm" {
+		t.Errorf("Expecting a not rendered ConfigMap reference to be unchanged got %s", name)
+	}
+	for _, u := range render("v1") {
+		if u.GetKind() == "ConfigMap" && u.GetName() != cm.GetName() {
+			t.Errorf("Expecting a stable name %s got %s", cm.GetName(), u.GetName())
+		}
+	}
+	for _, u := range render("v2") {
+		if u.GetKind() == "ConfigMap" && u.GetName() == cm.GetName() {
+			t.Error("Expecting a different name for a different content")
+		}
+	}
+}
+
+func TestTemplateProcessor_sanitizeLabels(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/configmap": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: mycm
+  namespace: myns
+  labels:
+    valid: my-value_1.0
+    invalid: "my value/1"`,
+	}), WithOptions(&Options{SanitizeLabels: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := us[0].GetLabels()
+	if labels["valid"] != "my-value_1.0" {
+		t.Errorf("Expecting the valid label unchanged got %s", labels["valid"])
+	}
+	if !regexp.MustCompile("^[0-9a-f]{32}$").MatchString(labels["invalid"]) {
+		t.Errorf("Expecting the invalid label to be hashed got %s", labels["invalid"])
+	}
+	if len(tp.Warnings()) != 1 {
+		t.Errorf("Expecting 1 warning got %v", tp.Warnings())
+	}
+}
+
+func TestTemplateProcessor_migrateResourceVersions(t *testing.T) {
+	from := schema.GroupVersionResource{Group: "extensions", Version: "v1beta1", Resource: "ingresses"}
+	to := schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1beta1", Resource: "ingresses"}
+	tests := []struct {
+		name           string
+		migration      ResourceVersionMigration
+		wantAPIVersion string
+		wantMigrated   bool
+		wantErr        bool
+	}{
+		{
+			name:           "without transform",
+			migration:      ResourceVersionMigration{From: from, To: to},
+			wantAPIVersion: "networking.k8s.io/v1beta1",
+		},
+		{
+			name: "with transform",
+			migration: ResourceVersionMigration{From: from, To: to,
+				Transform: func(u *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+					migrated := u.DeepCopy()
+					migrated.SetAnnotations(map[string]string{"migrated": "true"})
+					return migrated, nil
+				},
+			},
+			wantAPIVersion: "networking.k8s.io/v1beta1",
+			wantMigrated:   true,
+		},
+		{
+			name: "transform error",
+			migration: ResourceVersionMigration{From: from, To: to,
+				Transform: func(u *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+					return nil, fmt.Errorf("not supported")
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "not matching",
+			migration: ResourceVersionMigration{
+				From: schema.GroupVersionResource{Group: "extensions", Version: "v1beta1", Resource: "deployments"},
+				To:   schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+			},
+			wantAPIVersion: "extensions/v1beta1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+				"test/ingress": `
+apiVersion: extensions/v1beta1
+kind: Ingress
+metadata:
+  name: myingress
+  namespace: myns`,
+			}), WithOptions(&Options{ResourceVersionMigrations: []ResourceVersionMigration{tt.migration}}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TemplateResourcesInPathUnstructured() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if us[0].GetAPIVersion() != tt.wantAPIVersion {
+				t.Errorf("Expecting apiVersion %s got %s", tt.wantAPIVersion, us[0].GetAPIVersion())
+			}
+			if (us[0].GetAnnotations()["migrated"] == "true") != tt.wantMigrated {
+				t.Errorf("Expecting transformed %v got %v", tt.wantMigrated, us[0].GetAnnotations())
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_normalizeGVK(t *testing.T) {
+	tests := []struct {
+		name           string
+		normalize      bool
+		apiVersion     string
+		kind           string
+		spec           string
+		wantAPIVersion string
+		wantWarning    bool
+		wantSelector   map[string]string
+	}{
+		{
+			name:           "deprecated ingress",
+			normalize:      true,
+			apiVersion:     "extensions/v1beta1",
+			kind:           "Ingress",
+			wantAPIVersion: "networking.k8s.io/v1",
+			wantWarning:    true,
+		},
+		{
+			name:       "deprecated deployment",
+			normalize:  true,
+			apiVersion: "apps/v1beta1",
+			kind:       "Deployment",
+			spec: `
+spec:
+  template:
+    metadata:
+      labels:
+        app: myapp`,
+			wantAPIVersion: "apps/v1",
+			wantWarning:    true,
+			wantSelector:   map[string]string{"app": "myapp"},
+		},
+		{
+			name:       "deprecated deployment with selector",
+			normalize:  true,
+			apiVersion: "extensions/v1beta1",
+			kind:       "Deployment",
+			spec: `
+spec:
+  selector:
+    matchLabels:
+      app: myapp
+  template:
+    metadata:
+      labels:
+        app: myapp
+        version: v1`,
+			wantAPIVersion: "apps/v1",
+			wantWarning:    true,
+			wantSelector:   map[string]string{"app": "myapp"},
+		},
+		{
+			name:           "deprecated deployment without labels",
+			normalize:      true,
+			apiVersion:     "apps/v1beta1",
+			kind:           "Deployment",
+			wantAPIVersion: "apps/v1beta1",
+			wantWarning:    true,
+		},
+		{
+			name:           "preferred deployment",
+			normalize:      true,
+			apiVersion:     "apps/v1",
+			kind:           "Deployment",
+			wantAPIVersion: "apps/v1",
+		},
+		{
+			name:           "option not set",
+			apiVersion:     "apps/v1beta1",
+			kind:           "Deployment",
+			wantAPIVersion: "apps/v1beta1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+				"test/resource": fmt.Sprintf(`
+apiVersion: %s
+kind: %s
+metadata:
+  name: myresource
+  namespace: myns%s`, tt.apiVersion, tt.kind, tt.spec),
+			}), WithOptions(&Options{NormalizeGVK: tt.normalize}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if us[0].GetAPIVersion() != tt.wantAPIVersion {
+				t.Errorf("Expecting apiVersion %s got %s", tt.wantAPIVersion, us[0].GetAPIVersion())
+			}
+			if tt.wantSelector != nil {
+				selector, _, _ := unstructured.NestedStringMap(us[0].Object, "spec", "selector", "matchLabels")
+				if !reflect.DeepEqual(selector, tt.wantSelector) {
+					t.Errorf("Expecting selector %v got %v", tt.wantSelector, selector)
+				}
+			}
+			warnings := tp.Warnings()
+			if tt.wantWarning {
+				if len(warnings) != 1 {
+					t.Fatalf("Expecting 1 warning got %v", warnings)
+				}
+				w, ok := warnings[0].(*DeprecatedAPIWarning)
+				if !ok || w.APIVersion != tt.apiVersion {
+					t.Fatalf("Expecting a DeprecatedAPIWarning for %s got %v", tt.apiVersion, warnings[0])
+				}
+				if w.Normalized != (tt.wantAPIVersion != tt.apiVersion) {
+					t.Errorf("Expecting Normalized %t got %t", tt.wantAPIVersion != tt.apiVersion, w.Normalized)
+				}
+			} else if len(warnings) != 0 {
+				t.Errorf("Expecting no warning got %v", warnings)
+			}
+		})
+	}
+}
+
+func Test_convertIngressToV1(t *testing.T) {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "extensions/v1beta1",
+		"kind":       "Ingress",
+		"spec": map[string]interface{}{
+			"backend": map[string]interface{}{"serviceName": "default", "servicePort": int64(80)},
+			"rules": []interface{}{
+				map[string]interface{}{
+					"http": map[string]interface{}{
+						"paths": []interface{}{
+							map[string]interface{}{
+								"path":    "/api",
+								"backend": map[string]interface{}{"serviceName": "api", "servicePort": "http"},
+							},
+							map[string]interface{}{
+								"path":     "/",
+								"pathType": "Prefix",
+								"backend":  map[string]interface{}{"serviceName": "web", "servicePort": int64(8080)},
+							},
+						},
+					},
+				},
+			},
+		},
+	}}
+	if err := convertIngressToV1(u); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"defaultBackend": map[string]interface{}{
+			"service": map[string]interface{}{"name": "default", "port": map[string]interface{}{"number": int64(80)}},
+		},
+		"rules": []interface{}{
+			map[string]interface{}{
+				"http": map[string]interface{}{
+					"paths": []interface{}{
+						map[string]interface{}{
+							"path":     "/api",
+							"pathType": "ImplementationSpecific",
+							"backend": map[string]interface{}{
+								"service": map[string]interface{}{"name": "api", "port": map[string]interface{}{"name": "http"}},
+							},
+						},
+						map[string]interface{}{
+							"path":     "/",
+							"pathType": "Prefix",
+							"backend": map[string]interface{}{
+								"service": map[string]interface{}{"name": "web", "port": map[string]interface{}{"number": int64(8080)}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(u.Object["spec"], want) {
+		t.Errorf("Expecting spec %v got %v", want, u.Object["spec"])
+	}
+}
+
+func TestTemplateProcessor_normalizeResourceNames(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "valid", in: "my-name", want: "my-name"},
+		{name: "uppercase", in: "My-Name", want: "my-name"},
+		{name: "invalid characters", in: "my_name.v1", want: "my-name-v1"},
+		{name: "leading and trailing", in: "_my-name_", want: "my-name"},
+		{name: "too long", in: strings.Repeat("a", 70), want: strings.Repeat("a", 63)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeDNS1123Label(tt.in); got != tt.want {
+				t.Errorf("normalizeDNS1123Label() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/configmap": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: My_ConfigMap
+  namespace: My.NS`,
+		"test/clusterrole": `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: myclusterrole`,
+	}), WithOptions(&Options{NormalizeResourceNames: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if findResource(us, "ConfigMap", "my-ns", "my-configmap") == nil {
+		t.Errorf("Expecting the normalized ConfigMap my-ns/my-configmap in %v", us)
+	}
+	if findResource(us, "ClusterRole", "", "myclusterrole") == nil {
+		t.Errorf("Expecting the ClusterRole myclusterrole unchanged in %v", us)
+	}
+	if len(tp.Warnings()) != 1 {
+		t.Fatalf("Expecting 1 warning got %v", tp.Warnings())
+	}
+	w, ok := tp.Warnings()[0].(*NameNormalizedWarning)
+	if !ok {
+		t.Fatalf("Expecting a NameNormalizedWarning got %T", tp.Warnings()[0])
+	}
+	if !reflect.DeepEqual(w.Mappings, map[string]string{"My_ConfigMap": "my-configmap", "My.NS": "my-ns"}) {
+		t.Errorf("Unexpected mappings %v", w.Mappings)
+	}
+}
+
+func TestTemplateProcessor_moveBase64ToBinaryData(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/mixed": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: mixed
+  namespace: myns
+  annotations:
+    templateprocessor.io/binary-data-keys: binary, missing
+data:
+  text: hello
+  flag: "true"
+  base64text: aGVsbG8=
+  binary: //4AAQ==`,
+		"test/binary": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: binary
+  namespace: myns
+  annotations:
+    templateprocessor.io/binary-data-keys: binary
+data:
+  binary: //4AAQ==
+binaryData:
+  other: //4=`,
+		"test/detected": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: detected
+  namespace: myns
+data:
+  text: hello
+  base64text: aGVsbG8=
+  png: iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mP8z8BQDwAEhQGAhKmMIQAAAABJRU5ErkJggg==`,
+		"test/disabled": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: disabled
+  namespace: myns
+  annotations:
+    templateprocessor.io/binary-data-keys: ""
+data:
+  flag: "true"
+  binary: //4AAQ==`,
+		"test/secret": `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: secret
+  namespace: myns
+data:
+  binary: //4AAQ==`,
+	}), WithOptions(&Options{MoveBase64ToBinaryData: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		kind           string
+		name           string
+		wantData       map[string]string
+		wantBinaryData map[string]string
+	}{
+		{
+			kind:           "ConfigMap",
+			name:           "mixed",
+			wantData:       map[string]string{"text": "hello", "flag": "true", "base64text": "aGVsbG8="},
+			wantBinaryData: map[string]string{"binary": "//4AAQ=="},
+		},
+		{
+			kind:           "ConfigMap",
+			name:           "binary",
+			wantBinaryData: map[string]string{"binary": "//4AAQ==", "other": "//4="},
+		},
+		{
+			kind:     "ConfigMap",
+			name:     "detected",
+			wantData: map[string]string{"text": "hello", "base64text": "aGVsbG8="},
+			wantBinaryData: map[string]string{
+				"png": "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mP8z8BQDwAEhQGAhKmMIQAAAABJRU5ErkJggg==",
+			},
+		},
+		{
+			kind:     "ConfigMap",
+			name:     "disabled",
+			wantData: map[string]string{"flag": "true", "binary": "//4AAQ=="},
+		},
+		{
+			kind:     "Secret",
+			name:     "secret",
+			wantData: map[string]string{"binary": "//4AAQ=="},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := findResource(us, tt.kind, "myns", tt.name)
+			if u == nil {
+				t.Fatalf("%s %s not found", tt.kind, tt.name)
+			}
+			data, _, _ := unstructured.NestedStringMap(u.Object, "data")
+			if !reflect.DeepEqual(data, tt.wantData) {
+				t.Errorf("data = %v, want %v", data, tt.wantData)
+			}
+			binaryData, _, _ := unstructured.NestedStringMap(u.Object, "binaryData")
+			if !reflect.DeepEqual(binaryData, tt.wantBinaryData) {
+				t.Errorf("binaryData = %v, want %v", binaryData, tt.wantBinaryData)
+			}
+		})
+	}
+	tp, err = NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/conflict": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: conflict
+  namespace: myns
+  annotations:
+    templateprocessor.io/binary-data-keys: binary
+data:
+  binary: //4AAQ==
+binaryData:
+  binary: //4=`,
+	}), WithOptions(&Options{MoveBase64ToBinaryData: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil); err == nil {
+		t.Error("Expecting an error for a key in both data and binaryData")
+	}
+	tp, err = NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/invalid": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: invalid
+  namespace: myns
+  annotations:
+    templateprocessor.io/binary-data-keys: text
+data:
+  text: not base64`,
+	}), WithOptions(&Options{MoveBase64ToBinaryData: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil); err == nil {
+		t.Error("Expecting an error for a listed key which is not base64 encoded")
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+//postRender applies the transformations and validations requested in the options
+//on the rendered resources, before they get sorted. The ctx is used for the requests to the cluster.
+func (tp *TemplateProcessor) postRender(
+	ctx context.Context,
+	rs *renderState,
+	us []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	us, err := tp.migrateResourceVersions(us)
+	if err != nil {
+		return nil, err
+	}
+	if tp.options.NormalizeGVK {
+		tp.normalizeGVK(rs, us)
+	}
+	tp.injectNameAffixes(us)
+	tp.stripNamespacePrefix(us)
+	if tp.options.NormalizeResourceNames {
+		tp.normalizeResourceNames(rs, us)
+	}
+	if tp.options.SanitizeLabels {
+		tp.sanitizeLabels(rs, us)
+	}
+	if tp.options.MoveBase64ToBinaryData {
+		if err := moveBase64ToBinaryData(us); err != nil {
+			return nil, err
+		}
+	}
+	if tp.options.ImmutableConfigMapVersioning {
+		if err := versionConfigMapsAndSecrets(us); err != nil {
+			return nil, err
+		}
+	}
+	if tp.options.AutoServiceMonitor {
+		us = append(us, tp.generateServiceMonitors(rs, us)...)
+	}
+	if tp.options.AutoPDB {
+		us = append(us, tp.generatePodDisruptionBudgets(us)...)
+	}
+	if tp.options.AutoVPA {
+		us = append(us, generateVerticalPodAutoscalers(us)...)
+	}
+	if tp.options.AutoVirtualService {
+		us = append(us, tp.generateVirtualServices(rs, us)...)
+	}
+	if tp.options.AutoNetworkPolicyFromLabels {
+		us = append(us, tp.generateNetworkPolicies(us)...)
+	}
+	if tp.options.DeduplicateResources {
+		us = deduplicateResources(us)
+	}
+	if tp.options.AggregateClusterRoles {
+		if err := aggregateClusterRoles(us); err != nil {
+			return nil, err
+		}
+	}
+	if err := tp.checkClusterResourceCount(ctx, us); err != nil {
+		return nil, err
+	}
+	us, err = tp.skipLockedResources(ctx, rs, us)
+	if err != nil {
+		return nil, err
+	}
+	if err := tp.checkResourceAge(ctx, rs, us); err != nil {
+		return nil, err
+	}
+	if tp.options.ValidateCronSchedules {
+		if err := validateCronSchedules(us); err != nil {
+			return nil, err
+		}
+	}
+	if tp.options.ValidateCronJobNextRun {
+		tp.validateCronJobNextRun(rs, us)
+	}
+	if err := tp.injectLivenessProbes(rs, us); err != nil {
+		return nil, err
+	}
+	if err := tp.injectStartupProbes(us); err != nil {
+		return nil, err
+	}
+	if err := tp.injectRevisionHistoryLimit(us); err != nil {
+		return nil, err
+	}
+	if tp.options.InjectServiceAccountToken {
+		tp.injectServiceAccountToken(us)
+	}
+	tp.injectRuntimeClassName(us)
+	tp.injectPodOverhead(us)
+	tp.injectDefaultSecretType(us)
+	if tp.options.InjectPodAntiAffinity {
+		tp.injectPodAntiAffinity(us)
+	}
+	if tp.options.InjectGenerationTimestamp {
+		tp.injectGenerationTimestamp(us)
+	}
+	tp.injectTemplateVersion(us)
+	if tp.options.InjectManagedAnnotation {
+		injectManagedAnnotation(us)
+	}
+	if tp.options.ValidateImageFormat {
+		if err := validateImageFormat(us); err != nil {
+			return nil, err
+		}
+	}
+	if tp.options.ValidatePrometheusRules {
+		if err := validatePrometheusRules(us); err != nil {
+			return nil, err
+		}
+	}
+	if tp.options.ValidateHPATargets {
+		if err := validateHPATargets(us); err != nil {
+			return nil, err
+		}
+	}
+	if tp.options.ValidateIngressTLS {
+		if err := tp.validateIngressTLS(ctx, us); err != nil {
+			return nil, err
+		}
+	}
+	if tp.options.ValidatePriorityClasses {
+		if err := tp.validatePriorityClasses(ctx, us); err != nil {
+			return nil, err
+		}
+	}
+	if tp.options.ValidateCrossReferences {
+		if err := validateCrossReferences(us); err != nil {
+			return nil, err
+		}
+	}
+	if tp.options.DetectResourceCycles {
+		if err := detectResourceCycles(us); err != nil {
+			return nil, err
+		}
+	}
+	if tp.options.ValidatePDBCoverage {
+		if err := tp.validatePDBCoverage(rs, us); err != nil {
+			return nil, err
+		}
+	}
+	if err := tp.validateCEL(us); err != nil {
+		return nil, err
+	}
+	if tp.options.AnalyzeRBAC {
+		tp.analyzeRBAC(rs, us)
+	}
+	if tp.options.ValidateServiceSelectors {
+		tp.validateServiceSelectors(rs, us)
+	}
+	if err := tp.validateResourceNameLength(us); err != nil {
+		return nil, err
+	}
+	if err := tp.validateAnnotationsSize(us); err != nil {
+		return nil, err
+	}
+	if err := tp.validateConfigMapDataSize(us); err != nil {
+		return nil, err
+	}
+	if err := tp.validateResourcesPerNamespace(us); err != nil {
+		return nil, err
+	}
+	return us, nil
+}
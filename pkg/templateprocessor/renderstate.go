@@ -0,0 +1,56 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+	"sync"
+
+	"k8s.io/klog"
+)
+
+//renderState holds the warnings and the caches of a rendering,
+//it is shared by the templates rendered concurrently during the rendering
+type renderState struct {
+	mutex sync.Mutex
+	//warnings raised during the rendering
+	warnings []error
+	//selectorCache the results of kubeResourceBySelector during the rendering
+	selectorCache map[string][]map[string]interface{}
+	//httpGetCache the responses of httpGet during the rendering
+	httpGetCache map[string]string
+}
+
+//renderStateKey the context key of the renderState of the rendering
+type renderStateKey struct{}
+
+func newRenderState() *renderState {
+	return &renderState{
+		selectorCache: make(map[string][]map[string]interface{}),
+		httpGetCache:  make(map[string]string),
+	}
+}
+
+//withRenderState returns ctx and its renderState, a new renderState is added to ctx if it doesn't have one
+func withRenderState(ctx context.Context) (context.Context, *renderState) {
+	if rs, ok := ctx.Value(renderStateKey{}).(*renderState); ok {
+		return ctx, rs
+	}
+	rs := newRenderState()
+	return context.WithValue(ctx, renderStateKey{}, rs), rs
+}
+
+//warn logs and records a warning
+func (rs *renderState) warn(w error) {
+	klog.Warning(w)
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	rs.warnings = append(rs.warnings, w)
+}
+
+//getWarnings returns a copy of the warnings raised during the rendering
+func (rs *renderState) getWarnings() []error {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	return append([]error(nil), rs.warnings...)
+}
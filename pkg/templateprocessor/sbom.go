@@ -0,0 +1,181 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"github.com/spdx/tools-golang/spdx"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+//TemplateSourceAnnotation the SPDX annotation prefix recording the template which references an image
+const TemplateSourceAnnotation = "templateprocessor.io/template-source"
+
+const (
+	sbomDocumentID        = "DOCUMENT"
+	sbomTool              = "templateprocessor"
+	sbomNoAssertion       = "NOASSERTION"
+	sbomNamespacePrefix   = "https://open-cluster-management.io/spdxdocs/"
+	sbomPackageIDPrefix   = "Package-"
+	sbomCreatedTimeFormat = "2006-01-02T15:04:05Z"
+)
+
+//imageSource a resource referencing an image and the template which rendered it
+type imageSource struct {
+	templateName string
+	kind         string
+	namespace    string
+	name         string
+}
+
+func (s imageSource) String() string {
+	return fmt.Sprintf("%s=%s (%s %s/%s)", TemplateSourceAnnotation, s.templateName, s.kind, s.namespace, s.name)
+}
+
+//GenerateSBOM renders all assets in a path and returns an SPDX 2.2 Software Bill of Materials
+//listing each container image referenced by the workloads as a package.
+//Each package is annotated with the TemplateSourceAnnotation of the templates referencing the image.
+func (tp *TemplateProcessor) GenerateSBOM(
+	ctx context.Context,
+	path string,
+	excluded []string,
+	recursive bool,
+	values interface{}) (*spdx.Document2_2, error) {
+	templateNames, err := tp.AssetNamesInPath(path, excluded, recursive)
+	if err != nil {
+		return nil, err
+	}
+	renderedTemplates, us, err := tp.renderUnstructured(ctx, templateNames, values)
+	if err != nil {
+		return nil, err
+	}
+	images := imageSources(us, templateOrigins(renderedTemplates))
+	names := make([]string, 0, len(images))
+	for image := range images {
+		names = append(names, image)
+	}
+	sort.Strings(names)
+	now := time.Now().UTC().Format(sbomCreatedTimeFormat)
+	doc := &spdx.Document2_2{
+		CreationInfo: &spdx.CreationInfo2_2{
+			SPDXVersion:       "SPDX-2.2",
+			DataLicense:       "CC0-1.0",
+			SPDXIdentifier:    sbomDocumentID,
+			DocumentName:      path,
+			DocumentNamespace: sbomNamespacePrefix + path + "-" + hashImages(names),
+			CreatorTools:      []string{sbomTool},
+			Created:           now,
+		},
+		Packages: make(map[spdx.ElementID]*spdx.Package2_2),
+	}
+	for i, image := range names {
+		id := spdx.ElementID(fmt.Sprintf("%s%d", sbomPackageIDPrefix, i+1))
+		name, version := splitImage(image)
+		doc.Packages[id] = &spdx.Package2_2{
+			PackageName:               name,
+			PackageSPDXIdentifier:     id,
+			PackageVersion:            version,
+			PackageDownloadLocation:   sbomNoAssertion,
+			FilesAnalyzed:             false,
+			IsFilesAnalyzedTagPresent: true,
+			PackageLicenseConcluded:   sbomNoAssertion,
+			PackageLicenseDeclared:    sbomNoAssertion,
+			PackageCopyrightText:      sbomNoAssertion,
+			PackageComment:            image,
+			PackageExternalReferences: []*spdx.PackageExternalReference2_2{
+				{
+					Category: "PACKAGE-MANAGER",
+					RefType:  "purl",
+					Locator:  imagePURL(name, version),
+				},
+			},
+		}
+		doc.Relationships = append(doc.Relationships, &spdx.Relationship2_2{
+			RefA:         spdx.MakeDocElementID("", sbomDocumentID),
+			RefB:         spdx.MakeDocElementID("", string(id)),
+			Relationship: "DESCRIBES",
+		})
+		for _, source := range images[image] {
+			doc.Annotations = append(doc.Annotations, &spdx.Annotation2_2{
+				Annotator:                sbomTool,
+				AnnotatorType:            "Tool",
+				AnnotationDate:           now,
+				AnnotationType:           "OTHER",
+				AnnotationSPDXIdentifier: spdx.MakeDocElementID("", string(id)),
+				AnnotationComment:        source.String(),
+			})
+		}
+	}
+	return doc, nil
+}
+
+//imageSources returns for each image referenced by a workload the resources referencing it
+func imageSources(
+	us []*unstructured.Unstructured,
+	origins map[*unstructured.Unstructured]renderedTemplate) map[string][]imageSource {
+	images := make(map[string][]imageSource)
+	for _, u := range us {
+		spec, ok := podSpec(u)
+		if !ok {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, c := range podContainers(spec) {
+			image, _, _ := unstructured.NestedString(c, "image")
+			if image == "" || seen[image] {
+				continue
+			}
+			seen[image] = true
+			images[image] = append(images[image], imageSource{
+				templateName: origins[u].templateName,
+				kind:         u.GetKind(),
+				namespace:    u.GetNamespace(),
+				name:         u.GetName(),
+			})
+		}
+	}
+	return images
+}
+
+//splitImage returns the repository and the tag or digest of an image,
+//the image is returned as is if it is not a valid reference
+func splitImage(image string) (name, version string) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return image, ""
+	}
+	name = named.Name()
+	switch r := named.(type) {
+	case reference.Digested:
+		version = r.Digest().String()
+	case reference.Tagged:
+		version = r.Tag()
+	default:
+		version = "latest"
+	}
+	return name, version
+}
+
+//imagePURL returns the package url of an image
+func imagePURL(name, version string) string {
+	i := strings.LastIndex(name, "/")
+	purl := "pkg:oci/" + name[i+1:]
+	if version != "" {
+		purl += "@" + strings.Replace(version, ":", "%3A", 1)
+	}
+	return purl + "?repository_url=" + name
+}
+
+//hashImages returns a short hash of the images, used to build a unique document namespace
+func hashImages(images []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(images, "\n")))
+	return hex.EncodeToString(sum[:])[:16]
+}
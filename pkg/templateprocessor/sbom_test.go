@@ -0,0 +1,118 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTemplateProcessor_GenerateSBOM(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/deployment": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: mydeployment
+  namespace: myns
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: busybox
+      containers:
+      - name: app
+        image: quay.io/myorg/myapp:{{ .Tag }}
+      - name: sidecar
+        image: quay.io/myorg/myapp:{{ .Tag }}`,
+		"test/job": `
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: myjob
+  namespace: myns
+spec:
+  template:
+    spec:
+      containers:
+      - name: job
+        image: quay.io/myorg/myapp:{{ .Tag }}`,
+		"test/configmap": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: myconfigmap
+  namespace: myns`,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := tp.GenerateSBOM(context.TODO(), "test", nil, false, struct{ Tag string }{Tag: "1.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.CreationInfo.SPDXVersion != "SPDX-2.2" {
+		t.Errorf("Expecting SPDX-2.2 got %s", doc.CreationInfo.SPDXVersion)
+	}
+	if len(doc.Packages) != 2 {
+		t.Fatalf("Expecting 2 packages got %d", len(doc.Packages))
+	}
+	versions := make(map[string]string)
+	for _, p := range doc.Packages {
+		versions[p.PackageName] = p.PackageVersion
+	}
+	wantVersions := map[string]string{
+		"docker.io/library/busybox": "latest",
+		"quay.io/myorg/myapp":       "1.0.0",
+	}
+	for name, version := range wantVersions {
+		if versions[name] != version {
+			t.Errorf("Expecting package %s version %s got %s", name, version, versions[name])
+		}
+	}
+	if len(doc.Relationships) != 2 {
+		t.Errorf("Expecting 2 relationships got %d", len(doc.Relationships))
+	}
+	comments := make(map[string]bool)
+	for _, a := range doc.Annotations {
+		comments[a.AnnotationComment] = true
+	}
+	wantComments := []string{
+		TemplateSourceAnnotation + "=test/deployment (Deployment myns/mydeployment)",
+		TemplateSourceAnnotation + "=test/job (Job myns/myjob)",
+	}
+	if len(doc.Annotations) != 3 {
+		t.Errorf("Expecting 3 annotations got %d", len(doc.Annotations))
+	}
+	for _, c := range wantComments {
+		if !comments[c] {
+			t.Errorf("Expecting annotation %s in %v", c, comments)
+		}
+	}
+}
+
+func Test_splitImage(t *testing.T) {
+	tests := []struct {
+		image       string
+		wantName    string
+		wantVersion string
+	}{
+		{image: "nginx", wantName: "docker.io/library/nginx", wantVersion: "latest"},
+		{image: "quay.io/myorg/myapp:1.0", wantName: "quay.io/myorg/myapp", wantVersion: "1.0"},
+		{
+			image:       "myapp@sha256:" + "0123456789012345678901234567890123456789012345678901234567890123",
+			wantName:    "docker.io/library/myapp",
+			wantVersion: "sha256:0123456789012345678901234567890123456789012345678901234567890123",
+		},
+		{image: "Invalid Image", wantName: "Invalid Image", wantVersion: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			name, version := splitImage(tt.image)
+			if name != tt.wantName || version != tt.wantVersion {
+				t.Errorf("splitImage() = %s, %s, want %s, %s", name, version, tt.wantName, tt.wantVersion)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mozilla.org/sops/v3/decrypt"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+//sopsEncryptedPrefix the prefix of the SOPS encrypted values
+const sopsEncryptedPrefix = "ENC["
+
+//decryptSOPSSecret decrypts a Secret encrypted with SOPS, b is the rendered yaml of the Secret u.
+//The key material is retrieved by the SOPS library, from the environment variables or the configured KMS.
+//The yaml is decrypted as rendered as the SOPS message authentication code depends on the order of the values.
+func (tp *TemplateProcessor) decryptSOPSSecret(b []byte, u *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if !tp.options.SOPSDecrypt || u.GetKind() != "Secret" {
+		return u, nil
+	}
+	if _, ok := u.Object["sops"]; !ok {
+		if hasSOPSEncryptedValues(u) {
+			return nil, fmt.Errorf("Secret %s/%s has SOPS encrypted values but no sops metadata",
+				u.GetNamespace(), u.GetName())
+		}
+		return u, nil
+	}
+	cleartext, err := decrypt.Data(b, "yaml")
+	if err != nil {
+		return nil, fmt.Errorf("Secret %s/%s SOPS decryption failed: %s", u.GetNamespace(), u.GetName(), err)
+	}
+	decrypted, err := tp.BytesToUnstructured(cleartext)
+	if err != nil {
+		return nil, err
+	}
+	unstructured.RemoveNestedField(decrypted.Object, "sops")
+	return decrypted, nil
+}
+
+//hasSOPSEncryptedValues returns true if a value of the data or stringData of the Secret is SOPS encrypted
+func hasSOPSEncryptedValues(u *unstructured.Unstructured) bool {
+	for _, field := range []string{"data", "stringData"} {
+		values, _, _ := unstructured.NestedStringMap(u.Object, field)
+		for _, v := range values {
+			if strings.HasPrefix(v, sopsEncryptedPrefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTemplateProcessor_decryptSOPSSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *Options
+		secret  string
+		wantErr bool
+	}{
+		{
+			name:    "not encrypted",
+			options: &Options{SOPSDecrypt: true},
+			secret: `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: mysecret
+  namespace: myns
+stringData:
+  password: mypassword`,
+		},
+		{
+			name:    "encrypted values without metadata",
+			options: &Options{SOPSDecrypt: true},
+			secret: `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: mysecret
+  namespace: myns
+stringData:
+  password: ENC[AES256_GCM,data:cGFzcw==,iv:aXY=,tag:dGFn,type:str]`,
+			wantErr: true,
+		},
+		{
+			name:    "no key to decrypt",
+			options: &Options{SOPSDecrypt: true},
+			secret: `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: mysecret
+  namespace: myns
+stringData:
+  password: ENC[AES256_GCM,data:cGFzcw==,iv:aXY=,tag:dGFn,type:str]
+sops:
+  mac: ENC[AES256_GCM,data:bWFj,iv:aXY=,tag:dGFn,type:str]
+  lastmodified: '2020-10-01T00:00:00Z'
+  version: 3.6.1`,
+			wantErr: true,
+		},
+		{
+			name:    "disabled",
+			options: &Options{},
+			secret: `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: mysecret
+  namespace: myns
+stringData:
+  password: ENC[AES256_GCM,data:cGFzcw==,iv:aXY=,tag:dGFn,type:str]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+				"test/secret": tt.secret,
+			}), WithOptions(tt.options))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TemplateResourcesInPathUnstructured() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+	"time"
+)
+
+//RenderStats summarizes the rendering of the templates of a path
+type RenderStats struct {
+	//TotalResources the number of rendered resources, including the generated ones
+	TotalResources int
+	//ResourcesByKind the number of rendered resources per kind
+	ResourcesByKind map[string]int
+	//ResourcesByNamespace the number of rendered resources per namespace,
+	//the cluster scoped resources are counted under the empty namespace
+	ResourcesByNamespace map[string]int
+	//TotalRenderedBytes the size of the rendered templates
+	TotalRenderedBytes int64
+	//DurationMs the rendering duration in milliseconds
+	DurationMs int64
+}
+
+//TemplateResourcesInPathStats renders all assets in a path and returns the RenderStats
+//instead of the rendered resources
+func (tp *TemplateProcessor) TemplateResourcesInPathStats(
+	ctx context.Context,
+	path string,
+	excluded []string,
+	recursive bool,
+	values interface{},
+) (*RenderStats, error) {
+	start := time.Now()
+	templateNames, err := tp.AssetNamesInPath(path, excluded, recursive)
+	if err != nil {
+		return nil, err
+	}
+	renderedTemplates, us, err := tp.renderUnstructured(ctx, templateNames, values)
+	if err != nil {
+		return nil, err
+	}
+	stats := &RenderStats{
+		TotalResources:       len(us),
+		ResourcesByKind:      make(map[string]int),
+		ResourcesByNamespace: make(map[string]int),
+	}
+	for _, u := range us {
+		stats.ResourcesByKind[u.GetKind()]++
+		stats.ResourcesByNamespace[u.GetNamespace()]++
+	}
+	for _, t := range renderedTemplates {
+		stats.TotalRenderedBytes += int64(len(t.rendered))
+	}
+	stats.DurationMs = time.Since(start).Milliseconds()
+	return stats, nil
+}
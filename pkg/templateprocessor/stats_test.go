@@ -0,0 +1,75 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestTemplateProcessor_TemplateResourcesInPathStats(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/configmaps": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm1
+  namespace: ns1
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm2
+  namespace: {{ .Namespace }}`,
+		"test/serviceaccount": `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: sa
+  namespace: ns1`,
+		"test/clusterrole": `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: cr`,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := struct{ Namespace string }{Namespace: "ns2"}
+	stats, err := tp.TemplateResourcesInPathStats(context.TODO(), "test", nil, false, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalResources != 4 {
+		t.Errorf("Expecting 4 resources got %d", stats.TotalResources)
+	}
+	if want := map[string]int{"ConfigMap": 2, "ServiceAccount": 1, "ClusterRole": 1}; !reflect.DeepEqual(stats.ResourcesByKind, want) {
+		t.Errorf("Expecting ResourcesByKind %v got %v", want, stats.ResourcesByKind)
+	}
+	if want := map[string]int{"ns1": 2, "ns2": 1, "": 1}; !reflect.DeepEqual(stats.ResourcesByNamespace, want) {
+		t.Errorf("Expecting ResourcesByNamespace %v got %v", want, stats.ResourcesByNamespace)
+	}
+	yamls, err := tp.TemplateResources(context.TODO(), []string{"test/clusterrole", "test/configmaps", "test/serviceaccount"}, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var size int64
+	for _, y := range yamls {
+		size += int64(len(y))
+	}
+	if stats.TotalRenderedBytes != size {
+		t.Errorf("Expecting TotalRenderedBytes %d got %d", size, stats.TotalRenderedBytes)
+	}
+	if stats.DurationMs < 0 {
+		t.Errorf("Expecting a positive duration got %d", stats.DurationMs)
+	}
+	tp, err = NewTemplateProcessor(NewTestReader(map[string]string{"test/invalid": "{{ .Namespace"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tp.TemplateResourcesInPathStats(context.TODO(), "test", nil, false, values); err == nil {
+		t.Error("Expecting an error for an invalid template")
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+)
+
+//generatedTarEntryName the entry of the resources generated by the post-processing,
+//which were not rendered by a template
+const generatedTarEntryName = "generated.yaml"
+
+//RenderToTar renders all assets in a path and writes the post-processed resources in a gzipped tar archive.
+//The resources of each template are written in an entry named after the template path with a .yaml extension,
+//the resources generated by the post-processing are written in the generated.yaml entry.
+//An error is returned if two templates are written in the same entry (ie: x.yml and x.yaml).
+//The entries modification time is the Unix epoch and the entries are sorted by name
+//so the same templates and values always produce the same archive.
+func (tp *TemplateProcessor) RenderToTar(
+	ctx context.Context,
+	path string,
+	excluded []string,
+	recursive bool,
+	values interface{},
+	w io.Writer,
+) error {
+	templateNames, err := tp.AssetNamesInPath(path, excluded, recursive)
+	if err != nil {
+		return err
+	}
+	renderedTemplates, us, err := tp.renderUnstructured(ctx, templateNames, values)
+	if err != nil {
+		return err
+	}
+	entryTemplates := make(map[string]string)
+	for _, r := range renderedTemplates {
+		name := strings.TrimSuffix(r.templateName, filepath.Ext(r.templateName)) + ".yaml"
+		if templateName, ok := entryTemplates[name]; ok {
+			return fmt.Errorf("templates %s and %s are both written in the tar entry %s", templateName, r.templateName, name)
+		}
+		entryTemplates[name] = r.templateName
+	}
+	origins := templateOrigins(renderedTemplates)
+	entries := make(map[string][]byte)
+	for _, u := range us {
+		name := generatedTarEntryName
+		if r, ok := origins[u]; ok {
+			name = strings.TrimSuffix(r.templateName, filepath.Ext(r.templateName)) + ".yaml"
+		} else if templateName, ok := entryTemplates[name]; ok {
+			return fmt.Errorf("template %s and the generated resources are both written in the tar entry %s", templateName, name)
+		}
+		b, err := yaml.Marshal(u.Object)
+		if err != nil {
+			return err
+		}
+		if len(entries[name]) != 0 {
+			entries[name] = append(entries[name], []byte("---\n")...)
+		}
+		entries[name] = append(entries[name], b...)
+	}
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, name := range names {
+		hdr := &tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(entries[name])),
+			ModTime: time.Unix(0, 0),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(entries[name]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
@@ -0,0 +1,140 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTemplateProcessor_RenderToTar(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/configmap.tpl": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Name }}
+  namespace: myns`,
+		"test/serviceaccount": `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: {{ .Name }}
+  namespace: myns`,
+		"test/service": `
+apiVersion: v1
+kind: Service
+metadata:
+  name: {{ .Name }}
+  namespace: myns
+  labels:
+    app: myapp
+  annotations:
+    templateprocessor.io/enable-monitoring: "true"`,
+		"test/empty": `{{ if false }}
+apiVersion: v1
+kind: ServiceAccount
+{{ end }}`,
+	}), WithOptions(&Options{InjectManagedAnnotation: true, AutoServiceMonitor: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]string{"Name": "myname"}
+	var buf bytes.Buffer
+	if err := tp.RenderToTar(context.TODO(), "test", nil, false, values, &buf); err != nil {
+		t.Fatal(err)
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+	contents := make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !hdr.ModTime.Equal(time.Unix(0, 0)) {
+			t.Errorf("Expecting the epoch as modification time of %s got %v", hdr.Name, hdr.ModTime)
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[hdr.Name] = string(b)
+	}
+	want := map[string]string{
+		"test/configmap.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  annotations:
+    templateprocessor.io/managed: "true"
+  name: myname
+  namespace: myns
+`,
+		"test/serviceaccount.yaml": `apiVersion: v1
+kind: ServiceAccount
+metadata:
+  annotations:
+    templateprocessor.io/managed: "true"
+  name: myname
+  namespace: myns
+`,
+	}
+	for name, content := range want {
+		if contents[name] != content {
+			t.Errorf("Expecting entry %s:\n%s\ngot:\n%s", name, content, contents[name])
+		}
+	}
+	if !strings.Contains(contents["test/service.yaml"], "kind: Service\n") {
+		t.Errorf("Expecting the Service in test/service.yaml got %v", contents)
+	}
+	if !strings.Contains(contents[generatedTarEntryName], "kind: ServiceMonitor\n") {
+		t.Errorf("Expecting the generated ServiceMonitor in %s got %v", generatedTarEntryName, contents)
+	}
+	if len(contents) != 4 {
+		t.Errorf("Expecting 4 entries got %v", contents)
+	}
+	var again bytes.Buffer
+	if err := tp.RenderToTar(context.TODO(), "test", nil, false, values, &again); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), again.Bytes()) {
+		t.Error("Expecting the same archive for the same templates and values")
+	}
+}
+
+func TestTemplateProcessor_RenderToTarDuplicateEntry(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/configmap.yml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm1
+  namespace: myns`,
+		"test/configmap.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm2
+  namespace: myns`,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tp.RenderToTar(context.TODO(), "test", nil, false, nil, &buf); err == nil {
+		t.Error("Expecting an error for the templates written in the same entry")
+	}
+}
@@ -5,10 +5,31 @@ package templateprocessor
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base32"
 	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	goerr "errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"math/rand"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
 	"text/template"
+	"time"
 
+	"github.com/Masterminds/sprig/v3"
+	jsonpatch "github.com/evanphx/json-patch"
 	"github.com/ghodss/yaml"
+	"github.com/google/uuid"
+	"github.com/jmespath/go-jmespath"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/klog"
 )
 
@@ -27,8 +48,32 @@ func GenericFuncMap() map[string]interface{} {
 }
 
 var genericMap = map[string]interface{}{
-	"toYaml":       toYaml,
-	"encodeBase64": encodeBase64,
+	"toYaml":                 toYaml,
+	"encodeBase64":           encodeBase64,
+	"parseCSV":               parseCSV,
+	"parseCSVToMap":          parseCSVToMap,
+	"ipRange":                ipRange,
+	"generatePassword":       generatePassword,
+	"generateUUID":           generateUUID,
+	"toUnstructuredJSON":     toUnstructuredJSON,
+	"jmesPath":               jmesPath,
+	"mustToJSON":             toUnstructuredJSON,
+	"mustToJSONPretty":       mustToJSONPretty,
+	"generateCSR":            generateCSR,
+	"jsonPatch":              jsonPatch,
+	"base32enc":              base32enc,
+	"base32dec":              base32dec,
+	"urlBase32enc":           urlBase32enc,
+	"urlBase32dec":           urlBase32dec,
+	"parseDuration":          time.ParseDuration,
+	"formatDuration":         formatDuration,
+	"durationSeconds":        durationSeconds,
+	"durationMilliseconds":   durationMilliseconds,
+	"generateSelfSignedCert": generateSelfSignedCert,
+	"withDefault":            withDefault,
+	"randomChoice":           randomChoice,
+	"splitYAML":              splitYAML,
+	"fromJSON":               fromJSON,
 }
 
 func toYaml(o interface{}) (string, error) {
@@ -45,6 +90,269 @@ func encodeBase64(s string) string {
 	return base64.StdEncoding.EncodeToString([]byte(s))
 }
 
+//base32enc encodes the string in base32 with padding
+func base32enc(s string) string {
+	return base32.StdEncoding.EncodeToString([]byte(s))
+}
+
+//base32dec decodes a padded base32 string
+func base32dec(s string) (string, error) {
+	b, err := base32.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+//urlBase32 the base32 encoding without the padding character '=' which is not URL safe
+var urlBase32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+//urlBase32enc encodes the string in base32 without padding
+func urlBase32enc(s string) string {
+	return urlBase32.EncodeToString([]byte(s))
+}
+
+//urlBase32dec decodes a base32 string without padding
+func urlBase32dec(s string) (string, error) {
+	b, err := urlBase32.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+//formatDuration returns the duration as a string (ie: "1h30m0s")
+func formatDuration(d time.Duration) string {
+	return d.String()
+}
+
+//durationSeconds returns the number of seconds, truncated, of a duration string (ie: "1m30s" returns 90)
+func durationSeconds(s string) (int64, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	return int64(d / time.Second), nil
+}
+
+//durationMilliseconds returns the number of milliseconds, truncated, of a duration string (ie: "1.5s" returns 1500)
+func durationMilliseconds(s string) (int64, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	return d.Milliseconds(), nil
+}
+
+//withDefault returns value if it is set and defaultValue otherwise.
+//A value is not set if it is nil, an empty string, a zero number or an empty slice, array or map.
+//Contrary to the sprig default function, a false bool or a struct is considered as set.
+func withDefault(defaultValue, value interface{}) interface{} {
+	if value == nil {
+		return defaultValue
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		if v.Len() == 0 {
+			return defaultValue
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		if v.IsZero() {
+			return defaultValue
+		}
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return defaultValue
+		}
+	}
+	return value
+}
+
+//parseCSV splits a comma-separated string into a slice of trimmed values, empty values are dropped
+func parseCSV(s string) []string {
+	values := make([]string, 0)
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+//parseCSVToMap splits a comma-separated list of key/value pairs into a map,
+//the key and the value are separated by kvSep. A pair without kvSep is mapped to an empty value
+func parseCSVToMap(s string, kvSep string) map[string]string {
+	m := make(map[string]string)
+	for _, pair := range parseCSV(s) {
+		kv := strings.SplitN(pair, kvSep, 2)
+		key := strings.TrimSpace(kv[0])
+		if len(kv) == 1 {
+			m[key] = ""
+			continue
+		}
+		m[key] = strings.TrimSpace(kv[1])
+	}
+	return m
+}
+
+//ipRange returns the network, broadcast, first and last usable addresses, the mask
+//and the number of addresses of a CIDR
+func ipRange(cidr string) (map[string]string, error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	ones, bits := ipNet.Mask.Size()
+	network := new(big.Int).SetBytes(ipNet.IP)
+	size := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+	broadcast := new(big.Int).Add(network, size)
+	broadcast.Sub(broadcast, big.NewInt(1))
+	first := new(big.Int).Set(network)
+	last := new(big.Int).Set(broadcast)
+	//The network and broadcast addresses are not usable except for point to point and single host networks
+	if bits-ones > 1 {
+		first.Add(first, big.NewInt(1))
+		last.Sub(last, big.NewInt(1))
+	}
+	toIP := func(i *big.Int) string {
+		b := i.Bytes()
+		ip := make(net.IP, len(ipNet.IP))
+		copy(ip[len(ip)-len(b):], b)
+		return ip.String()
+	}
+	return map[string]string{
+		"network":   toIP(network),
+		"broadcast": toIP(broadcast),
+		"first":     toIP(first),
+		"last":      toIP(last),
+		"mask":      net.IP(ipNet.Mask).String(),
+		"size":      size.String(),
+	}, nil
+}
+
+const passwordCharacters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+//generatePassword generates an alphanumeric password of the given length.
+//The password is derived from the seed using sha256, the same seed always generates the same password.
+func generatePassword(length int, seed string) string {
+	password := make([]byte, 0, length)
+	//Bytes above the largest multiple of len(passwordCharacters) are skipped to avoid a biased distribution
+	limit := byte(256 - 256%len(passwordCharacters))
+	counter := make([]byte, 8)
+	for i := uint64(0); len(password) < length; i++ {
+		binary.BigEndian.PutUint64(counter, i)
+		sum := sha256.Sum256(append([]byte(seed), counter...))
+		for _, b := range sum {
+			if b >= limit {
+				continue
+			}
+			password = append(password, passwordCharacters[int(b)%len(passwordCharacters)])
+			if len(password) == length {
+				break
+			}
+		}
+	}
+	return string(password)
+}
+
+//splitYAML parses each document of a multi-document YAML, the documents being separated by "---".
+//The empty documents are skipped.
+func splitYAML(s string) ([]interface{}, error) {
+	docs := make([]interface{}, 0)
+	for _, b := range ConvertStringToArrayOfBytes(s, KubernetesYamlsDelimiter) {
+		var doc interface{}
+		if err := yaml.Unmarshal(b, &doc); err != nil {
+			return nil, err
+		}
+		if doc != nil {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
+//fromJSON parses a JSON string, it is the counterpart of the sprig toJson function
+func fromJSON(s string) (interface{}, error) {
+	var o interface{}
+	if err := json.Unmarshal([]byte(s), &o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+//randomChoice returns one of the choices selected with a random generator seeded from the sha256 of the seed,
+//the same seed always selects the same choice. An empty string is returned if there are no choices.
+func randomChoice(seed string, choices []string) string {
+	if len(choices) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(seed))
+	r := rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(sum[:8]))))
+	return choices[r.Intn(len(choices))]
+}
+
+//uuidNamespace the namespace of the UUIDs generated by generateUUID
+var uuidNamespace = uuid.MustParse("b585f52b-6500-4ae2-98df-d150c04903d3")
+
+//generateUUID generates a version 5 UUID from the seed, the same seed always generates the same UUID
+func generateUUID(seed string) string {
+	return uuid.NewSHA1(uuidNamespace, []byte(seed)).String()
+}
+
+//toUnstructuredJSON marshals the value in compact JSON without escaping the HTML characters &, < and >,
+//this allows to embed the JSON in an annotation. It is also registered as mustToJSON.
+func toUnstructuredJSON(v interface{}) (string, error) {
+	return marshalJSON(v, "")
+}
+
+//mustToJSONPretty marshals the value in indented JSON without escaping the HTML characters,
+//an error is returned if the value can't be marshalled
+func mustToJSONPretty(v interface{}) (string, error) {
+	return marshalJSON(v, "  ")
+}
+
+//marshalJSON marshals the value without escaping the HTML characters, the JSON is indented if indent is not empty
+func marshalJSON(v interface{}, indent string) (string, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", indent)
+	if err := encoder.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+//jmesPath returns the result of the JMESPath expression evaluated on the data
+func jmesPath(expression string, data interface{}) (interface{}, error) {
+	return jmespath.Search(expression, data)
+}
+
+//jsonPatch applies the RFC 6902 JSON patch to the target and returns the patched value
+func jsonPatch(patchJSON string, target interface{}) (interface{}, error) {
+	patch, err := jsonpatch.DecodePatch([]byte(patchJSON))
+	if err != nil {
+		return nil, err
+	}
+	doc, err := json.Marshal(target)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := patch.Apply(doc)
+	if err != nil {
+		return nil, err
+	}
+	var result interface{}
+	if err := json.Unmarshal(patched, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 //TemplateFuncMap generates function map for "include"
 func TemplateFuncMap(tmpl *template.Template) (funcMap template.FuncMap) {
 	funcMap = make(template.FuncMap, 0)
@@ -57,3 +365,217 @@ func TemplateFuncMap(tmpl *template.Template) (funcMap template.FuncMap) {
 	}
 	return funcMap
 }
+
+//processorFuncNames the names of the functions returned by processorFuncMap
+var processorFuncNames = []string{
+	"renderTemplate", "lookupConfigMap", "lookupSecret", "kubeResourceBySelector", "httpGet",
+}
+
+//processorFuncMap generates the function map for the functions using the TemplateProcessor
+//reader or options, ctx is the context of the rendering of the template
+func (tp *TemplateProcessor) processorFuncMap(ctx context.Context) template.FuncMap {
+	return template.FuncMap{
+		"renderTemplate": func(templateName string, values interface{}) (string, error) {
+			return tp.renderTemplate(ctx, templateName, values)
+		},
+		"lookupConfigMap": func(namespace, name, key string) (string, error) {
+			return tp.lookupConfigMap(ctx, namespace, name, key)
+		},
+		"lookupSecret": func(namespace, name, key string) (string, error) {
+			return tp.lookupSecret(ctx, namespace, name, key)
+		},
+		"kubeResourceBySelector": func(apiVersion, kind, namespace, selector string) ([]map[string]interface{}, error) {
+			return tp.kubeResourceBySelector(ctx, apiVersion, kind, namespace, selector)
+		},
+		"httpGet": func(url string) (string, error) {
+			return tp.httpGet(ctx, url)
+		},
+	}
+}
+
+//textTemplateBuiltins the functions predefined by text/template
+var textTemplateBuiltins = []string{
+	"and", "call", "html", "index", "slice", "js", "len", "not", "or",
+	"print", "printf", "println", "urlquery", "eq", "ge", "gt", "le", "lt", "ne",
+}
+
+//RegisterFuncs adds the functions of fm to the functions available in the templates.
+//The registered functions are available in every subsequent rendering and TemplateBytes call.
+//An error is returned if a function is invalid or would shadow a built-in function
+//(text/template, sprig or the TemplateProcessor functions), in which case none of the functions are registered.
+//A function registered previously with RegisterFuncs can be replaced.
+func (tp *TemplateProcessor) RegisterFuncs(fm template.FuncMap) (err error) {
+	builtins := sprig.TxtFuncMap()
+	for k, v := range ApplierFuncMap() {
+		builtins[k] = v
+	}
+	for k, v := range TemplateFuncMap(nil) {
+		builtins[k] = v
+	}
+	for _, k := range append(processorFuncNames, textTemplateBuiltins...) {
+		builtins[k] = nil
+	}
+	for name := range fm {
+		if _, ok := builtins[name]; ok {
+			return fmt.Errorf("function %s would shadow a built-in function", name)
+		}
+	}
+	//template.Funcs panics on invalid functions
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid function: %v", r)
+		}
+	}()
+	template.New("").Funcs(fm)
+	tp.funcMapMutex.Lock()
+	defer tp.funcMapMutex.Unlock()
+	if tp.funcMap == nil {
+		tp.funcMap = make(template.FuncMap, len(fm))
+	}
+	for name, f := range fm {
+		tp.funcMap[name] = f
+	}
+	return nil
+}
+
+//registeredFuncs returns a copy of the functions registered with RegisterFuncs
+func (tp *TemplateProcessor) registeredFuncs() template.FuncMap {
+	tp.funcMapMutex.RLock()
+	defer tp.funcMapMutex.RUnlock()
+	fm := make(template.FuncMap, len(tp.funcMap))
+	for name, f := range tp.funcMap {
+		fm[name] = f
+	}
+	return fm
+}
+
+//maxRenderTemplateDepth the maximum number of nested renderTemplate calls
+const maxRenderTemplateDepth = 10
+
+//renderTemplateDepthKey the context key of the number of nested renderTemplate calls
+type renderTemplateDepthKey struct{}
+
+//renderTemplate renders the asset templateName of the reader with the values,
+//ctx is the context of the rendering of the template calling renderTemplate
+func (tp *TemplateProcessor) renderTemplate(ctx context.Context, templateName string, values interface{}) (string, error) {
+	depth, _ := ctx.Value(renderTemplateDepthKey{}).(int)
+	if depth >= maxRenderTemplateDepth {
+		return "", fmt.Errorf("renderTemplate %s: more than %d nested renderTemplate calls", templateName, maxRenderTemplateDepth)
+	}
+	b, err := tp.TemplateResource(context.WithValue(ctx, renderTemplateDepthKey{}, depth+1), templateName, values)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+//lookupConfigMap returns the value of the key in the data of the configmap namespace/name
+func (tp *TemplateProcessor) lookupConfigMap(ctx context.Context, namespace, name, key string) (string, error) {
+	if tp.options.KubeClient == nil {
+		return "", goerr.New("lookupConfigMap requires the KubeClient option")
+	}
+	cm, err := tp.options.KubeClient.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	v, ok := cm.Data[key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found in configmap %s/%s", key, namespace, name)
+	}
+	return v, nil
+}
+
+//lookupSecret returns the decoded value of the key in the data of the secret namespace/name
+func (tp *TemplateProcessor) lookupSecret(ctx context.Context, namespace, name, key string) (string, error) {
+	if tp.options.KubeClient == nil {
+		return "", goerr.New("lookupSecret requires the KubeClient option")
+	}
+	s, err := tp.options.KubeClient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	v, ok := s.Data[key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found in secret %s/%s", key, namespace, name)
+	}
+	return string(v), nil
+}
+
+//kubeResourceBySelector returns the resources of the given apiVersion and kind in the namespace matching
+//the label selector. The results are cached for the duration of the rendering.
+func (tp *TemplateProcessor) kubeResourceBySelector(ctx context.Context, apiVersion, kind, namespace, selector string) ([]map[string]interface{}, error) {
+	if tp.options.DynamicClient == nil {
+		return nil, goerr.New("kubeResourceBySelector requires the DynamicClient option")
+	}
+	key := strings.Join([]string{apiVersion, kind, namespace, selector}, "|")
+	_, rs := withRenderState(ctx)
+	rs.mutex.Lock()
+	results, ok := rs.selectorCache[key]
+	rs.mutex.Unlock()
+	if ok {
+		return results, nil
+	}
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return nil, err
+	}
+	l, err := tp.options.DynamicClient.Resource(gvrFor(gv.WithKind(kind))).
+		Namespace(namespace).
+		List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	results = make([]map[string]interface{}, len(l.Items))
+	for i := range l.Items {
+		results[i] = l.Items[i].Object
+	}
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	rs.selectorCache[key] = results
+	return results, nil
+}
+
+//defaultHTTPGetTimeout the timeout of the httpGet requests if the HTTPGetTimeout option is not set
+const defaultHTTPGetTimeout = 30 * time.Second
+
+//httpGet returns the body of the response to a GET request on the url.
+//The responses are cached for the duration of the rendering.
+func (tp *TemplateProcessor) httpGet(ctx context.Context, url string) (string, error) {
+	_, rs := withRenderState(ctx)
+	rs.mutex.Lock()
+	body, ok := rs.httpGetCache[url]
+	rs.mutex.Unlock()
+	if ok {
+		return body, nil
+	}
+	client := tp.options.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	timeout := tp.options.HTTPGetTimeout
+	if timeout == 0 {
+		timeout = defaultHTTPGetTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("httpGet %s: unexpected status %s", url, resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	rs.httpGetCache[url] = string(b)
+	return string(b), nil
+}
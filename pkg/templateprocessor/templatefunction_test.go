@@ -0,0 +1,950 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_durations(t *testing.T) {
+	tests := []struct {
+		name       string
+		s          string
+		wantSec    int64
+		wantMs     int64
+		wantFormat string
+		wantErr    bool
+	}{
+		{name: "minutes", s: "1m30s", wantSec: 90, wantMs: 90000, wantFormat: "1m30s"},
+		{name: "fraction", s: "1.5s", wantSec: 1, wantMs: 1500, wantFormat: "1.5s"},
+		{name: "hours", s: "2h", wantSec: 7200, wantMs: 7200000, wantFormat: "2h0m0s"},
+		{name: "invalid", s: "ten", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sec, err := durationSeconds(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("durationSeconds() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			ms, err := durationMilliseconds(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("durationMilliseconds() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if sec != tt.wantSec || ms != tt.wantMs {
+				t.Errorf("Expecting %d s and %d ms got %d s and %d ms", tt.wantSec, tt.wantMs, sec, ms)
+			}
+			d, _ := time.ParseDuration(tt.s)
+			if got := formatDuration(d); got != tt.wantFormat {
+				t.Errorf("formatDuration() = %s, want %s", got, tt.wantFormat)
+			}
+		})
+	}
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/configmap": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: myconfigmap
+  namespace: myns
+data:
+  timeout: {{ durationSeconds "2m" | quote }}
+  minutes: {{ (parseDuration "90s").Minutes | quote }}
+  formatted: {{ parseDuration "90s" | formatDuration | quote }}`,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _, _ := unstructured.NestedStringMap(us[0].Object, "data")
+	if !reflect.DeepEqual(data, map[string]string{"timeout": "120", "minutes": "1.5", "formatted": "1m30s"}) {
+		t.Errorf("Unexpected data %v", data)
+	}
+}
+
+func Test_withDefault(t *testing.T) {
+	var nilMap map[string]string
+	var nilPointer *int
+	tests := []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{name: "nil", value: nil, want: "default"},
+		{name: "empty string", value: "", want: "default"},
+		{name: "string", value: "value", want: "value"},
+		{name: "zero int", value: 0, want: "default"},
+		{name: "int", value: 3, want: 3},
+		{name: "zero float", value: 0.0, want: "default"},
+		{name: "empty slice", value: []string{}, want: "default"},
+		{name: "slice", value: []string{"a"}, want: []string{"a"}},
+		{name: "nil map", value: nilMap, want: "default"},
+		{name: "map", value: map[string]string{"a": "b"}, want: map[string]string{"a": "b"}},
+		{name: "nil pointer", value: nilPointer, want: "default"},
+		{name: "false", value: false, want: false},
+		{name: "struct", value: struct{}{}, want: struct{}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withDefault("default", tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("withDefault() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_base32(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    string
+		wantURL string
+	}{
+		{name: "empty", s: "", want: "", wantURL: ""},
+		{name: "padded", s: "hello", want: "NBSWY3DP", wantURL: "NBSWY3DP"},
+		{name: "with padding", s: "hi", want: "NBUQ====", wantURL: "NBUQ"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := base32enc(tt.s); got != tt.want {
+				t.Errorf("base32enc() = %v, want %v", got, tt.want)
+			}
+			if got, err := base32dec(tt.want); err != nil || got != tt.s {
+				t.Errorf("base32dec() = %v, %v, want %v", got, err, tt.s)
+			}
+			if got := urlBase32enc(tt.s); got != tt.wantURL {
+				t.Errorf("urlBase32enc() = %v, want %v", got, tt.wantURL)
+			}
+			if got, err := urlBase32dec(tt.wantURL); err != nil || got != tt.s {
+				t.Errorf("urlBase32dec() = %v, %v, want %v", got, err, tt.s)
+			}
+		})
+	}
+	if _, err := base32dec("not base32!"); err == nil {
+		t.Error("base32dec() expecting an error")
+	}
+	if _, err := urlBase32dec("NBUQ===="); err == nil {
+		t.Error("urlBase32dec() expecting an error for a padded string")
+	}
+}
+
+func Test_parseCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want []string
+	}{
+		{
+			name: "success",
+			s:    "a, b ,c",
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name: "empty values dropped",
+			s:    ",a,,b,",
+			want: []string{"a", "b"},
+		},
+		{
+			name: "empty string",
+			s:    "",
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseCSV(tt.s); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCSV() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseCSVToMap(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     string
+		kvSep string
+		want  map[string]string
+	}{
+		{
+			name:  "success",
+			s:     "key1=val1, key2=val2",
+			kvSep: "=",
+			want:  map[string]string{"key1": "val1", "key2": "val2"},
+		},
+		{
+			name:  "value containing separator",
+			s:     "key1:a:b,key2",
+			kvSep: ":",
+			want:  map[string]string{"key1": "a:b", "key2": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseCSVToMap(tt.s, tt.kvSep); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCSVToMap() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ipRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		cidr    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "ipv4",
+			cidr: "10.0.1.17/24",
+			want: map[string]string{
+				"network":   "10.0.1.0",
+				"broadcast": "10.0.1.255",
+				"first":     "10.0.1.1",
+				"last":      "10.0.1.254",
+				"mask":      "255.255.255.0",
+				"size":      "256",
+			},
+		},
+		{
+			name: "ipv4 single host",
+			cidr: "192.168.0.1/32",
+			want: map[string]string{
+				"network":   "192.168.0.1",
+				"broadcast": "192.168.0.1",
+				"first":     "192.168.0.1",
+				"last":      "192.168.0.1",
+				"mask":      "255.255.255.255",
+				"size":      "1",
+			},
+		},
+		{
+			name: "ipv6",
+			cidr: "fd00::/120",
+			want: map[string]string{
+				"network":   "fd00::",
+				"broadcast": "fd00::ff",
+				"first":     "fd00::1",
+				"last":      "fd00::fe",
+				"mask":      "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ff00",
+				"size":      "256",
+			},
+		},
+		{
+			name:    "invalid",
+			cidr:    "10.0.1.0",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ipRange(tt.cidr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ipRange() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ipRange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_splitYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    []interface{}
+		wantErr bool
+	}{
+		{name: "empty", s: "", want: []interface{}{}},
+		{
+			name: "single document",
+			s:    "a: b",
+			want: []interface{}{map[string]interface{}{"a": "b"}},
+		},
+		{
+			name: "multiple documents",
+			s:    "---\nkind: ConfigMap\nmetadata:\n  name: cm\n---\n# comment only\n---\n- 1\n- two\n",
+			want: []interface{}{
+				map[string]interface{}{"kind": "ConfigMap", "metadata": map[string]interface{}{"name": "cm"}},
+				[]interface{}{float64(1), "two"},
+			},
+		},
+		{name: "invalid", s: "a: b\n---\na: [", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitYAML(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitYAML() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitYAML() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := tp.TemplateBytes(context.TODO(), tp.getTemplate(context.TODO(), "test"),
+		[]byte(`{{ range splitYAML .Docs }}{{ .metadata.name }} {{ end }}`),
+		map[string]string{"Docs": "metadata:\n  name: cm1\n---\nmetadata:\n  name: cm2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "cm1 cm2 " {
+		t.Errorf("Expecting cm1 cm2 got %s", string(b))
+	}
+}
+
+func Test_fromJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name: "object",
+			s:    `{"zone":"us-east-1a","ids":[1,"two"]}`,
+			want: map[string]interface{}{"zone": "us-east-1a", "ids": []interface{}{float64(1), "two"}},
+		},
+		{name: "string", s: `"value"`, want: "value"},
+		{name: "invalid", s: `{"zone":`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fromJSON(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fromJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fromJSON() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := tp.TemplateBytes(context.TODO(), tp.getTemplate(context.TODO(), "test"),
+		[]byte(`{{ (fromJSON .Annotation).zone }}`),
+		map[string]string{"Annotation": `{"zone":"us-east-1a"}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "us-east-1a" {
+		t.Errorf("Expecting us-east-1a got %s", string(b))
+	}
+}
+
+func Test_randomChoice(t *testing.T) {
+	choices := []string{"us-east-1", "us-west-1", "eu-west-1", "ap-south-1"}
+	got := randomChoice("mycluster", choices)
+	found := false
+	for _, c := range choices {
+		found = found || c == got
+	}
+	if !found {
+		t.Errorf("Expecting one of %v got %s", choices, got)
+	}
+	for i := 0; i < 10; i++ {
+		if c := randomChoice("mycluster", choices); c != got {
+			t.Errorf("Expecting the same choice %s for the same seed got %s", got, c)
+		}
+	}
+	selected := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		selected[randomChoice(fmt.Sprintf("cluster%d", i), choices)] = true
+	}
+	if len(selected) != len(choices) {
+		t.Errorf("Expecting all choices to be selected by different seeds got %v", selected)
+	}
+	if randomChoice("mycluster", nil) != "" {
+		t.Error("Expecting an empty string for no choices")
+	}
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := tp.TemplateBytes(context.TODO(), tp.getTemplate(context.TODO(), "test"),
+		[]byte(`{{ randomChoice "mycluster" (splitList "," "us-east-1,us-west-1,eu-west-1,ap-south-1") }}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != got {
+		t.Errorf("Expecting %s got %s", got, string(b))
+	}
+}
+
+func Test_generatePassword(t *testing.T) {
+	p := generatePassword(64, "mycluster")
+	if len(p) != 64 {
+		t.Errorf("Expecting length 64 got %d", len(p))
+	}
+	if !regexp.MustCompile("^[a-zA-Z0-9]+$").MatchString(p) {
+		t.Errorf("Expecting an alphanumeric password got %s", p)
+	}
+	if generatePassword(64, "mycluster") != p {
+		t.Error("Expecting the same password for the same seed")
+	}
+	if generatePassword(64, "othercluster") == p {
+		t.Error("Expecting a different password for a different seed")
+	}
+	if generatePassword(0, "mycluster") != "" {
+		t.Error("Expecting an empty password for length 0")
+	}
+}
+
+func Test_generateUUID(t *testing.T) {
+	u := generateUUID("mycluster")
+	if !regexp.MustCompile("^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$").MatchString(u) {
+		t.Errorf("Expecting a version 5 UUID got %s", u)
+	}
+	if generateUUID("mycluster") != u {
+		t.Error("Expecting the same UUID for the same seed")
+	}
+	if generateUUID("othercluster") == u {
+		t.Error("Expecting a different UUID for a different seed")
+	}
+}
+
+func Test_toUnstructuredJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       interface{}
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "html characters not escaped",
+			v:    map[string]interface{}{"expr": "a < b && b > c"},
+			want: `{"expr":"a < b && b > c"}`,
+		},
+		{
+			name: "list",
+			v:    []interface{}{"a", 1, true},
+			want: `["a",1,true]`,
+		},
+		{
+			name:    "not marshallable",
+			v:       func() {},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toUnstructuredJSON(tt.v)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("toUnstructuredJSON() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("toUnstructuredJSON() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mustToJSON(t *testing.T) {
+	v := map[string]interface{}{"expr": "a < b", "list": []int{1, 2}}
+	got, err := toUnstructuredJSON(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != `{"expr":"a < b","list":[1,2]}` {
+		t.Errorf("toUnstructuredJSON() = %s", got)
+	}
+	got, err = mustToJSONPretty(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "expr": "a < b",
+  "list": [
+    1,
+    2
+  ]
+}`
+	if got != want {
+		t.Errorf("mustToJSONPretty() = %s, want %s", got, want)
+	}
+	if _, err := toUnstructuredJSON(make(chan int)); err == nil {
+		t.Error("toUnstructuredJSON() expecting an error")
+	}
+	if _, err := mustToJSONPretty(make(chan int)); err == nil {
+		t.Error("mustToJSONPretty() expecting an error")
+	}
+}
+
+func Test_jsonPatch(t *testing.T) {
+	target := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas": 1,
+			"ports":    []interface{}{8080},
+		},
+	}
+	tests := []struct {
+		name    string
+		patch   string
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name:  "replace and add",
+			patch: `[{"op":"replace","path":"/spec/replicas","value":3},{"op":"add","path":"/spec/ports/-","value":9090}]`,
+			want: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"replicas": float64(3),
+					"ports":    []interface{}{float64(8080), float64(9090)},
+				},
+			},
+		},
+		{
+			name:  "remove",
+			patch: `[{"op":"remove","path":"/spec/ports"}]`,
+			want: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"replicas": float64(1),
+				},
+			},
+		},
+		{
+			name:    "invalid patch",
+			patch:   `{"op":"remove"}`,
+			wantErr: true,
+		},
+		{
+			name:    "missing path",
+			patch:   `[{"op":"remove","path":"/spec/notfound"}]`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := jsonPatch(tt.patch, target)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("jsonPatch() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("jsonPatch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_jmesPath(t *testing.T) {
+	data := map[string]interface{}{
+		"clusters": []interface{}{
+			map[string]interface{}{"name": "cluster1", "region": "us-east"},
+			map[string]interface{}{"name": "cluster2", "region": "eu-west"},
+		},
+	}
+	tests := []struct {
+		name       string
+		expression string
+		want       interface{}
+		wantErr    bool
+	}{
+		{
+			name:       "projection",
+			expression: "clusters[*].name",
+			want:       []interface{}{"cluster1", "cluster2"},
+		},
+		{
+			name:       "filter",
+			expression: "clusters[?region=='eu-west'].name | [0]",
+			want:       "cluster2",
+		},
+		{
+			name:       "not found",
+			expression: "missing.field",
+			want:       nil,
+		},
+		{
+			name:       "invalid expression",
+			expression: "clusters[",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := jmesPath(tt.expression, data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("jmesPath() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("jmesPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_lookupConfigMapAndSecret(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "mycm", Namespace: "myns"},
+			Data:       map[string]string{"image": "quay.io/myimage:1.0"},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "mysecret", Namespace: "myns"},
+			Data:       map[string][]byte{"password": []byte("mypassword")},
+		},
+	)
+	tests := []struct {
+		name    string
+		options *Options
+		tmpl    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "configmap",
+			options: &Options{KubeClient: client},
+			tmpl:    `{{ lookupConfigMap "myns" "mycm" "image" }}`,
+			want:    "quay.io/myimage:1.0",
+		},
+		{
+			name:    "secret",
+			options: &Options{KubeClient: client},
+			tmpl:    `{{ lookupSecret "myns" "mysecret" "password" }}`,
+			want:    "mypassword",
+		},
+		{
+			name:    "missing key",
+			options: &Options{KubeClient: client},
+			tmpl:    `{{ lookupSecret "myns" "mysecret" "user" }}`,
+			wantErr: true,
+		},
+		{
+			name:    "missing configmap",
+			options: &Options{KubeClient: client},
+			tmpl:    `{{ lookupConfigMap "myns" "notfound" "image" }}`,
+			wantErr: true,
+		},
+		{
+			name:    "no client",
+			options: &Options{},
+			tmpl:    `{{ lookupConfigMap "myns" "mycm" "image" }}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{}), WithOptions(tt.options))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := tp.TemplateBytes(context.TODO(), tp.getTemplate(context.TODO(), tt.name), []byte(tt.tmpl), nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TemplateBytes() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("TemplateBytes() = %s, want %s", string(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_kubeResourceBySelector(t *testing.T) {
+	cm1 := newUnstructured("v1", "ConfigMap", "myns", "cm1")
+	cm1.SetLabels(map[string]string{"app": "myapp"})
+	cm2 := newUnstructured("v1", "ConfigMap", "myns", "cm2")
+	cm2.SetLabels(map[string]string{"app": "otherapp"})
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), cm1, cm2)
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/configmap": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: names
+  namespace: myns
+data:
+{{- range kubeResourceBySelector "v1" "ConfigMap" "myns" "app=myapp" }}
+  {{ .metadata.name }}: {{ len (kubeResourceBySelector "v1" "ConfigMap" "myns" "app=myapp") | quote }}
+{{- end }}`,
+	}), WithOptions(&Options{DynamicClient: client}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _, _ := unstructured.NestedStringMap(us[0].Object, "data")
+	if !reflect.DeepEqual(data, map[string]string{"cm1": "1"}) {
+		t.Errorf("Expecting data map[cm1:1] got %v", data)
+	}
+	if len(client.Actions()) != 1 {
+		t.Errorf("Expecting 1 list action got %d", len(client.Actions()))
+	}
+	if _, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.Actions()) != 2 {
+		t.Errorf("Expecting the cache to be reset between renderings, got %d actions", len(client.Actions()))
+	}
+	tp, err = NewTemplateProcessor(NewTestReader(map[string]string{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tp.kubeResourceBySelector(context.TODO(), "v1", "ConfigMap", "myns", "app=myapp"); err == nil {
+		t.Error("Expecting an error without DynamicClient")
+	}
+}
+
+func TestTemplateProcessor_renderTemplate(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/configmap": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: myconfigmap
+  namespace: myns
+data:
+{{ renderTemplate (printf "parts/%s" .Part) . | indent 2 }}`,
+		"parts/small": `size: small`,
+		"parts/large": `size: {{ .Size }}`,
+		"loop/self":   `{{ renderTemplate "loop/self" . }}`,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		values  map[string]string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "small",
+			values: map[string]string{"Part": "small"},
+			want:   "small",
+		},
+		{
+			name:   "large",
+			values: map[string]string{"Part": "large", "Size": "xl"},
+			want:   "xl",
+		},
+		{
+			name:    "missing asset",
+			values:  map[string]string{"Part": "medium"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TemplateResourcesInPathUnstructured() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			size, _, _ := unstructured.NestedString(us[0].Object, "data", "size")
+			if size != tt.want {
+				t.Errorf("Expecting size %s got %s", tt.want, size)
+			}
+		})
+	}
+	if _, err := tp.TemplateResource(context.TODO(), "loop/self", nil); err == nil {
+		t.Error("Expecting an error for an infinite recursion")
+	}
+}
+
+func TestTemplateProcessor_httpGet(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/digest":
+			fmt.Fprint(w, "sha256:1234")
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/configmap": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: myconfigmap
+  namespace: myns
+data:
+  digest: {{ httpGet (printf "%s/digest" .URL) | quote }}
+  cached: {{ httpGet (printf "%s/digest" .URL) | quote }}`,
+	}), WithOptions(&Options{HTTPClient: server.Client()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := struct{ URL string }{URL: server.URL}
+	us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _, _ := unstructured.NestedStringMap(us[0].Object, "data")
+	if !reflect.DeepEqual(data, map[string]string{"digest": "sha256:1234", "cached": "sha256:1234"}) {
+		t.Errorf("Unexpected data %v", data)
+	}
+	if requests != 1 {
+		t.Errorf("Expecting 1 request got %d", requests)
+	}
+	if _, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, values); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Errorf("Expecting the cache to be reset between renderings, got %d requests", requests)
+	}
+	if _, err := tp.httpGet(context.TODO(), server.URL+"/notfound"); err == nil {
+		t.Error("Expecting an error for a not found url")
+	}
+	tp, err = NewTemplateProcessor(NewTestReader(map[string]string{}), WithOptions(&Options{HTTPGetTimeout: 50 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tp.httpGet(context.TODO(), server.URL+"/slow"); err == nil {
+		t.Error("Expecting a timeout error")
+	}
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	if _, err := tp.httpGet(ctx, server.URL+"/digest"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expecting context.Canceled got %v", err)
+	}
+}
+
+func TestTemplateProcessor_RegisterFuncs(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/configmap": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ shout .Name }}
+  namespace: myns`,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tp.RegisterFuncs(template.FuncMap{"shout": strings.ToUpper}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := tp.TemplateResource(context.TODO(), "test/configmap", map[string]string{"Name": "myname"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "name: MYNAME") {
+		t.Errorf("Expecting the registered function to be called, got %s", string(b))
+	}
+	b, err = tp.TemplateBytes(context.TODO(), template.New("test"), []byte(`{{ shout "hi" }}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "HI" {
+		t.Errorf("Expecting HI got %s", string(b))
+	}
+	if err := tp.RegisterFuncs(template.FuncMap{"shout": strings.ToLower}); err != nil {
+		t.Errorf("Expecting a registered function to be replaceable, got %v", err)
+	}
+	tests := []struct {
+		name string
+		fm   template.FuncMap
+	}{
+		{name: "toYaml", fm: template.FuncMap{"toYaml": strings.ToUpper}},
+		{name: "sprig", fm: template.FuncMap{"indent": strings.ToUpper}},
+		{name: "text/template", fm: template.FuncMap{"printf": strings.ToUpper}},
+		{name: "processor", fm: template.FuncMap{"renderTemplate": strings.ToUpper}},
+		{name: "include", fm: template.FuncMap{"include": strings.ToUpper}},
+		{name: "invalid", fm: template.FuncMap{"notAFunction": "string"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tp.RegisterFuncs(tt.fm); err == nil {
+				t.Error("Expecting an error")
+			}
+		})
+	}
+	if _, ok := tp.funcMap["notAFunction"]; ok {
+		t.Error("Expecting the invalid function not to be registered")
+	}
+}
+
+func TestTemplateProcessor_processorFuncNames(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm := tp.processorFuncMap(context.TODO())
+	if len(fm) != len(processorFuncNames) {
+		t.Errorf("Expecting %d functions got %d", len(processorFuncNames), len(fm))
+	}
+	for _, name := range processorFuncNames {
+		if _, ok := fm[name]; !ok {
+			t.Errorf("Expecting function %s in processorFuncMap", name)
+		}
+	}
+}
+
+func TestTemplateProcessor_RegisterFuncsConcurrent(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/configmap": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Name }}
+  namespace: myns`,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			if err := tp.RegisterFuncs(template.FuncMap{fmt.Sprintf("f%d", i): strings.ToUpper}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			if _, err := tp.TemplateResource(context.TODO(), "test/configmap", map[string]string{"Name": "myname"}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(tp.registeredFuncs()) != 10 {
+		t.Errorf("Expecting 10 registered functions got %d", len(tp.registeredFuncs()))
+	}
+}
@@ -4,18 +4,31 @@ package templateprocessor
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	goerr "errors"
 	"fmt"
+	"io"
+	"net/http"
 	"path/filepath"
 	"regexp"
+	goruntime "runtime"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
 
 	"github.com/Masterminds/sprig/v3"
 	"github.com/ghodss/yaml"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog"
 )
 
@@ -36,6 +49,16 @@ type TemplateProcessor struct {
 	reader TemplateReader
 	//Options to configure the TemplateProcessor
 	options *Options
+	//warnings raised during the last rendering
+	warnings []error
+	//mutex protects the warnings as renderings can run concurrently
+	mutex *sync.Mutex
+	//funcMap the functions registered with RegisterFuncs
+	funcMap template.FuncMap
+	//funcMapMutex protects the funcMap as functions can be registered while renderings run
+	funcMapMutex *sync.RWMutex
+	//excludePatterns the compiled Options.ExcludePatterns
+	excludePatterns []*regexp.Regexp
 }
 
 //TemplateReader defines the needed functions
@@ -59,6 +82,192 @@ type Options struct {
 	CreateUpdateKindsOrder KindsOrder
 	DeleteKindsOrder       KindsOrder
 	MissingKeyType         MissingKeyType
+	//NamePrefix is prepended to the metadata.name of every rendered resource
+	NamePrefix string
+	//NameSuffix is appended to the metadata.name of every rendered resource
+	NameSuffix string
+	//StripNamespacePrefix is removed from the beginning of the namespace of every rendered resource
+	//and from the name of the rendered Namespace resources
+	StripNamespacePrefix string
+	//DeduplicateResources if true only the last occurrence of resources with the same
+	//group, version, kind, namespace and name is kept
+	DeduplicateResources bool
+	//DynamicClient the client used by the options and the template functions requiring an access to the cluster
+	DynamicClient dynamic.Interface
+	//ClusterResourceCountLimit if > 0 and the DynamicClient is set, the rendering fails if
+	//the number of resources of a kind in the cluster plus the rendered ones exceeds the limit
+	ClusterResourceCountLimit int
+	//KubeClient the client used by the lookupConfigMap and lookupSecret template functions
+	//and to check the existence of the Ingress TLS secrets
+	KubeClient kubernetes.Interface
+	//ValidateCronSchedules if true the spec.schedule of the rendered CronJobs is validated
+	ValidateCronSchedules bool
+	//ValidateImageFormat if true the container images of the rendered workloads are validated,
+	//the images must be valid references with an explicit registry
+	ValidateImageFormat bool
+	//LivenessProbeInjector returns the liveness probe to inject in the containers of a rendered workload
+	//which don't have one, nothing is injected if it returns nil
+	LivenessProbeInjector func(*unstructured.Unstructured) *corev1.Probe
+	//StartupProbeInjector returns the startup probe to inject in the containers of a rendered workload
+	//which don't have one, nothing is injected if it returns nil
+	StartupProbeInjector func(*unstructured.Unstructured) *corev1.Probe
+	//MaxStartupSeconds the maximum startup time of the applications,
+	//an injected startup probe must not give up before
+	MaxStartupSeconds int
+	//ValidatePrometheusRules if true the expressions of the rendered PrometheusRules are parsed
+	ValidatePrometheusRules bool
+	//ValidateHPATargets if true the scaleTargetRef of the rendered HorizontalPodAutoscalers
+	//must reference a rendered resource
+	ValidateHPATargets bool
+	//ValidateServiceSelectors if true a warning is raised for each rendered Service
+	//whose selector doesn't match the pods of any rendered workload
+	ValidateServiceSelectors bool
+	//MaxResourceNameLength if > 0, the maximum length of the name of a rendered resource, 253 for a DNS subdomain.
+	//The names of the kinds requiring a DNS label are then also limited to 63 characters.
+	MaxResourceNameLength int
+	//MaxAnnotationValueLength if > 0, the maximum length of an annotation value of a rendered resource
+	MaxAnnotationValueLength int
+	//MaxAnnotationsSize if > 0, the maximum total size of the annotation keys and values of a rendered resource.
+	//The Kubernetes API server limit is 256KB.
+	MaxAnnotationsSize int
+	//AutoServiceMonitor if true a ServiceMonitor is generated for each rendered Service
+	//annotated with EnableMonitoringAnnotation: "true"
+	AutoServiceMonitor bool
+	//ServiceMonitorLabels the labels added to the generated ServiceMonitors
+	ServiceMonitorLabels map[string]string
+	//AutoPDB if true a PodDisruptionBudget is generated for each rendered Deployment with more than one replica
+	AutoPDB bool
+	//PDBMinAvailable the minAvailable of the generated PodDisruptionBudgets, default 1
+	PDBMinAvailable *intstr.IntOrString
+	//AutoVPA if true a VerticalPodAutoscaler in Auto mode is generated for each rendered Deployment
+	//and StatefulSet not already targeted by a rendered VerticalPodAutoscaler
+	AutoVPA bool
+	//MaxResourcesPerNamespace if > 0, the maximum number of rendered resources in a namespace
+	MaxResourcesPerNamespace int
+	//AutoVirtualService if true an Istio VirtualService is generated for each rendered Service
+	//annotated with templateprocessor.io/expose-via-istio: "true"
+	AutoVirtualService bool
+	//VirtualServiceGateway the gateway of the generated VirtualServices
+	VirtualServiceGateway string
+	//AutoNetworkPolicyFromLabels if true a NetworkPolicy is generated for each rendered Deployment,
+	//allowing the ingress on the container ports from the pods matching NetworkPolicySourceLabels
+	AutoNetworkPolicyFromLabels bool
+	//NetworkPolicySourceLabels the labels of the pods allowed by the generated NetworkPolicies,
+	//all pods of the namespace are allowed if empty
+	NetworkPolicySourceLabels map[string]string
+	//AggregateClusterRoles if true the rules of the rendered ClusterRoles matching the aggregationRule
+	//of a rendered ClusterRole are inlined in that ClusterRole
+	AggregateClusterRoles bool
+	//ValidateIngressTLS if true the TLS secrets of the rendered Ingresses must be rendered
+	//or exist in the cluster
+	ValidateIngressTLS bool
+	//AnalyzeRBAC if true a RBACWildcardWarning is raised for each rule of the rendered Roles
+	//and ClusterRoles granting all verbs or all resources
+	AnalyzeRBAC bool
+	//ImmutableConfigMapVersioning if true the names of the rendered ConfigMaps and Secrets are suffixed
+	//with a hash of their content, they are marked immutable and the references in the rendered workloads updated
+	ImmutableConfigMapVersioning bool
+	//SanitizeLabels if true the invalid label values are replaced by a hash of the value and a warning is raised
+	SanitizeLabels bool
+	//RevisionHistoryLimit if set, the spec.revisionHistoryLimit of the rendered Deployments and StatefulSets
+	//which don't specify it
+	RevisionHistoryLimit *int32
+	//ValidateCrossReferences if true the ServiceAccounts, Secrets and ConfigMaps referenced by the rendered
+	//RoleBindings, ServiceAccounts and workload volumes must be rendered
+	ValidateCrossReferences bool
+	//ResourceVersionMigrations the migrations applied to the rendered resources
+	ResourceVersionMigrations []ResourceVersionMigration
+	//MaxConfigMapDataSize if > 0, the maximum size in bytes of the data of a rendered ConfigMap.
+	//Kubernetes rejects the ConfigMaps larger than 1MiB.
+	MaxConfigMapDataSize int64
+	//InjectPodAntiAffinity if true a preferred pod anti-affinity on the pod labels is added
+	//to the rendered Deployments and StatefulSets without affinity
+	InjectPodAntiAffinity bool
+	//AntiAffinityTopologyKey the topology key of the injected pod anti-affinity, default kubernetes.io/hostname
+	AntiAffinityTopologyKey string
+	//LockAnnotation if set and the DynamicClient is set, the rendered resources whose live resource
+	//has this annotation set to "locked" are skipped
+	LockAnnotation string
+	//SOPSDecrypt if true the rendered Secrets encrypted with SOPS are decrypted,
+	//the key material is retrieved by the SOPS library from the environment or the KMS
+	SOPSDecrypt bool
+	//ValidatePDBCoverage if true a PDBMissingWarning is raised for each rendered Deployment
+	//with more than one replica not covered by a rendered PodDisruptionBudget
+	ValidatePDBCoverage bool
+	//CELValidations the CEL expressions each rendered resource must satisfy,
+	//a CELValidationError is returned listing the resources failing a validation
+	CELValidations []CELValidation
+	//HTTPClient the client used by the httpGet template function, if nil the http.DefaultClient is used
+	HTTPClient *http.Client
+	//HTTPGetTimeout the timeout of the httpGet template function requests, default 30s
+	HTTPGetTimeout time.Duration
+	//NormalizeGVK if true the resources using a deprecated apiVersion are normalized to the preferred apiVersion
+	//of their kind and a DeprecatedAPIWarning is raised. The spec.selector of the deprecated workloads is defaulted
+	//from their pod template labels and the v1beta1 Ingresses are converted to networking.k8s.io/v1.
+	NormalizeGVK bool
+	//InjectServiceAccountToken if true a projected service account token volume is added to the pod templates
+	//without one, so the workloads use bound tokens instead of the auto-mounted long-lived tokens
+	InjectServiceAccountToken bool
+	//TokenExpirationSeconds the expiry of the injected service account token, default the API server default
+	TokenExpirationSeconds *int64
+	//RuntimeClassName if set, the spec.runtimeClassName of the rendered pod templates which don't specify it
+	RuntimeClassName *string
+	//PodOverhead if set, the spec.overhead of the rendered pod templates which don't specify it
+	PodOverhead *corev1.ResourceList
+	//InjectGenerationTimestamp if true the GeneratedAtAnnotation is set on each rendered resource
+	//with the time of the rendering
+	InjectGenerationTimestamp bool
+	//GenerationTimestampFormat the time layout of the GeneratedAtAnnotation, default time.RFC3339
+	GenerationTimestampFormat string
+	//MaxResourceAge if set with the DynamicClient option, a ResourceTooOldWarning is raised for each
+	//rendered resource whose live resource is older than MaxResourceAge
+	MaxResourceAge time.Duration
+	//NormalizeResourceNames if true the names and namespaces of the rendered resources are normalized
+	//to DNS-1123 labels and a NameNormalizedWarning is raised
+	NormalizeResourceNames bool
+	//RenderRateLimit if set, a token of the limiter is waited for before reading, parsing and executing each template,
+	//the wait stops when the context of the rendering is done
+	RenderRateLimit *rate.Limiter
+	//MoveBase64ToBinaryData if true the ConfigMap data values which are the base64 encoding of non UTF-8 bytes,
+	//or whose keys are listed in the BinaryDataKeysAnnotation, are moved to the binaryData of the ConfigMap
+	MoveBase64ToBinaryData bool
+	//MaxConcurrency the number of templates rendered in parallel by TemplateResourcesConcurrent,
+	//default runtime.NumCPU()
+	MaxConcurrency int
+	//DefaultSecretType if set, the type of the rendered Secrets which don't specify one.
+	//It must be a Secret type defined by Kubernetes.
+	DefaultSecretType corev1.SecretType
+	//InheritHelpers if true the _helpers.tpl of the parent directories of a template are also loaded,
+	//the definitions of a directory override the ones of its parents
+	InheritHelpers bool
+	//ValidateOutput if true the output of each template is validated with ValidateTemplateOutput
+	ValidateOutput bool
+	//ValidateCronJobNextRun if true a CronJobScheduleWarning is raised for each rendered CronJob
+	//whose next run is more than CronJobMaxNextRunInterval in the future
+	ValidateCronJobNextRun bool
+	//CronJobMaxNextRunInterval the maximum interval until the next run of a CronJob, default 31 days
+	CronJobMaxNextRunInterval time.Duration
+	//ValidatePriorityClasses if true the priorityClassName of the rendered pod templates must be a built-in
+	//PriorityClass, be rendered or, when the DynamicClient option is set, exist in the cluster
+	ValidatePriorityClasses bool
+	//TemplateVersion if set, injected as TemplateVersionAnnotation in each rendered resource
+	TemplateVersion string
+	//WaveAnnotation if set, the annotation whose integer value is the wave of a resource (ie: fluxcd.io/apply-wave).
+	//The resources of the same kind are sorted by wave, then by namespace and name. The resources without
+	//the annotation are in wave 0 and the waves are deleted in the reverse order.
+	//The SyncWaveAnnotation is always sorted before the kind.
+	WaveAnnotation string
+	//ExcludePatterns regexps matched against the asset names, the matching assets are excluded
+	//in addition to the excluded parameter of the AssetNamesInPath and related methods
+	ExcludePatterns []string
+	//DetectResourceCycles if true a ResourceCycleError is returned if the rendered resources
+	//reference each other in a cycle
+	DetectResourceCycles bool
+	//InjectManagedAnnotation if true the ManagedAnnotation is set on each rendered resource,
+	//to allow GeneratePruneList and CompareToLiveCluster to find them once they are not rendered anymore
+	InjectManagedAnnotation bool
+	//AuditLog if set, a JSON AuditRecord is written for each rendered resource
+	AuditLog io.Writer
 }
 
 //SortType ...
@@ -161,18 +370,86 @@ var defaultDeleteKindsOrder KindsOrder = []string{
 	"Namespace",
 }
 
+//TemplateProcessorOption sets an option of the TemplateProcessor
+type TemplateProcessorOption func(*Options)
+
+//WithOptions sets all options from an Options struct, the options set before are overwritten
+//so it must be the first TemplateProcessorOption.
+func WithOptions(options *Options) TemplateProcessorOption {
+	return func(o *Options) {
+		if options != nil {
+			*o = *options
+		}
+	}
+}
+
+//WithKindsOrder sets the sort order, create/update or delete, of the rendered resources
+func WithKindsOrder(kindsOrder SortType) TemplateProcessorOption {
+	return func(o *Options) {
+		o.KindsOrder = kindsOrder
+	}
+}
+
+//WithCreateUpdateKindsOrder overrides the default kind order used to sort the resources to create or update
+func WithCreateUpdateKindsOrder(kindsOrder KindsOrder) TemplateProcessorOption {
+	return func(o *Options) {
+		o.CreateUpdateKindsOrder = kindsOrder
+	}
+}
+
+//WithDeleteKindsOrder overrides the default kind order used to sort the resources to delete
+func WithDeleteKindsOrder(kindsOrder KindsOrder) TemplateProcessorOption {
+	return func(o *Options) {
+		o.DeleteKindsOrder = kindsOrder
+	}
+}
+
+//WithDelimiter sets the regexp splitting a template in multiple resources, default KubernetesYamlsDelimiter
+func WithDelimiter(delimiter string) TemplateProcessorOption {
+	return func(o *Options) {
+		o.Delimiter = delimiter
+	}
+}
+
+//WithDelimiterString sets the string matched by the delimiter regexp, default KubernetesYamlsDelimiterString
+func WithDelimiterString(delimiterString string) TemplateProcessorOption {
+	return func(o *Options) {
+		o.DelimiterString = delimiterString
+	}
+}
+
+//WithMissingKeyType sets the behavior of the templates on a missing key, default MissingKeyTypeZero
+func WithMissingKeyType(missingKeyType MissingKeyType) TemplateProcessorOption {
+	return func(o *Options) {
+		o.MissingKeyType = missingKeyType
+	}
+}
+
+//NewTemplateProcessorFromOptions creates a new applier from an Options struct
+//
+//Deprecated: use NewTemplateProcessor with the TemplateProcessorOption helpers or WithOptions
+func NewTemplateProcessorFromOptions(
+	reader TemplateReader,
+	options *Options,
+) (*TemplateProcessor, error) {
+	return NewTemplateProcessor(reader, WithOptions(options))
+}
+
 //NewTemplateProcessor creates a new applier
 //reader: The TemplateReader to use to read the templates
-//options: The possible options for the templateprocessor
+//opts: The options for the templateprocessor
 func NewTemplateProcessor(
 	reader TemplateReader,
-	options *Options,
+	opts ...TemplateProcessorOption,
 ) (*TemplateProcessor, error) {
 	if reader == nil {
 		return nil, goerr.New("reader is nil")
 	}
-	if options == nil {
-		options = &Options{}
+	options := &Options{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(options)
+		}
 	}
 	if options.CreateUpdateKindsOrder == nil {
 		options.CreateUpdateKindsOrder = defaultCreateUpdateKindsOrder
@@ -192,6 +469,9 @@ func NewTemplateProcessor(
 	if options.MissingKeyType == "" {
 		options.MissingKeyType = MissingKeyTypeZero
 	}
+	if options.DefaultSecretType != "" && !knownSecretTypes[options.DefaultSecretType] {
+		return nil, fmt.Errorf("options.DefaultSecretType %s is not a known Secret type", options.DefaultSecretType)
+	}
 	re, err := regexp.Compile(options.Delimiter)
 	if err != nil {
 		return nil, err
@@ -203,9 +483,19 @@ func NewTemplateProcessor(
 				options.Delimiter,
 				options.DelimiterString)
 	}
+	excludePatterns := make([]*regexp.Regexp, len(options.ExcludePatterns))
+	for i, p := range options.ExcludePatterns {
+		excludePatterns[i], err = regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("options.ExcludePatterns %s is not a valid regexp: %v", p, err)
+		}
+	}
 	return &TemplateProcessor{
-		reader:  reader,
-		options: options,
+		reader:          reader,
+		options:         options,
+		mutex:           &sync.Mutex{},
+		funcMapMutex:    &sync.RWMutex{},
+		excludePatterns: excludePatterns,
 	}, nil
 }
 
@@ -221,13 +511,16 @@ func (tp *TemplateProcessor) SetCreateUpdateOrder() {
 
 //TemplateResources render the given templates with the provided values
 //The resources are not sorted and returned in the same template provided order
+//The rendering stops and ctx.Err() is returned as soon as the context is done.
 func (tp *TemplateProcessor) TemplateResources(
+	ctx context.Context,
 	templateNames []string,
 	values interface{},
 ) ([][]byte, error) {
+	ctx, _ = withRenderState(ctx)
 	results := make([][]byte, 0)
 	for _, templateName := range templateNames {
-		result, err := tp.TemplateResource(templateName, values)
+		result, err := tp.TemplateResource(ctx, templateName, values)
 		if err != nil {
 			return nil, err
 		}
@@ -238,16 +531,102 @@ func (tp *TemplateProcessor) TemplateResources(
 	return results, nil
 }
 
+//TemplateResourcesConcurrent renders the given templates with the provided values like TemplateResources
+//but renders up to Options.MaxConcurrency templates in parallel. The results are in the order of templateNames.
+//The rendering stops at the first error which is returned.
+func (tp *TemplateProcessor) TemplateResourcesConcurrent(
+	ctx context.Context,
+	templateNames []string,
+	values interface{},
+) ([][]byte, error) {
+	workers := tp.options.MaxConcurrency
+	if workers <= 0 {
+		workers = goruntime.NumCPU()
+	}
+	ctx, _ = withRenderState(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	rendered := make([][]byte, len(templateNames))
+	indexes := make(chan int)
+	var firstErr error
+	var once sync.Once
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				b, err := tp.TemplateResource(ctx, templateNames[i], values)
+				if err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+				rendered[i] = b
+			}
+		}()
+	}
+dispatch:
+	for i := range templateNames {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	results := make([][]byte, 0, len(rendered))
+	for _, b := range rendered {
+		if b != nil {
+			results = append(results, b)
+		}
+	}
+	return results, nil
+}
+
 //TemplateResource render the given template with the provided values
+//ctx.Err() is returned if the context is done before the end of the rendering.
 func (tp *TemplateProcessor) TemplateResource(
+	ctx context.Context,
 	templateName string,
 	values interface{},
 ) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	klog.V(5).Infof("templateName: %s", templateName)
-	if filepath.Base(templateName) == "_helpers.tpl" {
+	if filepath.Base(templateName) == helpersFileName {
 		return nil, nil
 	}
-	h, _ := tp.reader.Asset(filepath.Join(filepath.Dir(templateName), "_helpers.tpl"))
+	ctx, _ = withRenderState(ctx)
+	if tp.options.RenderRateLimit != nil {
+		if err := tp.options.RenderRateLimit.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	tmpl := tp.getTemplate(ctx, templateName)
+	var h []byte
+	if tp.options.InheritHelpers {
+		helpers := tp.collectHelpers(templateName)
+		//The parent helpers are parsed separately so the local definitions override them
+		for _, ph := range helpers[:len(helpers)-1] {
+			if _, err := tmpl.Funcs(tp.registeredFuncs()).Parse(string(ph.content)); err != nil {
+				return nil, fmt.Errorf("%s: %s", ph.name, err)
+			}
+		}
+		h = helpers[len(helpers)-1].content
+	} else {
+		h, _ = tp.reader.Asset(filepath.Join(filepath.Dir(templateName), helpersFileName))
+	}
 	b, err := tp.reader.Asset(templateName)
 	if err != nil {
 		return nil, err
@@ -255,20 +634,52 @@ func (tp *TemplateProcessor) TemplateResource(
 	klog.V(5).Infof("\nb--->\n%s\n---", string(b))
 	t := append(h, b[:]...)
 	klog.V(5).Infof("\nh+b--->\n%s\n---", string(t))
-	tmpl := tp.getTemplate(templateName)
-	templated, err := tp.TemplateBytes(tmpl, t, values)
+	templated, err := tp.TemplateBytes(ctx, tmpl, t, values)
 	if err != nil && len(h) > 0 {
 		n := countRune(string(h), '\n')
 		err = fmt.Errorf("%s first line is line #%d as a _helpers.tpl file is present", err, n)
 	}
+	if err == nil && tp.options.ValidateOutput {
+		err = tp.ValidateTemplateOutput(templated)
+	}
 	return templated, err
 }
 
-func (tp *TemplateProcessor) getTemplate(templateName string) *template.Template {
+//helpersFileName the file containing the templates definitions shared by the templates of its directory
+const helpersFileName = "_helpers.tpl"
+
+//helpersFile the content of a helpersFileName
+type helpersFile struct {
+	name    string
+	content []byte
+}
+
+//collectHelpers returns the helpersFileName of each directory from the root of the reader to the
+//directory of templateName, the root first and the directory of templateName last.
+//The content of a missing helpersFileName is empty.
+func (tp *TemplateProcessor) collectHelpers(templateName string) []helpersFile {
+	dirs := make([]string, 0)
+	for dir := filepath.Dir(templateName); ; dir = filepath.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+		if dir == "." || dir == string(filepath.Separator) {
+			break
+		}
+	}
+	helpers := make([]helpersFile, len(dirs))
+	for i, dir := range dirs {
+		name := filepath.Join(dir, helpersFileName)
+		content, _ := tp.reader.Asset(name)
+		helpers[i] = helpersFile{name: name, content: content}
+	}
+	return helpers
+}
+
+func (tp *TemplateProcessor) getTemplate(ctx context.Context, templateName string) *template.Template {
 	tmpl := template.New(templateName).
 		Option(string(tp.options.MissingKeyType)).
 		Funcs(ApplierFuncMap())
 	tmpl = tmpl.Funcs(TemplateFuncMap(tmpl)).
+		Funcs(tp.processorFuncMap(ctx)).
 		Funcs(sprig.TxtFuncMap())
 	return tmpl
 }
@@ -283,19 +694,22 @@ func countRune(s string, r rune) int {
 	return count
 }
 
-//TemplateBytes render the given template with the provided values
+//TemplateBytes render the given template with the provided values and the functions registered with RegisterFuncs
+//ctx.Err() is returned as soon as the context is done, without waiting for the end of the execution
+//of the template.
 func (tp *TemplateProcessor) TemplateBytes(
+	ctx context.Context,
 	tmpl *template.Template,
 	b []byte,
 	values interface{},
 ) ([]byte, error) {
 	var buf bytes.Buffer
-	tmpl, err := tmpl.Parse(string(b))
+	tmpl, err := tmpl.Funcs(tp.registeredFuncs()).Parse(string(b))
 	if err != nil {
 		return nil, err
 	}
 
-	err = tmpl.Execute(&buf, values)
+	err = executeTemplate(ctx, tmpl, &buf, values)
 	if err != nil {
 		return nil, err
 	}
@@ -309,15 +723,40 @@ func (tp *TemplateProcessor) TemplateBytes(
 	return buf.Bytes(), err
 }
 
+//executeTemplate executes the template and returns ctx.Err() as soon as the context is done.
+//The execution of the template can't be interrupted, when the context is done it goes on in the background
+//and its output is discarded.
+func executeTemplate(ctx context.Context, tmpl *template.Template, w io.Writer, values interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		done <- tmpl.Execute(&buf, values)
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-done:
+		if err != nil {
+			return err
+		}
+		_, err = buf.WriteTo(w)
+		return err
+	}
+}
+
 // TemplateResourcesInPathYaml returns all assets in a path using the provided config.
 // The resources are sorted following the order defined in variable kindsOrder
 func (tp *TemplateProcessor) TemplateResourcesInPathYaml(
+	ctx context.Context,
 	path string,
 	excluded []string,
 	recursive bool,
 	values interface{},
 ) ([][]byte, error) {
-	us, err := tp.TemplateResourcesInPathUnstructured(path, excluded, recursive, values)
+	us, err := tp.TemplateResourcesInPathUnstructured(ctx, path, excluded, recursive, values)
 	if err != nil {
 		return nil, err
 	}
@@ -331,6 +770,50 @@ func (tp *TemplateProcessor) TemplateResourcesInPathYaml(
 	return yamls, nil
 }
 
+//TemplateResourcesInPathJSON returns all assets in a path as JSON documents.
+//The resources are sorted following the order defined in variable kindsOrder
+func (tp *TemplateProcessor) TemplateResourcesInPathJSON(
+	ctx context.Context,
+	path string,
+	excluded []string,
+	recursive bool,
+	values interface{},
+) ([][]byte, error) {
+	us, err := tp.TemplateResourcesInPathUnstructured(ctx, path, excluded, recursive, values)
+	if err != nil {
+		return nil, err
+	}
+	return ToJSONsUnstructured(us)
+}
+
+//TemplateResourcesAsJSONLines returns all assets in a path in the JSON Lines format,
+//each resource is written as a single line JSON object followed by a newline.
+//The resources are sorted following the order defined in variable kindsOrder
+func (tp *TemplateProcessor) TemplateResourcesAsJSONLines(
+	ctx context.Context,
+	path string,
+	excluded []string,
+	recursive bool,
+	values interface{},
+) ([]byte, error) {
+	us, err := tp.TemplateResourcesInPathUnstructured(ctx, path, excluded, recursive, values)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for _, u := range us {
+		j, err := u.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Compact(&buf, j); err != nil {
+			return nil, err
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
 //ToYAMLsUnstructured converts []*unstructured.Unstructured to [][]byte yaml format
 func ToYAMLsUnstructured(us []*unstructured.Unstructured) ([][]byte, error) {
 	results := make([][]byte, len(us))
@@ -345,6 +828,19 @@ func ToYAMLsUnstructured(us []*unstructured.Unstructured) ([][]byte, error) {
 	return results, nil
 }
 
+//ToJSONsUnstructured converts []*unstructured.Unstructured to [][]byte json format
+func ToJSONsUnstructured(us []*unstructured.Unstructured) ([][]byte, error) {
+	results := make([][]byte, len(us))
+	for i, u := range us {
+		j, err := u.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		results[i] = j
+	}
+	return results, nil
+}
+
 //ToYAMLUnstructured converts *unstructured.Unstructured to []byte yaml format
 func ToYAMLUnstructured(u *unstructured.Unstructured) ([]byte, error) {
 	j, err := u.MarshalJSON()
@@ -377,7 +873,7 @@ func (tp *TemplateProcessor) AssetNamesInPath(
 	}
 	klog.V(5).Infof("names: %v", names)
 	for _, name := range names {
-		if isExcluded(name, excluded) {
+		if isExcluded(name, excluded, tp.excludePatterns) {
 			continue
 		}
 		klog.V(5).Infof("filepath.Dir(%s)=%s", name, filepath.Dir(name))
@@ -396,15 +892,17 @@ func (tp *TemplateProcessor) AssetNamesInPath(
 	return results, nil
 }
 
-func isExcluded(name string, excluded []string) bool {
-	if excluded == nil {
-		return false
-	}
+func isExcluded(name string, excluded []string, patterns []*regexp.Regexp) bool {
 	for _, e := range excluded {
 		if e == name {
 			return true
 		}
 	}
+	for _, p := range patterns {
+		if p.MatchString(name) {
+			return true
+		}
+	}
 	return false
 }
 
@@ -432,7 +930,9 @@ func (tp *TemplateProcessor) Assets(
 
 // TemplateResourcesInPathUnstructured returns all assets in a []unstructured.Unstructured and sort them
 // The []unstructured.Unstructured are sorted following the order defined in variable kindsOrder
+// The rendering stops and ctx.Err() is returned as soon as the context is done.
 func (tp *TemplateProcessor) TemplateResourcesInPathUnstructured(
+	ctx context.Context,
 	path string,
 	excluded []string,
 	recursive bool,
@@ -442,31 +942,186 @@ func (tp *TemplateProcessor) TemplateResourcesInPathUnstructured(
 		return nil, err
 	}
 	klog.V(5).Infof("templateNames: %v", templateNames)
-	us, err = tp.TemplateResourcesUnstructured(templateNames, values)
+	us, err = tp.TemplateResourcesUnstructured(ctx, templateNames, values)
 	if err != nil {
 		return nil, err
 	}
 	return us, nil
 }
 
+//TemplateResourcesInPathWithAuditWriter renders all assets in a path and returns them as a list of unstructured
+//like TemplateResourcesInPathUnstructured, it writes a JSON TemplateAuditEvent in the auditWriter
+//for each rendered template.
+func (tp *TemplateProcessor) TemplateResourcesInPathWithAuditWriter(
+	ctx context.Context,
+	path string,
+	excluded []string,
+	recursive bool,
+	values interface{},
+	auditWriter io.Writer) ([]*unstructured.Unstructured, error) {
+	templateNames, err := tp.AssetNamesInPath(path, excluded, recursive)
+	if err != nil {
+		return nil, err
+	}
+	renderedTemplates, us, err := tp.renderUnstructured(ctx, templateNames, values)
+	if err != nil {
+		return nil, err
+	}
+	if err := tp.writeAuditLog(renderedTemplates, us, values); err != nil {
+		return nil, err
+	}
+	if err := writeTemplateAuditEvents(auditWriter, renderedTemplates); err != nil {
+		return nil, err
+	}
+	return us, nil
+}
+
+//FindUnusedTemplates renders all assets in a path and returns the names of the assets
+//which didn't render any resource. The _helpers.tpl are not returned.
+func (tp *TemplateProcessor) FindUnusedTemplates(
+	ctx context.Context,
+	path string,
+	excluded []string,
+	recursive bool,
+	values interface{}) ([]string, error) {
+	templateNames, err := tp.AssetNamesInPath(path, excluded, recursive)
+	if err != nil {
+		return nil, err
+	}
+	renderedTemplates, err := tp.renderTemplates(ctx, templateNames, values)
+	if err != nil {
+		return nil, err
+	}
+	unused := make([]string, 0)
+	for _, r := range renderedTemplates {
+		if len(r.us) == 0 && filepath.Base(r.templateName) != helpersFileName {
+			unused = append(unused, r.templateName)
+		}
+	}
+	return unused, nil
+}
+
 // TemplateResourcesUnstructured returns all assets in a []unstructured.Unstructured and sort them
 // The []unstructured.Unstructured are sorted following the order defined in variable kindsOrder
+// The rendering stops and ctx.Err() is returned as soon as the context is done.
 func (tp *TemplateProcessor) TemplateResourcesUnstructured(
+	ctx context.Context,
 	templateNames []string,
 	values interface{}) (us []*unstructured.Unstructured, err error) {
-	templatedAssets, err := tp.TemplateResources(templateNames, values)
+	renderedTemplates, us, err := tp.renderUnstructured(ctx, templateNames, values)
 	if err != nil {
 		return nil, err
 	}
-	us, err = tp.BytesArrayToUnstructured(templatedAssets)
+	if err := tp.writeAuditLog(renderedTemplates, us, values); err != nil {
+		return nil, err
+	}
+	return us, nil
+}
+
+//DuplicateResourceError is returned when two rendered resources have the same key
+type DuplicateResourceError struct {
+	Key string
+}
+
+func (e *DuplicateResourceError) Error() string {
+	return fmt.Sprintf("duplicate resource %s", e.Key)
+}
+
+//TemplateResourcesUnstructuredMap returns all assets in a map keyed by "<kind>/<namespace>/<name>",
+//the namespace of the cluster-scoped resources is "_".
+//A DuplicateResourceError is returned if two resources have the same key
+func (tp *TemplateProcessor) TemplateResourcesUnstructuredMap(
+	ctx context.Context,
+	templateNames []string,
+	values interface{}) (map[string]*unstructured.Unstructured, error) {
+	us, err := tp.TemplateResourcesUnstructured(ctx, templateNames, values)
 	if err != nil {
 		return nil, err
 	}
+	results := make(map[string]*unstructured.Unstructured, len(us))
+	for _, u := range us {
+		namespace := u.GetNamespace()
+		if namespace == "" {
+			namespace = "_"
+		}
+		key := fmt.Sprintf("%s/%s/%s", u.GetKind(), namespace, u.GetName())
+		if _, ok := results[key]; ok {
+			return nil, &DuplicateResourceError{Key: key}
+		}
+		results[key] = u
+	}
+	return results, nil
+}
+
+//renderUnstructured renders the templates, post-processes and sorts the resulting resources.
+//It returns also the rendered templates to allow tracing each resource back to its template
+func (tp *TemplateProcessor) renderUnstructured(
+	ctx context.Context,
+	templateNames []string,
+	values interface{}) ([]renderedTemplate, []*unstructured.Unstructured, error) {
+	rs := newRenderState()
+	ctx = context.WithValue(ctx, renderStateKey{}, rs)
+	defer func() { tp.setWarnings(rs.getWarnings()) }()
+	renderedTemplates, err := tp.renderTemplates(ctx, templateNames, values)
+	if err != nil {
+		return nil, nil, err
+	}
+	us := make([]*unstructured.Unstructured, 0)
+	for _, r := range renderedTemplates {
+		us = append(us, r.us...)
+	}
+	us, err = tp.postRender(ctx, rs, us)
+	if err != nil {
+		return nil, nil, err
+	}
 	tp.sortUnstructuredForApply(us)
+	us, err = orderAfterAnnotations(us)
+	if err != nil {
+		return nil, nil, err
+	}
 	for _, u := range us {
 		klog.V(5).Infof("TemplateResourcesUnstructured sorted u:%s/%s", u.GetKind(), u.GetName())
 	}
-	return us, nil
+	return renderedTemplates, us, nil
+}
+
+//renderedTemplate holds the result of the rendering of a template
+type renderedTemplate struct {
+	templateName string
+	//rendered the rendered yaml, nil if the template rendered nothing
+	rendered []byte
+	//us the resources contained in the rendered template
+	us       []*unstructured.Unstructured
+	duration time.Duration
+}
+
+//renderTemplates renders each template and converts it to unstructured
+func (tp *TemplateProcessor) renderTemplates(
+	ctx context.Context,
+	templateNames []string,
+	values interface{}) ([]renderedTemplate, error) {
+	results := make([]renderedTemplate, 0, len(templateNames))
+	for _, templateName := range templateNames {
+		start := time.Now()
+		rendered, err := tp.TemplateResource(ctx, templateName, values)
+		if err != nil {
+			return nil, err
+		}
+		us := make([]*unstructured.Unstructured, 0)
+		if rendered != nil {
+			us, err = tp.BytesArrayToUnstructured([][]byte{rendered})
+			if err != nil {
+				return nil, err
+			}
+		}
+		results = append(results, renderedTemplate{
+			templateName: templateName,
+			rendered:     rendered,
+			us:           us,
+			duration:     time.Since(start),
+		})
+	}
+	return results, nil
 }
 
 //BytesArrayToUnstructured transform a [][]byte to an []*unstructured.Unstructured using the TemplateProcessor reader
@@ -480,6 +1135,10 @@ func (tp *TemplateProcessor) BytesArrayToUnstructured(assets [][]byte) (us []*un
 			if err != nil {
 				return nil, err
 			}
+			u, err = tp.decryptSOPSSecret(b, u)
+			if err != nil {
+				return nil, err
+			}
 			if u.Object != nil {
 				us = append(us, u)
 			}
@@ -515,14 +1174,49 @@ func (tp *TemplateProcessor) sortUnstructuredForApply(us []*unstructured.Unstruc
 	})
 }
 
+//SyncWaveAnnotation the ArgoCD sync-wave of a resource. The resources are sorted by sync-wave first,
+//then by kind, the resources without the annotation are in the sync-wave 0.
+const SyncWaveAnnotation = "argocd.argoproj.io/sync-wave"
+
 func (tp *TemplateProcessor) less(u1, u2 *unstructured.Unstructured) bool {
-	if tp.weight(u1) == tp.weight(u2) {
-		if u1.GetNamespace() == u2.GetNamespace() {
-			return u1.GetName() < u2.GetName()
+	if w1, w2 := wave(u1, SyncWaveAnnotation), wave(u2, SyncWaveAnnotation); w1 != w2 {
+		return tp.lessWave(w1, w2)
+	}
+	if tp.weight(u1) != tp.weight(u2) {
+		return tp.weight(u1) < tp.weight(u2)
+	}
+	if tp.options.WaveAnnotation != "" {
+		if w1, w2 := wave(u1, tp.options.WaveAnnotation), wave(u2, tp.options.WaveAnnotation); w1 != w2 {
+			return tp.lessWave(w1, w2)
 		}
-		return u1.GetNamespace() < u2.GetNamespace()
 	}
-	return tp.weight(u1) < tp.weight(u2)
+	if u1.GetNamespace() == u2.GetNamespace() {
+		return u1.GetName() < u2.GetName()
+	}
+	return u1.GetNamespace() < u2.GetNamespace()
+}
+
+//lessWave returns true if the wave w1 is before the wave w2,
+//the resources are deleted in the reverse wave order
+func (tp *TemplateProcessor) lessWave(w1, w2 int) bool {
+	if tp.options.KindsOrder == sortTypeDelete {
+		return w1 > w2
+	}
+	return w1 < w2
+}
+
+//wave returns the integer value of the annotation of the resource, 0 if not set or invalid
+func wave(u *unstructured.Unstructured, annotation string) int {
+	w, ok := u.GetAnnotations()[annotation]
+	if !ok {
+		return 0
+	}
+	i, err := strconv.Atoi(strings.TrimSpace(w))
+	if err != nil {
+		klog.V(2).Infof("%s has an invalid %s annotation %q, wave 0 used", unstructuredKey(u), annotation, w)
+		return 0
+	}
+	return i
 }
 
 func (tp *TemplateProcessor) weight(u *unstructured.Unstructured) int {
@@ -3,9 +3,16 @@
 package templateprocessor
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
+	"golang.org/x/time/rate"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
@@ -46,7 +53,7 @@ rules:
 `)
 
 func TestTemplateResourcesToMapOfUnstructuredWithStringReader(t *testing.T) {
-	tp, err := NewTemplateProcessor(NewYamlStringReader(string(assetsB), KubernetesYamlsDelimiter), nil)
+	tp, err := NewTemplateProcessor(NewYamlStringReader(string(assetsB), KubernetesYamlsDelimiter))
 	if err != nil {
 		t.Errorf("Unable to create templateProcessor %s", err.Error())
 	}
@@ -61,7 +68,7 @@ func TestTemplateResourcesToMapOfUnstructuredWithStringReader(t *testing.T) {
 		"ClusterRoleBinding",
 		"ServiceAccount",
 	}
-	tpNewOrder, err := NewTemplateProcessor(NewYamlStringReader(string(assetsB), KubernetesYamlsDelimiter), &Options{CreateUpdateKindsOrder: kindsNewOrder})
+	tpNewOrder, err := NewTemplateProcessor(NewYamlStringReader(string(assetsB), KubernetesYamlsDelimiter), WithCreateUpdateKindsOrder(kindsNewOrder))
 	if err != nil {
 		t.Errorf("Unable to create templateProcessor %s", err.Error())
 	}
@@ -126,7 +133,7 @@ func TestTemplateResourcesToMapOfUnstructuredWithStringReader(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotAssets, err := tt.args.templateProcessor.TemplateResourcesInPathUnstructured(tt.args.path, nil, tt.args.recursive, tt.args.values)
+			gotAssets, err := tt.args.templateProcessor.TemplateResourcesInPathUnstructured(context.TODO(), tt.args.path, nil, tt.args.recursive, tt.args.values)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("AssetsUnstructured() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -145,7 +152,7 @@ func TestTemplateResourcesToMapOfUnstructuredWithStringReader(t *testing.T) {
 }
 
 func TestTemplateResourcesToMapOfUnstructuredWithTestReady(t *testing.T) {
-	tp, err := NewTemplateProcessor(NewTestReader(assets), nil)
+	tp, err := NewTemplateProcessor(NewTestReader(assets))
 	if err != nil {
 		t.Errorf("Unable to create templateProcessor %s", err.Error())
 	}
@@ -160,7 +167,7 @@ func TestTemplateResourcesToMapOfUnstructuredWithTestReady(t *testing.T) {
 		"ClusterRoleBinding",
 		"ServiceAccount",
 	}
-	tpNewOrder, err := NewTemplateProcessor(NewTestReader(assets), &Options{CreateUpdateKindsOrder: kindsNewOrder})
+	tpNewOrder, err := NewTemplateProcessor(NewTestReader(assets), WithCreateUpdateKindsOrder(kindsNewOrder))
 	if err != nil {
 		t.Errorf("Unable to create templateProcessor %s", err.Error())
 	}
@@ -225,7 +232,7 @@ func TestTemplateResourcesToMapOfUnstructuredWithTestReady(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotAssets, err := tt.args.templateProcessor.TemplateResourcesInPathUnstructured(tt.args.path, nil, tt.args.recursive, tt.args.values)
+			gotAssets, err := tt.args.templateProcessor.TemplateResourcesInPathUnstructured(context.TODO(), tt.args.path, nil, tt.args.recursive, tt.args.values)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("AssetsUnstructured() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -244,7 +251,7 @@ func TestTemplateResourcesToMapOfUnstructuredWithTestReady(t *testing.T) {
 }
 
 func TestTemplateProcessor_TemplateAssetsInPathYaml(t *testing.T) {
-	tp, err := NewTemplateProcessor(NewTestReader(assets), nil)
+	tp, err := NewTemplateProcessor(NewTestReader(assets))
 	if err != nil {
 		t.Errorf("Unable to create templateProcessor %s", err.Error())
 	}
@@ -293,9 +300,9 @@ func TestTemplateProcessor_TemplateAssetsInPathYaml(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := tt.fields.TemplateResourcesInPathYaml(tt.args.path, tt.args.excluded, tt.args.recursive, tt.args.values)
+			got, err := tt.fields.TemplateResourcesInPathYaml(context.TODO(), tt.args.path, tt.args.excluded, tt.args.recursive, tt.args.values)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("Applier.TemplateResourcesInPathYaml() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("Applier.TemplateResourcesInPathYaml(context.TODO(), ) error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if got != nil {
@@ -307,8 +314,113 @@ func TestTemplateProcessor_TemplateAssetsInPathYaml(t *testing.T) {
 	}
 }
 
+func TestTemplateProcessor_TemplateResourcesAsJSONLines(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(assets))
+	if err != nil {
+		t.Errorf("Unable to create templateProcessor %s", err.Error())
+	}
+	want, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := tp.TemplateResourcesAsJSONLines(context.TODO(), "test", nil, false, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(got), "\n"), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("Expecting %d lines got %d", len(want), len(lines))
+	}
+	for i, line := range lines {
+		u := &unstructured.Unstructured{}
+		if err := u.UnmarshalJSON([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(u, want[i]) {
+			t.Errorf("Line %d: expecting %v got %v", i, want[i], u)
+		}
+	}
+	if _, err := tp.TemplateResourcesAsJSONLines(context.TODO(), "test", nil, false, missingValues); err == nil {
+		t.Error("Expecting an error for missing values")
+	}
+}
+
+func TestTemplateProcessor_TemplateResourcesInPathJSON(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(assets))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := tp.TemplateResourcesInPathJSON(context.TODO(), "test", nil, false, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expecting %d documents got %d", len(want), len(got))
+	}
+	for i, j := range got {
+		if !json.Valid(j) {
+			t.Errorf("Document %d is not a valid JSON: %s", i, string(j))
+		}
+		u := &unstructured.Unstructured{}
+		if err := u.UnmarshalJSON(j); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(u, want[i]) {
+			t.Errorf("Document %d: expecting %v got %v", i, want[i], u)
+		}
+	}
+	if _, err := tp.TemplateResourcesInPathJSON(context.TODO(), "test", nil, false, missingValues); err == nil {
+		t.Error("Expecting an error for missing values")
+	}
+	empty, err := ToJSONsUnstructured(nil)
+	if err != nil || len(empty) != 0 {
+		t.Errorf("Expecting no document got %v, %v", empty, err)
+	}
+}
+
+func TestTemplateProcessor_FindUnusedTemplates(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/_helpers.tpl": `{{ define "name" }}myname{{ end }}`,
+		"test/used": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ include "name" . }}
+  namespace: myns`,
+		"test/disabled": `
+{{- if .Enabled }}
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: disabled
+  namespace: myns
+{{- end }}`,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := tp.FindUnusedTemplates(context.TODO(), "test", nil, false, map[string]bool{"Enabled": false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []string{"test/disabled"}) {
+		t.Errorf("Expecting [test/disabled] got %v", got)
+	}
+	got, err = tp.FindUnusedTemplates(context.TODO(), "test", nil, false, map[string]bool{"Enabled": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Expecting no unused template got %v", got)
+	}
+}
+
 func TestTemplateProcessor_Assets(t *testing.T) {
-	tp, err := NewTemplateProcessor(NewTestReader(assets), nil)
+	tp, err := NewTemplateProcessor(NewTestReader(assets))
 	if err != nil {
 		t.Errorf("Unable to create templateProcessor %s", err.Error())
 	}
@@ -459,12 +571,40 @@ func TestTemplateProcessor_AssetNamesInPath(t *testing.T) {
 			want:    []string{"0", "1", "2"},
 			wantErr: false,
 		},
+		{
+			name: "succeed exclude patterns",
+			fields: fields{
+				reader:  tpr,
+				options: &Options{ExcludePatterns: []string{"^[12]$"}},
+			},
+			args: args{
+				path:      ".",
+				excluded:  nil,
+				recursive: false,
+			},
+			want:    []string{"0"},
+			wantErr: false,
+		},
+		{
+			name: "succeed excluded and exclude patterns",
+			fields: fields{
+				reader:  tpr,
+				options: &Options{ExcludePatterns: []string{"2"}},
+			},
+			args: args{
+				path:      ".",
+				excluded:  []string{"0"},
+				recursive: false,
+			},
+			want:    []string{"1"},
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tp, _ := NewTemplateProcessor(
 				tt.fields.reader,
-				tt.fields.options)
+				WithOptions(tt.fields.options))
 			got, err := tp.AssetNamesInPath(tt.args.path, tt.args.excluded, tt.args.recursive)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("TemplateProcessor.AssetNamesInPath() error = %v, wantErr %v", err, tt.wantErr)
@@ -479,7 +619,7 @@ func TestTemplateProcessor_AssetNamesInPath(t *testing.T) {
 
 func TestTemplateProcessor_helpertpl(t *testing.T) {
 	tpr := NewYamlFileReader("../../test/unit/resources/templates/withhelpers")
-	tp, err := NewTemplateProcessor(tpr, &Options{})
+	tp, err := NewTemplateProcessor(tpr)
 	if err != nil {
 		t.Error(err)
 	}
@@ -488,7 +628,7 @@ func TestTemplateProcessor_helpertpl(t *testing.T) {
 			"name": "TestTemplateProcessor_helpertpl",
 		},
 	}
-	u, err := tp.TemplateResourcesInPathUnstructured(".", nil, false, values)
+	u, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), ".", nil, false, values)
 	if err != nil {
 		t.Error(err)
 	}
@@ -502,6 +642,75 @@ func TestTemplateProcessor_helpertpl(t *testing.T) {
 	}
 }
 
+func TestTemplateProcessor_InheritHelpers(t *testing.T) {
+	assets := map[string]string{
+		"_helpers.tpl": `{{- define "namespace" }}rootns{{ end }}
+{{- define "prefix" }}root{{ end }}`,
+		"charts/_helpers.tpl": `{{- define "prefix" }}chart{{ end }}`,
+		"charts/sub/configmap": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ template "prefix" }}-configmap
+  namespace: {{ template "namespace" }}`,
+		"charts/sub/deep/serviceaccount": `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: {{ template "prefix" }}-serviceaccount
+  namespace: {{ template "namespace" }}`,
+		"configmap": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ template "prefix" }}-configmap
+  namespace: {{ template "namespace" }}`,
+	}
+	tp, err := NewTemplateProcessor(NewTestReader(assets), WithOptions(&Options{InheritHelpers: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		templateName string
+		want         string
+	}{
+		{templateName: "charts/sub/configmap", want: "chart-configmap"},
+		{templateName: "charts/sub/deep/serviceaccount", want: "chart-serviceaccount"},
+		{templateName: "configmap", want: "root-configmap"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.templateName, func(t *testing.T) {
+			b, err := tp.TemplateResource(context.TODO(), tt.templateName, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			u, err := tp.BytesToUnstructured(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.GetName() != tt.want || u.GetNamespace() != "rootns" {
+				t.Errorf("Expecting rootns/%s got %s/%s", tt.want, u.GetNamespace(), u.GetName())
+			}
+		})
+	}
+	tp, err = NewTemplateProcessor(NewTestReader(assets))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tp.TemplateResource(context.TODO(), "charts/sub/configmap", nil); err == nil {
+		t.Error("Expecting the parent helpers not to be loaded without InheritHelpers")
+	}
+	assets["charts/_helpers.tpl"] = `{{- define "prefix" }}`
+	tp, err = NewTemplateProcessor(NewTestReader(assets), WithOptions(&Options{InheritHelpers: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tp.TemplateResource(context.TODO(), "charts/sub/configmap", nil); err == nil ||
+		!strings.Contains(err.Error(), "charts/_helpers.tpl") {
+		t.Errorf("Expecting an error on charts/_helpers.tpl got %v", err)
+	}
+}
+
 func TestTemplateProcessor_BytesToUnstructured(t *testing.T) {
 	var asset = []byte(``)
 	tpr := NewYamlStringReader(string(asset), KubernetesYamlsDelimiter)
@@ -571,7 +780,7 @@ metadata:
 		t.Run(tt.name, func(t *testing.T) {
 			tp, _ := NewTemplateProcessor(
 				tt.fields.reader,
-				tt.fields.options)
+				WithOptions(tt.fields.options))
 			got, err := tp.BytesToUnstructured(tt.args.asset)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("TemplateProcessor.BytesToUnstructured() error = %v, wantErr %v", err, tt.wantErr)
@@ -644,7 +853,7 @@ metadata:
 		t.Run(tt.name, func(t *testing.T) {
 			tp, _ := NewTemplateProcessor(
 				tt.fields.reader,
-				tt.fields.options)
+				WithOptions(tt.fields.options))
 			gotUs, err := tp.BytesArrayToUnstructured(tt.args.assets)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("TemplateProcessor.BytesArrayToUnstructured() error = %v, wantErr %v", err, tt.wantErr)
@@ -656,3 +865,528 @@ metadata:
 		})
 	}
 }
+
+func TestTemplateProcessor_sortBySyncWave(t *testing.T) {
+	assets := map[string]string{
+		"test/namespace": `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: myns
+  annotations:
+    argocd.argoproj.io/sync-wave: "1"`,
+		"test/serviceaccount": `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: mysa
+  namespace: myns`,
+		"test/configmap": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: mycm
+  namespace: myns
+  annotations:
+    argocd.argoproj.io/sync-wave: "-1"`,
+		"test/deployment": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: mydeployment
+  namespace: myns
+  annotations:
+    argocd.argoproj.io/sync-wave: "invalid"`,
+	}
+	tests := []struct {
+		name      string
+		setDelete bool
+		wantKinds []string
+	}{
+		{
+			name:      "create update",
+			wantKinds: []string{"ConfigMap", "ServiceAccount", "Deployment", "Namespace"},
+		},
+		{
+			name:      "delete",
+			setDelete: true,
+			wantKinds: []string{"Namespace", "Deployment", "ServiceAccount", "ConfigMap"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(assets))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.setDelete {
+				tp.SetDeleteOrder()
+			}
+			us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			kinds := make([]string, len(us))
+			for i, u := range us {
+				kinds[i] = u.GetKind()
+			}
+			if !reflect.DeepEqual(kinds, tt.wantKinds) {
+				t.Errorf("Expecting order %v got %v", tt.wantKinds, kinds)
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_sortByWaveAnnotation(t *testing.T) {
+	assets := map[string]string{
+		"test/clusterrole-a": `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: a
+  annotations:
+    example.com/wave: "2"`,
+		"test/clusterrole-b": `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: b
+  annotations:
+    example.com/wave: "1"`,
+		"test/clusterrole-c": `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: c`,
+		"test/clusterrole-d": `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: d
+  annotations:
+    argocd.argoproj.io/sync-wave: "-1"
+    example.com/wave: "3"`,
+		"test/namespace": `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: ns
+  annotations:
+    example.com/wave: "1"`,
+	}
+	tests := []struct {
+		name      string
+		options   *Options
+		setDelete bool
+		wantNames []string
+	}{
+		{
+			name:      "no wave annotation",
+			options:   &Options{},
+			wantNames: []string{"d", "ns", "a", "b", "c"},
+		},
+		{
+			name:      "wave annotation",
+			options:   &Options{WaveAnnotation: "example.com/wave"},
+			wantNames: []string{"d", "ns", "c", "b", "a"},
+		},
+		{
+			name:      "wave annotation delete",
+			options:   &Options{WaveAnnotation: "example.com/wave"},
+			setDelete: true,
+			wantNames: []string{"a", "b", "c", "ns", "d"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(assets), WithOptions(tt.options))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.setDelete {
+				tp.SetDeleteOrder()
+			}
+			us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := make([]string, len(us))
+			for i, u := range us {
+				names[i] = u.GetName()
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("Expecting order %v got %v", tt.wantNames, names)
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_TemplateResourcesUnstructuredMap(t *testing.T) {
+	assets := map[string]string{
+		"test/namespace": `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: myns`,
+		"test/configmap": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: mycm
+  namespace: myns`,
+		"test/configmap-duplicate": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: mycm
+  namespace: myns
+data:
+  key: value`,
+	}
+	tests := []struct {
+		name          string
+		templateNames []string
+		wantKeys      []string
+		wantErr       bool
+	}{
+		{
+			name:          "no duplicate",
+			templateNames: []string{"test/namespace", "test/configmap"},
+			wantKeys:      []string{"ConfigMap/myns/mycm", "Namespace/_/myns"},
+		},
+		{
+			name:          "duplicate",
+			templateNames: []string{"test/namespace", "test/configmap", "test/configmap-duplicate"},
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(assets))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := tp.TemplateResourcesUnstructuredMap(context.TODO(), tt.templateNames, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TemplateResourcesUnstructuredMap() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if _, ok := err.(*DuplicateResourceError); !ok {
+					t.Errorf("Expecting a DuplicateResourceError got %T", err)
+				}
+				return
+			}
+			keys := make([]string, 0, len(got))
+			for k := range got {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("Expecting keys %v got %v", tt.wantKeys, keys)
+			}
+		})
+	}
+}
+
+//cancellingValues are values whose Cancel method cancels the rendering context
+//and whose Block method blocks until unblock is closed
+type cancellingValues struct {
+	cancel  context.CancelFunc
+	unblock chan struct{}
+}
+
+func (v cancellingValues) Cancel() string {
+	v.cancel()
+	return "cancelled"
+}
+
+func (v cancellingValues) Block() string {
+	<-v.unblock
+	return "unblocked"
+}
+
+func TestTemplateProcessor_TemplateResourcesCancellation(t *testing.T) {
+	rendered := 0
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/cancel": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Cancel }}`,
+		"test/block": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Block }}`,
+		"test/other": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: other`,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	countingCancel := func() {
+		rendered++
+		cancel()
+	}
+	values := cancellingValues{cancel: countingCancel, unblock: make(chan struct{})}
+	defer close(values.unblock)
+	if _, err := tp.TemplateResources(ctx, []string{"test/cancel", "test/other", "test/block"}, values); err != context.Canceled {
+		t.Errorf("Expecting %v got %v", context.Canceled, err)
+	}
+	if rendered != 1 {
+		t.Errorf("Expecting the rendering to stop after the first template, got %d cancel calls", rendered)
+	}
+	if _, err := tp.TemplateResource(ctx, "test/other", values); err != context.Canceled {
+		t.Errorf("Expecting %v for a done context got %v", context.Canceled, err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := tp.TemplateResources(ctx, []string{"test/other", "test/block"}, values); err != context.DeadlineExceeded {
+		t.Errorf("Expecting %v got %v", context.DeadlineExceeded, err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Expecting the blocked rendering to return promptly, returned after %s", d)
+	}
+	out, err := tp.TemplateResources(context.Background(), []string{"test/other"}, values)
+	if err != nil || len(out) != 1 {
+		t.Errorf("Expecting 1 rendered resource got %d, %v", len(out), err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := tp.TemplateResourcesUnstructured(ctx, []string{"test/other", "test/block"}, values); err != context.DeadlineExceeded {
+		t.Errorf("Expecting %v from TemplateResourcesUnstructured got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestTemplateProcessor_RenderRateLimit(t *testing.T) {
+	reader := NewTestReader(map[string]string{
+		"test/cm1": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm1\n  namespace: myns",
+		"test/cm2": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm2\n  namespace: myns",
+		"test/cm3": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm3\n  namespace: myns",
+	})
+	tp, err := NewTemplateProcessor(reader, WithOptions(&Options{
+		RenderRateLimit: rate.NewLimiter(rate.Every(50*time.Millisecond), 1),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	us, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(us) != 3 {
+		t.Errorf("Expecting 3 resources got %d", len(us))
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Errorf("Expecting the rendering to be rate limited, took %s", d)
+	}
+	tp, err = NewTemplateProcessor(reader, WithOptions(&Options{
+		RenderRateLimit: rate.NewLimiter(rate.Every(time.Second), 0),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil); err == nil {
+		t.Error("Expecting an error when the limiter never grants a token")
+	}
+	tp, err = NewTemplateProcessor(reader, WithOptions(&Options{
+		RenderRateLimit: rate.NewLimiter(rate.Every(time.Hour), 1),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if _, err := tp.TemplateResources(ctx, []string{"test/cm1", "test/cm2"}, nil); err == nil {
+		t.Error("Expecting TemplateResources to be rate limited until the context is done")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Expecting the wait to stop with the context, returned after %s", d)
+	}
+}
+
+func TestTemplateProcessor_TemplateResourcesConcurrent(t *testing.T) {
+	assets := map[string]string{
+		"parts/labels": "labels:\n  index: \"{{ .Index }}\"",
+	}
+	templateNames := make([]string, 0)
+	want := make([][]byte, 0)
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("test/cm%02d", i)
+		assets[name] = fmt.Sprintf(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm%02d
+{{ renderTemplate "parts/labels" (dict "Index" %d) | indent 2 }}`, i, i)
+		templateNames = append(templateNames, name)
+		want = append(want, []byte(fmt.Sprintf(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm%02d
+  labels:
+    index: "%d"`, i, i)))
+	}
+	assets["test/_helpers.tpl"] = ""
+	templateNames = append(templateNames, "test/_helpers.tpl")
+	assets["fail/error"] = `{{ fail "rendering error" }}`
+	tests := []struct {
+		name           string
+		maxConcurrency int
+		templateNames  []string
+		want           [][]byte
+		wantErr        bool
+	}{
+		{
+			name:           "default concurrency",
+			maxConcurrency: 0,
+			templateNames:  templateNames,
+			want:           want,
+		},
+		{
+			name:           "sequential",
+			maxConcurrency: 1,
+			templateNames:  templateNames,
+			want:           want,
+		},
+		{
+			name:           "more workers than templates",
+			maxConcurrency: 100,
+			templateNames:  templateNames,
+			want:           want,
+		},
+		{
+			name:           "error",
+			maxConcurrency: 8,
+			templateNames:  append(append([]string{}, templateNames[:25]...), append([]string{"fail/error"}, templateNames[25:]...)...),
+			wantErr:        true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(assets), WithOptions(&Options{MaxConcurrency: tt.maxConcurrency}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := tp.TemplateResourcesConcurrent(context.TODO(), tt.templateNames, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TemplateResourcesConcurrent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !strings.Contains(err.Error(), "rendering error") {
+					t.Errorf("Expecting the rendering error got %v", err)
+				}
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expecting %d results got %d", len(tt.want), len(got))
+			}
+			for i := range got {
+				if string(got[i]) != string(tt.want[i]) {
+					t.Errorf("result %d = %s, want %s", i, string(got[i]), string(tt.want[i]))
+				}
+			}
+		})
+	}
+}
+
+func TestNewTemplateProcessor_options(t *testing.T) {
+	kindsOrder := KindsOrder{"ConfigMap", "Namespace"}
+	tests := []struct {
+		name    string
+		opts    []TemplateProcessorOption
+		want    Options
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			want: Options{
+				KindsOrder:             sortTypeCreateUpdate,
+				Delimiter:              KubernetesYamlsDelimiter,
+				DelimiterString:        KubernetesYamlsDelimiterString,
+				CreateUpdateKindsOrder: defaultCreateUpdateKindsOrder,
+				DeleteKindsOrder:       defaultDeleteKindsOrder,
+				MissingKeyType:         MissingKeyTypeZero,
+			},
+		},
+		{
+			name: "helpers",
+			opts: []TemplateProcessorOption{
+				WithKindsOrder(sortTypeDelete),
+				WithCreateUpdateKindsOrder(kindsOrder),
+				WithDeleteKindsOrder(kindsOrder),
+				WithDelimiter("(?m)^-{4}$"),
+				WithDelimiterString("----"),
+				WithMissingKeyType(MissingKeyTypeError),
+			},
+			want: Options{
+				KindsOrder:             sortTypeDelete,
+				Delimiter:              "(?m)^-{4}$",
+				DelimiterString:        "----",
+				CreateUpdateKindsOrder: kindsOrder,
+				DeleteKindsOrder:       kindsOrder,
+				MissingKeyType:         MissingKeyTypeError,
+			},
+		},
+		{
+			name: "options then helper",
+			opts: []TemplateProcessorOption{
+				WithOptions(&Options{MissingKeyType: MissingKeyTypeError, NamePrefix: "my-"}),
+				WithDeleteKindsOrder(kindsOrder),
+			},
+			want: Options{
+				KindsOrder:             sortTypeCreateUpdate,
+				Delimiter:              KubernetesYamlsDelimiter,
+				DelimiterString:        KubernetesYamlsDelimiterString,
+				CreateUpdateKindsOrder: defaultCreateUpdateKindsOrder,
+				DeleteKindsOrder:       kindsOrder,
+				MissingKeyType:         MissingKeyTypeError,
+				NamePrefix:             "my-",
+			},
+		},
+		{
+			name:    "delimiter mismatch",
+			opts:    []TemplateProcessorOption{WithDelimiterString("----")},
+			wantErr: true,
+		},
+		{
+			name:    "invalid exclude pattern",
+			opts:    []TemplateProcessorOption{WithOptions(&Options{ExcludePatterns: []string{"test/[a-"}})},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{}), tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewTemplateProcessor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(*tp.options, tt.want) {
+				t.Errorf("NewTemplateProcessor() options = %+v, want %+v", *tp.options, tt.want)
+			}
+		})
+	}
+	options := &Options{MissingKeyType: MissingKeyTypeError}
+	tp, err := NewTemplateProcessorFromOptions(NewTestReader(map[string]string{}), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tp.options.MissingKeyType != MissingKeyTypeError || tp.options.Delimiter != KubernetesYamlsDelimiter {
+		t.Errorf("NewTemplateProcessorFromOptions() options = %+v", *tp.options)
+	}
+	if options.Delimiter != "" {
+		t.Error("Expecting the options not to be modified")
+	}
+	if _, err := NewTemplateProcessor(nil); err == nil {
+		t.Error("Expecting an error for a nil reader")
+	}
+}
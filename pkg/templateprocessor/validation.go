@@ -0,0 +1,767 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/robfig/cron/v3"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+//validateCronSchedules returns an error if the spec.schedule of a CronJob is not a valid cron expression
+func validateCronSchedules(us []*unstructured.Unstructured) error {
+	for _, u := range us {
+		if u.GetKind() != "CronJob" {
+			continue
+		}
+		schedule, _, _ := unstructured.NestedString(u.Object, "spec", "schedule")
+		if _, err := cron.ParseStandard(schedule); err != nil {
+			return fmt.Errorf("CronJob %s/%s has an invalid schedule \"%s\": %s",
+				u.GetNamespace(), u.GetName(), schedule, err)
+		}
+	}
+	return nil
+}
+
+//defaultCronJobMaxNextRunInterval the CronJobMaxNextRunInterval if the option is not set
+const defaultCronJobMaxNextRunInterval = 31 * 24 * time.Hour
+
+//CronJobScheduleWarning is raised when the next run of a CronJob is further than the Options.CronJobMaxNextRunInterval.
+//NextRun is zero if the schedule never matches.
+type CronJobScheduleWarning struct {
+	Namespace          string
+	Name               string
+	Schedule           string
+	NextRun            time.Time
+	MaxNextRunInterval time.Duration
+}
+
+func (w *CronJobScheduleWarning) Error() string {
+	if w.NextRun.IsZero() {
+		return fmt.Sprintf("CronJob %s/%s schedule \"%s\" never runs", w.Namespace, w.Name, w.Schedule)
+	}
+	return fmt.Sprintf("CronJob %s/%s schedule \"%s\" next run %s is more than %s in the future",
+		w.Namespace, w.Name, w.Schedule, w.NextRun.Format(time.RFC3339), w.MaxNextRunInterval)
+}
+
+//validateCronJobNextRun raises a CronJobScheduleWarning for each CronJob whose next run is further
+//than the options.CronJobMaxNextRunInterval. The invalid schedules are reported by validateCronSchedules.
+func (tp *TemplateProcessor) validateCronJobNextRun(rs *renderState, us []*unstructured.Unstructured) {
+	maxInterval := tp.options.CronJobMaxNextRunInterval
+	if maxInterval == 0 {
+		maxInterval = defaultCronJobMaxNextRunInterval
+	}
+	now := time.Now()
+	for _, u := range us {
+		if u.GetKind() != "CronJob" {
+			continue
+		}
+		schedule, _, _ := unstructured.NestedString(u.Object, "spec", "schedule")
+		s, err := cron.ParseStandard(schedule)
+		if err != nil {
+			continue
+		}
+		next := s.Next(now)
+		if next.IsZero() || next.Sub(now) > maxInterval {
+			rs.warn(&CronJobScheduleWarning{
+				Namespace:          u.GetNamespace(),
+				Name:               u.GetName(),
+				Schedule:           schedule,
+				NextRun:            next,
+				MaxNextRunInterval: maxInterval,
+			})
+		}
+	}
+}
+
+//ValidationError is returned when the output of a template is not a valid list of Kubernetes resources
+type ValidationError struct {
+	//Err the error raised by the conversion of the output
+	Err error
+	//Rendered the output of the template
+	Rendered []byte
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid template output: %s\n%s", e.Err, string(e.Rendered))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+//ValidateTemplateOutput returns a ValidationError if the output of a template can not be converted to
+//Kubernetes resources, each document of the output must be a valid YAML with an apiVersion and a kind.
+func (tp *TemplateProcessor) ValidateTemplateOutput(b []byte) error {
+	us, err := tp.BytesArrayToUnstructured([][]byte{b})
+	if err != nil {
+		return &ValidationError{Err: err, Rendered: b}
+	}
+	for _, u := range us {
+		if u.GetAPIVersion() == "" || u.GetKind() == "" {
+			return &ValidationError{Err: fmt.Errorf("a document has no apiVersion or kind"), Rendered: b}
+		}
+	}
+	return nil
+}
+
+//MalformedImageError is returned when a container image reference is not valid
+type MalformedImageError struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Container string
+	Image     string
+	Err       error
+}
+
+func (e *MalformedImageError) Error() string {
+	return fmt.Sprintf("%s %s/%s container %s has a malformed image \"%s\": %s",
+		e.Kind, e.Namespace, e.Name, e.Container, e.Image, e.Err)
+}
+
+//validateImageFormat returns a MalformedImageError if the image of a container is not a valid reference
+//or has no explicit registry
+func validateImageFormat(us []*unstructured.Unstructured) error {
+	for _, u := range us {
+		spec, ok := podSpec(u)
+		if !ok {
+			continue
+		}
+		for _, c := range podContainers(spec) {
+			image, _, _ := unstructured.NestedString(c, "image")
+			named, err := reference.ParseNormalizedNamed(image)
+			//the normalization adds the docker.io domain to the images without registry
+			if err == nil && !strings.HasPrefix(image, reference.Domain(named)+"/") {
+				err = fmt.Errorf("missing registry")
+			}
+			if err != nil {
+				name, _, _ := unstructured.NestedString(c, "name")
+				return &MalformedImageError{
+					Kind:      u.GetKind(),
+					Namespace: u.GetNamespace(),
+					Name:      u.GetName(),
+					Container: name,
+					Image:     image,
+					Err:       err,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+//PrometheusRuleSyntaxError is returned when the expression of a PrometheusRule rule is not a valid PromQL expression
+type PrometheusRuleSyntaxError struct {
+	Namespace string
+	Name      string
+	Group     string
+	Rule      string
+	Expr      string
+	Err       error
+}
+
+func (e *PrometheusRuleSyntaxError) Error() string {
+	return fmt.Sprintf("PrometheusRule %s/%s group %s rule %s has an invalid expression \"%s\": %s",
+		e.Namespace, e.Name, e.Group, e.Rule, e.Expr, e.Err)
+}
+
+//PrometheusRuleMissingExprError is returned when a rule of a PrometheusRule has no expression
+type PrometheusRuleMissingExprError struct {
+	Namespace string
+	Name      string
+	Group     string
+	//Index the index of the rule in the rules of the group
+	Index int
+}
+
+func (e *PrometheusRuleMissingExprError) Error() string {
+	return fmt.Sprintf("PrometheusRule %s/%s rule %d of group %s has no expr",
+		e.Namespace, e.Name, e.Index, e.Group)
+}
+
+//validatePrometheusRules returns a PrometheusRuleSyntaxError if the expression of a PrometheusRule rule can not be parsed
+//and a PrometheusRuleMissingExprError if a rule has no expression
+func validatePrometheusRules(us []*unstructured.Unstructured) error {
+	for _, u := range us {
+		if u.GetKind() != "PrometheusRule" || u.GroupVersionKind().Group != "monitoring.coreos.com" {
+			continue
+		}
+		groups, _, _ := unstructured.NestedSlice(u.Object, "spec", "groups")
+		for _, g := range groups {
+			group, ok := g.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			groupName, _, _ := unstructured.NestedString(group, "name")
+			rules, _, _ := unstructured.NestedSlice(group, "rules")
+			for i, r := range rules {
+				rule, ok := r.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if rule["expr"] == nil {
+					return &PrometheusRuleMissingExprError{
+						Namespace: u.GetNamespace(),
+						Name:      u.GetName(),
+						Group:     groupName,
+						Index:     i,
+					}
+				}
+				//a numeric expression is decoded as a number from the yaml
+				expr, ok := rule["expr"].(string)
+				if !ok {
+					expr = fmt.Sprint(rule["expr"])
+				}
+				if _, err := parser.ParseExpr(expr); err != nil {
+					ruleName, _, _ := unstructured.NestedString(rule, "alert")
+					if ruleName == "" {
+						ruleName, _, _ = unstructured.NestedString(rule, "record")
+					}
+					return &PrometheusRuleSyntaxError{
+						Namespace: u.GetNamespace(),
+						Name:      u.GetName(),
+						Group:     groupName,
+						Rule:      ruleName,
+						Expr:      expr,
+						Err:       err,
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+//HPATargetMissingError is returned when the scaleTargetRef of a HorizontalPodAutoscaler
+//doesn't match any rendered resource
+type HPATargetMissingError struct {
+	Namespace        string
+	Name             string
+	TargetAPIVersion string
+	TargetKind       string
+	TargetName       string
+}
+
+func (e *HPATargetMissingError) Error() string {
+	return fmt.Sprintf("HorizontalPodAutoscaler %s/%s targets %s %s %s which is not rendered",
+		e.Namespace, e.Name, e.TargetAPIVersion, e.TargetKind, e.TargetName)
+}
+
+//validateHPATargets returns an HPATargetMissingError if the scaleTargetRef of a HorizontalPodAutoscaler
+//doesn't match the apiVersion, kind and name of a resource in the same namespace
+func validateHPATargets(us []*unstructured.Unstructured) error {
+	for _, u := range us {
+		if u.GetKind() != "HorizontalPodAutoscaler" {
+			continue
+		}
+		apiVersion, _, _ := unstructured.NestedString(u.Object, "spec", "scaleTargetRef", "apiVersion")
+		kind, _, _ := unstructured.NestedString(u.Object, "spec", "scaleTargetRef", "kind")
+		name, _, _ := unstructured.NestedString(u.Object, "spec", "scaleTargetRef", "name")
+		found := false
+		for _, target := range us {
+			if target.GetAPIVersion() == apiVersion &&
+				target.GetKind() == kind &&
+				target.GetName() == name &&
+				target.GetNamespace() == u.GetNamespace() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return &HPATargetMissingError{
+				Namespace:        u.GetNamespace(),
+				Name:             u.GetName(),
+				TargetAPIVersion: apiVersion,
+				TargetKind:       kind,
+				TargetName:       name,
+			}
+		}
+	}
+	return nil
+}
+
+//IngressTLSSecretMissingError is returned when a TLS secret of an Ingress
+//is neither rendered nor in the cluster
+type IngressTLSSecretMissingError struct {
+	Namespace  string
+	Name       string
+	Host       string
+	SecretName string
+}
+
+func (e *IngressTLSSecretMissingError) Error() string {
+	return fmt.Sprintf("Ingress %s/%s host %s uses the TLS secret %s which is neither rendered nor in the cluster",
+		e.Namespace, e.Name, e.Host, e.SecretName)
+}
+
+//validateIngressTLS returns an IngressTLSSecretMissingError if a secret of the spec.tls of an Ingress
+//is not rendered and, when the KubeClient option is set, doesn't exist in the cluster
+func (tp *TemplateProcessor) validateIngressTLS(ctx context.Context, us []*unstructured.Unstructured) error {
+	for _, u := range us {
+		if u.GetKind() != "Ingress" {
+			continue
+		}
+		tlss, _, _ := unstructured.NestedSlice(u.Object, "spec", "tls")
+		for _, t := range tlss {
+			tls, ok := t.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			secretName, _, _ := unstructured.NestedString(tls, "secretName")
+			if secretName == "" || findResource(us, "Secret", u.GetNamespace(), secretName) != nil {
+				continue
+			}
+			exists, err := tp.secretExists(ctx, u.GetNamespace(), secretName)
+			if err != nil {
+				return err
+			}
+			if exists {
+				continue
+			}
+			hosts, _, _ := unstructured.NestedStringSlice(tls, "hosts")
+			return &IngressTLSSecretMissingError{
+				Namespace:  u.GetNamespace(),
+				Name:       u.GetName(),
+				Host:       strings.Join(hosts, ","),
+				SecretName: secretName,
+			}
+		}
+	}
+	return nil
+}
+
+//PriorityClassMissingError is returned when the priorityClassName of a workload
+//is neither rendered nor in the cluster
+type PriorityClassMissingError struct {
+	Kind              string
+	Namespace         string
+	Name              string
+	PriorityClassName string
+}
+
+func (e *PriorityClassMissingError) Error() string {
+	return fmt.Sprintf("%s %s/%s uses the PriorityClass %s which is neither rendered nor in the cluster",
+		e.Kind, e.Namespace, e.Name, e.PriorityClassName)
+}
+
+//builtinPriorityClasses the PriorityClasses created by Kubernetes
+var builtinPriorityClasses = map[string]bool{
+	"system-cluster-critical": true,
+	"system-node-critical":    true,
+}
+
+//priorityClassGVR the GroupVersionResource of the PriorityClasses
+var priorityClassGVR = schema.GroupVersionResource{Group: "scheduling.k8s.io", Version: "v1", Resource: "priorityclasses"}
+
+//validatePriorityClasses returns a PriorityClassMissingError if the spec.priorityClassName of a pod template
+//is not a built-in PriorityClass, is not rendered and, when the DynamicClient option is set, doesn't exist in the cluster
+func (tp *TemplateProcessor) validatePriorityClasses(ctx context.Context, us []*unstructured.Unstructured) error {
+	for _, u := range us {
+		spec, ok := podSpec(u)
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(spec, "priorityClassName")
+		if name == "" || builtinPriorityClasses[name] || findResource(us, "PriorityClass", "", name) != nil {
+			continue
+		}
+		if tp.options.DynamicClient != nil {
+			_, err := tp.options.DynamicClient.Resource(priorityClassGVR).Get(ctx, name, metav1.GetOptions{})
+			if err == nil {
+				continue
+			}
+			if !errors.IsNotFound(err) {
+				return err
+			}
+		}
+		return &PriorityClassMissingError{
+			Kind:              u.GetKind(),
+			Namespace:         u.GetNamespace(),
+			Name:              u.GetName(),
+			PriorityClassName: name,
+		}
+	}
+	return nil
+}
+
+//secretExists returns true if the secret exists in the cluster, false if the KubeClient option is not set
+func (tp *TemplateProcessor) secretExists(ctx context.Context, namespace, name string) (bool, error) {
+	if tp.options.KubeClient == nil {
+		return false, nil
+	}
+	_, err := tp.options.KubeClient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+//CrossReferenceError is returned when rendered resources reference resources which are not rendered
+type CrossReferenceError struct {
+	//References the unsatisfied references as "Kind/Namespace/Name -> Kind/Namespace/Name"
+	References []string
+}
+
+func (e *CrossReferenceError) Error() string {
+	return fmt.Sprintf("unsatisfied references: %s", strings.Join(e.References, ", "))
+}
+
+//validateCrossReferences returns a CrossReferenceError if a RoleBinding or ClusterRoleBinding subject,
+//a ServiceAccount imagePullSecret or a not optional ConfigMap or Secret volume of a workload is not rendered
+func validateCrossReferences(us []*unstructured.Unstructured) error {
+	references := make([]string, 0)
+	check := func(u *unstructured.Unstructured, kind, namespace, name string) {
+		if findResource(us, kind, namespace, name) == nil {
+			references = append(references,
+				fmt.Sprintf("%s -> %s", unstructuredKey(u), resourceKey(kind, namespace, name)))
+		}
+	}
+	for _, u := range us {
+		switch u.GetKind() {
+		case "RoleBinding", "ClusterRoleBinding":
+			subjects, _, _ := unstructured.NestedSlice(u.Object, "subjects")
+			for _, subject := range mapsIn(subjects) {
+				if subject["kind"] != "ServiceAccount" {
+					continue
+				}
+				name, _ := subject["name"].(string)
+				namespace, _ := subject["namespace"].(string)
+				if namespace == "" {
+					namespace = u.GetNamespace()
+				}
+				check(u, "ServiceAccount", namespace, name)
+			}
+		case "ServiceAccount":
+			for _, ips := range mapsIn(u.Object["imagePullSecrets"]) {
+				name, _ := ips["name"].(string)
+				check(u, "Secret", u.GetNamespace(), name)
+			}
+		}
+		spec, ok := podSpec(u)
+		if !ok {
+			continue
+		}
+		for _, v := range mapsIn(spec["volumes"]) {
+			if cm, ok := v["configMap"].(map[string]interface{}); ok && cm["optional"] != true {
+				name, _ := cm["name"].(string)
+				check(u, "ConfigMap", u.GetNamespace(), name)
+			}
+			if secret, ok := v["secret"].(map[string]interface{}); ok && secret["optional"] != true {
+				name, _ := secret["secretName"].(string)
+				check(u, "Secret", u.GetNamespace(), name)
+			}
+		}
+	}
+	if len(references) != 0 {
+		return &CrossReferenceError{References: references}
+	}
+	return nil
+}
+
+//ServiceSelectorMismatchWarning is raised when the selector of a Service doesn't match the pods of any rendered workload
+type ServiceSelectorMismatchWarning struct {
+	Namespace string
+	Name      string
+	Selector  map[string]string
+}
+
+func (w *ServiceSelectorMismatchWarning) Error() string {
+	return fmt.Sprintf("Service %s/%s selector %v doesn't match any rendered workload",
+		w.Namespace, w.Name, w.Selector)
+}
+
+//validateServiceSelectors raises a ServiceSelectorMismatchWarning for each Service whose selector
+//doesn't match the pod labels of a workload in the same namespace
+func (tp *TemplateProcessor) validateServiceSelectors(rs *renderState, us []*unstructured.Unstructured) {
+	for _, u := range us {
+		if u.GetKind() != "Service" {
+			continue
+		}
+		selector, _, _ := unstructured.NestedStringMap(u.Object, "spec", "selector")
+		if len(selector) == 0 {
+			continue
+		}
+		found := false
+		for _, w := range us {
+			podLabels, ok := podTemplateLabels(w)
+			if ok && w.GetNamespace() == u.GetNamespace() &&
+				labels.SelectorFromSet(selector).Matches(labels.Set(podLabels)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			rs.warn(&ServiceSelectorMismatchWarning{
+				Namespace: u.GetNamespace(),
+				Name:      u.GetName(),
+				Selector:  selector,
+			})
+		}
+	}
+}
+
+//RBACWildcardWarning is raised when a rule of a Role or ClusterRole grants all verbs or all resources
+type RBACWildcardWarning struct {
+	Kind      string
+	Namespace string
+	Name      string
+	//Rule the index of the rule in the rules of the role
+	Rule int
+	//Field "verbs" or "resources"
+	Field string
+}
+
+func (w *RBACWildcardWarning) Error() string {
+	name := w.Name
+	if w.Namespace != "" {
+		name = w.Namespace + "/" + name
+	}
+	return fmt.Sprintf("%s %s rule %d grants \"*\" %s", w.Kind, name, w.Rule, w.Field)
+}
+
+//analyzeRBAC raises an RBACWildcardWarning for each rule of a Role or ClusterRole
+//having a wildcard in its verbs or resources
+func (tp *TemplateProcessor) analyzeRBAC(rs *renderState, us []*unstructured.Unstructured) {
+	for _, u := range us {
+		if u.GetKind() != "Role" && u.GetKind() != "ClusterRole" {
+			continue
+		}
+		rules, _, _ := unstructured.NestedSlice(u.Object, "rules")
+		for i, r := range rules {
+			rule, ok := r.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for _, field := range []string{"verbs", "resources"} {
+				values, _, _ := unstructured.NestedStringSlice(rule, field)
+				for _, v := range values {
+					if v == "*" {
+						rs.warn(&RBACWildcardWarning{
+							Kind:      u.GetKind(),
+							Namespace: u.GetNamespace(),
+							Name:      u.GetName(),
+							Rule:      i,
+							Field:     field,
+						})
+						break
+					}
+				}
+			}
+		}
+	}
+}
+
+//PDBMissingWarning is raised when a Deployment with more than one replica is not covered by a PodDisruptionBudget
+type PDBMissingWarning struct {
+	Namespace string
+	Name      string
+	Replicas  int64
+}
+
+func (w *PDBMissingWarning) Error() string {
+	return fmt.Sprintf("Deployment %s/%s has %d replicas and no PodDisruptionBudget",
+		w.Namespace, w.Name, w.Replicas)
+}
+
+//validatePDBCoverage raises a PDBMissingWarning for each Deployment with more than one replica
+//whose pod labels are not selected by a PodDisruptionBudget of the same namespace
+func (tp *TemplateProcessor) validatePDBCoverage(rs *renderState, us []*unstructured.Unstructured) error {
+	selectors := make(map[string][]labels.Selector)
+	for _, u := range us {
+		if u.GetKind() != "PodDisruptionBudget" {
+			continue
+		}
+		m, found, _ := unstructured.NestedMap(u.Object, "spec", "selector")
+		if !found {
+			continue
+		}
+		labelSelector := &metav1.LabelSelector{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m, labelSelector); err != nil {
+			return fmt.Errorf("PodDisruptionBudget %s/%s has an invalid selector: %s", u.GetNamespace(), u.GetName(), err)
+		}
+		selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+		if err != nil {
+			return fmt.Errorf("PodDisruptionBudget %s/%s has an invalid selector: %s", u.GetNamespace(), u.GetName(), err)
+		}
+		selectors[u.GetNamespace()] = append(selectors[u.GetNamespace()], selector)
+	}
+	for _, u := range us {
+		if u.GetKind() != "Deployment" {
+			continue
+		}
+		replicas, found, _ := unstructured.NestedInt64(u.Object, "spec", "replicas")
+		if !found || replicas <= 1 {
+			continue
+		}
+		podLabels, _ := podTemplateLabels(u)
+		covered := false
+		for _, selector := range selectors[u.GetNamespace()] {
+			if !selector.Empty() && selector.Matches(labels.Set(podLabels)) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			rs.warn(&PDBMissingWarning{
+				Namespace: u.GetNamespace(),
+				Name:      u.GetName(),
+				Replicas:  replicas,
+			})
+		}
+	}
+	return nil
+}
+
+//dnsLabelMaxLength the maximum length of a DNS label
+const dnsLabelMaxLength = 63
+
+//dnsLabelKinds the kinds whose names must be DNS labels
+var dnsLabelKinds = map[string]bool{
+	"Namespace": true,
+	"Service":   true,
+}
+
+//ResourceNameTooLongError is returned when the name of a resource exceeds the maximum length
+type ResourceNameTooLongError struct {
+	GroupVersionKind schema.GroupVersionKind
+	Name             string
+	Length           int
+	MaxLength        int
+}
+
+func (e *ResourceNameTooLongError) Error() string {
+	return fmt.Sprintf("%s name %s has %d characters, the maximum is %d",
+		e.GroupVersionKind, e.Name, e.Length, e.MaxLength)
+}
+
+//validateResourceNameLength returns a ResourceNameTooLongError if the name of a resource
+//exceeds options.MaxResourceNameLength or the DNS label length for the kinds requiring it
+func (tp *TemplateProcessor) validateResourceNameLength(us []*unstructured.Unstructured) error {
+	if tp.options.MaxResourceNameLength <= 0 {
+		return nil
+	}
+	for _, u := range us {
+		maxLength := tp.options.MaxResourceNameLength
+		if dnsLabelKinds[u.GetKind()] && maxLength > dnsLabelMaxLength {
+			maxLength = dnsLabelMaxLength
+		}
+		if len(u.GetName()) > maxLength {
+			return &ResourceNameTooLongError{
+				GroupVersionKind: u.GroupVersionKind(),
+				Name:             u.GetName(),
+				Length:           len(u.GetName()),
+				MaxLength:        maxLength,
+			}
+		}
+	}
+	return nil
+}
+
+//validateAnnotationsSize returns an error if an annotation value exceeds options.MaxAnnotationValueLength
+//or if the total size of the annotations of a resource exceeds options.MaxAnnotationsSize
+func (tp *TemplateProcessor) validateAnnotationsSize(us []*unstructured.Unstructured) error {
+	if tp.options.MaxAnnotationValueLength <= 0 && tp.options.MaxAnnotationsSize <= 0 {
+		return nil
+	}
+	for _, u := range us {
+		total := 0
+		for k, v := range u.GetAnnotations() {
+			if tp.options.MaxAnnotationValueLength > 0 && len(v) > tp.options.MaxAnnotationValueLength {
+				return fmt.Errorf("%s %s/%s annotation %s value has %d characters, the maximum is %d",
+					u.GetKind(), u.GetNamespace(), u.GetName(), k, len(v), tp.options.MaxAnnotationValueLength)
+			}
+			total += len(k) + len(v)
+		}
+		if tp.options.MaxAnnotationsSize > 0 && total > tp.options.MaxAnnotationsSize {
+			return fmt.Errorf("%s %s/%s annotations total size is %d bytes, the maximum is %d",
+				u.GetKind(), u.GetNamespace(), u.GetName(), total, tp.options.MaxAnnotationsSize)
+		}
+	}
+	return nil
+}
+
+//ConfigMapSizeExceededError is returned when the data of a ConfigMap exceeds the maximum size
+type ConfigMapSizeExceededError struct {
+	Namespace string
+	Name      string
+	Size      int64
+	MaxSize   int64
+}
+
+func (e *ConfigMapSizeExceededError) Error() string {
+	return fmt.Sprintf("ConfigMap %s/%s data size is %d bytes, the maximum is %d",
+		e.Namespace, e.Name, e.Size, e.MaxSize)
+}
+
+//validateConfigMapDataSize returns a ConfigMapSizeExceededError if the total size of the data
+//and binaryData values of a ConfigMap exceeds options.MaxConfigMapDataSize
+func (tp *TemplateProcessor) validateConfigMapDataSize(us []*unstructured.Unstructured) error {
+	if tp.options.MaxConfigMapDataSize <= 0 {
+		return nil
+	}
+	for _, u := range us {
+		if u.GetKind() != "ConfigMap" {
+			continue
+		}
+		var size int64
+		data, _, _ := unstructured.NestedStringMap(u.Object, "data")
+		for _, v := range data {
+			size += int64(len(v))
+		}
+		binaryData, _, _ := unstructured.NestedStringMap(u.Object, "binaryData")
+		for _, v := range binaryData {
+			size += int64(base64.StdEncoding.DecodedLen(len(v)))
+		}
+		if size > tp.options.MaxConfigMapDataSize {
+			return &ConfigMapSizeExceededError{
+				Namespace: u.GetNamespace(),
+				Name:      u.GetName(),
+				Size:      size,
+				MaxSize:   tp.options.MaxConfigMapDataSize,
+			}
+		}
+	}
+	return nil
+}
+
+//validateResourcesPerNamespace returns an error if the number of resources in a namespace
+//exceeds options.MaxResourcesPerNamespace
+func (tp *TemplateProcessor) validateResourcesPerNamespace(us []*unstructured.Unstructured) error {
+	if tp.options.MaxResourcesPerNamespace <= 0 {
+		return nil
+	}
+	namespaces := make([]string, 0)
+	resources := make(map[string][]string)
+	for _, u := range us {
+		if u.GetNamespace() == "" {
+			continue
+		}
+		if _, ok := resources[u.GetNamespace()]; !ok {
+			namespaces = append(namespaces, u.GetNamespace())
+		}
+		resources[u.GetNamespace()] = append(resources[u.GetNamespace()], unstructuredKey(u))
+	}
+	for _, ns := range namespaces {
+		if len(resources[ns]) > tp.options.MaxResourcesPerNamespace {
+			return fmt.Errorf("Namespace %s has %d resources, the maximum is %d: %v",
+				ns, len(resources[ns]), tp.options.MaxResourcesPerNamespace, resources[ns])
+		}
+	}
+	return nil
+}
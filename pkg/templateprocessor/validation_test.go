@@ -0,0 +1,1045 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var assetCronJob = `
+apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: mycronjob
+  namespace: myns
+spec:
+  schedule: "{{ .Schedule }}"
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: hello
+            image: busybox`
+
+func TestTemplateProcessor_ValidateOutput(t *testing.T) {
+	assets := map[string]string{
+		"test/valid": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Name }}`,
+		"test/empty": `{{ if .Missing }}
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: empty
+{{ end }}`,
+		"test/brokenyaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Name }}
+    labels: [`,
+		"test/notkube": `
+name: {{ .Name }}`,
+	}
+	tests := []struct {
+		name           string
+		templateName   string
+		validateOutput bool
+		wantErr        bool
+	}{
+		{name: "valid", templateName: "test/valid", validateOutput: true},
+		{name: "empty", templateName: "test/empty", validateOutput: true},
+		{name: "broken yaml", templateName: "test/brokenyaml", validateOutput: true, wantErr: true},
+		{name: "broken yaml not validated", templateName: "test/brokenyaml"},
+		{name: "not a kube resource", templateName: "test/notkube", validateOutput: true, wantErr: true},
+		{name: "not a kube resource not validated", templateName: "test/notkube"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(assets), WithOptions(&Options{ValidateOutput: tt.validateOutput}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = tp.TemplateResource(context.TODO(), tt.templateName, map[string]string{"Name": "myname"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TemplateResource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				return
+			}
+			verr, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("Expecting a ValidationError got %T", err)
+			}
+			if verr.Err == nil || !strings.Contains(string(verr.Rendered), "name: myname") {
+				t.Errorf("Expecting the cause and the rendered output got %v", verr)
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_validateCronSchedules(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule string
+		options  *Options
+		wantErr  bool
+	}{
+		{
+			name:     "valid",
+			schedule: "*/5 * * * *",
+			options:  &Options{ValidateCronSchedules: true},
+			wantErr:  false,
+		},
+		{
+			name:     "valid descriptor",
+			schedule: "@hourly",
+			options:  &Options{ValidateCronSchedules: true},
+			wantErr:  false,
+		},
+		{
+			name:     "invalid",
+			schedule: "*/5 * * *",
+			options:  &Options{ValidateCronSchedules: true},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid not validated",
+			schedule: "*/5 * * *",
+			options:  &Options{},
+			wantErr:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{"test/cronjob": assetCronJob}), WithOptions(tt.options))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, map[string]string{"Schedule": tt.schedule})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TemplateResourcesInPathUnstructured() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_validateCronJobNextRun(t *testing.T) {
+	tests := []struct {
+		name         string
+		schedule     string
+		options      *Options
+		wantWarning  bool
+		wantNeverRun bool
+	}{
+		{
+			name:     "frequent",
+			schedule: "*/5 * * * *",
+			options:  &Options{ValidateCronJobNextRun: true},
+		},
+		{
+			name:         "never runs",
+			schedule:     "0 0 30 2 *",
+			options:      &Options{ValidateCronJobNextRun: true},
+			wantWarning:  true,
+			wantNeverRun: true,
+		},
+		{
+			name:        "further than the max interval",
+			schedule:    "0 0 1 1 *",
+			options:     &Options{ValidateCronJobNextRun: true, CronJobMaxNextRunInterval: time.Hour},
+			wantWarning: true,
+		},
+		{
+			name:     "not validated",
+			schedule: "0 0 30 2 *",
+			options:  &Options{},
+		},
+		{
+			name:     "invalid schedule",
+			schedule: "*/5 * * *",
+			options:  &Options{ValidateCronJobNextRun: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{"test/cronjob": assetCronJob}), WithOptions(tt.options))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, map[string]string{"Schedule": tt.schedule}); err != nil {
+				t.Fatal(err)
+			}
+			if !tt.wantWarning {
+				if len(tp.Warnings()) != 0 {
+					t.Errorf("Expecting no warning got %v", tp.Warnings())
+				}
+				return
+			}
+			if len(tp.Warnings()) != 1 {
+				t.Fatalf("Expecting 1 warning got %v", tp.Warnings())
+			}
+			w, ok := tp.Warnings()[0].(*CronJobScheduleWarning)
+			if !ok {
+				t.Fatalf("Expecting a CronJobScheduleWarning got %T", tp.Warnings()[0])
+			}
+			if w.Name != "mycronjob" || w.Schedule != tt.schedule || w.NextRun.IsZero() != tt.wantNeverRun {
+				t.Errorf("Unexpected warning %v", w)
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_validateImageFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		image   string
+		wantErr bool
+	}{
+		{
+			name:    "short name",
+			image:   "nginx",
+			wantErr: true,
+		},
+		{
+			name:    "short name and tag",
+			image:   "nginx:1.19",
+			wantErr: true,
+		},
+		{
+			name:    "no registry",
+			image:   "myorg/myimage:latest",
+			wantErr: true,
+		},
+		{
+			name:  "docker hub",
+			image: "docker.io/nginx:1.19",
+		},
+		{
+			name:  "registry with port",
+			image: "localhost:5000/myimage",
+		},
+		{
+			name:  "registry and tag",
+			image: "quay.io/open-cluster-management/registration:2.1.0",
+		},
+		{
+			name:  "digest",
+			image: "quay.io/myorg/myimage@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		},
+		{
+			name:    "invalid digest",
+			image:   "quay.io/myorg/myimage@sha256:1234",
+			wantErr: true,
+		},
+		{
+			name:    "uppercase",
+			image:   "quay.io/MyOrg/myimage:latest",
+			wantErr: true,
+		},
+		{
+			name:    "empty tag",
+			image:   "quay.io/myorg/myimage:",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+				"test/deployment": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: mydeployment
+  namespace: myns
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: docker.io/library/busybox
+      containers:
+      - name: app
+        image: "{{ .Image }}"`,
+			}), WithOptions(&Options{ValidateImageFormat: true}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, map[string]string{"Image": tt.image})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TemplateResourcesInPathUnstructured() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, ok := err.(*MalformedImageError); err != nil && !ok {
+				t.Errorf("Expecting a MalformedImageError got %T", err)
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_validatePrometheusRules(t *testing.T) {
+	tests := []struct {
+		name            string
+		expr            string
+		wantErr         bool
+		wantMissingExpr bool
+	}{
+		{
+			name: "valid",
+			expr: `rate(http_requests_total{job="api"}[5m]) > 10`,
+		},
+		{
+			name:    "invalid",
+			expr:    `rate(http_requests_total{job="api"}[5m] > 10`,
+			wantErr: true,
+		},
+		{
+			name:            "missing",
+			wantErr:         true,
+			wantMissingExpr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+				"test/rule": `
+apiVersion: monitoring.coreos.com/v1
+kind: PrometheusRule
+metadata:
+  name: myrule
+  namespace: myns
+spec:
+  groups:
+  - name: mygroup
+    rules:
+    - record: job:up:sum
+      expr: sum by (job) (up)
+    - alert: HighRequestRate
+{{- if .Expr }}
+      expr: {{ .Expr | squote }}
+{{- end }}
+      for: 10m`,
+			}), WithOptions(&Options{ValidatePrometheusRules: true}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, map[string]string{"Expr": tt.expr})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TemplateResourcesInPathUnstructured() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantMissingExpr {
+				e, ok := err.(*PrometheusRuleMissingExprError)
+				if !ok {
+					t.Fatalf("Expecting a PrometheusRuleMissingExprError got %T", err)
+				}
+				if e.Group != "mygroup" || e.Index != 1 {
+					t.Errorf("Unexpected group %s or index %d", e.Group, e.Index)
+				}
+				return
+			}
+			if err != nil {
+				e, ok := err.(*PrometheusRuleSyntaxError)
+				if !ok {
+					t.Fatalf("Expecting a PrometheusRuleSyntaxError got %T", err)
+				}
+				if e.Group != "mygroup" || e.Rule != "HighRequestRate" {
+					t.Errorf("Unexpected group %s or rule %s", e.Group, e.Rule)
+				}
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_validateHPATargets(t *testing.T) {
+	tests := []struct {
+		name       string
+		targetName string
+		wantErr    bool
+	}{
+		{
+			name:       "target found",
+			targetName: "mydeployment",
+		},
+		{
+			name:       "target missing",
+			targetName: "otherdeployment",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+				"test/deployment": assetDeployment,
+				"test/hpa": `
+apiVersion: autoscaling/v1
+kind: HorizontalPodAutoscaler
+metadata:
+  name: myhpa
+  namespace: myns
+spec:
+  scaleTargetRef:
+    apiVersion: apps/v1
+    kind: Deployment
+    name: {{ .TargetName }}
+  minReplicas: 1
+  maxReplicas: 10`,
+			}), WithOptions(&Options{ValidateHPATargets: true}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, map[string]string{"TargetName": tt.targetName})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TemplateResourcesInPathUnstructured() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, ok := err.(*HPATargetMissingError); err != nil && !ok {
+				t.Errorf("Expecting an HPATargetMissingError got %T", err)
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_validatePriorityClasses(t *testing.T) {
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		newUnstructured("scheduling.k8s.io/v1", "PriorityClass", "", "clusterpriority"))
+	tests := []struct {
+		name              string
+		priorityClassName string
+		withClient        bool
+		wantErr           bool
+	}{
+		{name: "not set", priorityClassName: ""},
+		{name: "built-in", priorityClassName: "system-cluster-critical"},
+		{name: "rendered", priorityClassName: "renderedpriority"},
+		{name: "in the cluster", priorityClassName: "clusterpriority", withClient: true},
+		{name: "missing in the cluster", priorityClassName: "otherpriority", withClient: true, wantErr: true},
+		{name: "missing without client", priorityClassName: "clusterpriority", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := &Options{ValidatePriorityClasses: true}
+			if tt.withClient {
+				options.DynamicClient = dynamicClient
+			}
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+				"test/priorityclass": `
+apiVersion: scheduling.k8s.io/v1
+kind: PriorityClass
+metadata:
+  name: renderedpriority
+value: 1000`,
+				"test/deployment": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: mydeployment
+  namespace: myns
+spec:
+  template:
+    spec:
+      priorityClassName: "{{ .PriorityClassName }}"
+      containers:
+      - name: app
+        image: myimage`,
+			}), WithOptions(options))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, map[string]string{"PriorityClassName": tt.priorityClassName})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TemplateResourcesInPathUnstructured() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				return
+			}
+			e, ok := err.(*PriorityClassMissingError)
+			if !ok {
+				t.Fatalf("Expecting a PriorityClassMissingError got %T", err)
+			}
+			if e.Kind != "Deployment" || e.Name != "mydeployment" || e.PriorityClassName != tt.priorityClassName {
+				t.Errorf("Unexpected error %v", e)
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_validateIngressTLS(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "clustersecret", Namespace: "myns"},
+	})
+	tests := []struct {
+		name       string
+		secretName string
+		kubeClient *fake.Clientset
+		wantErr    bool
+	}{
+		{
+			name:       "secret rendered",
+			secretName: "renderedsecret",
+		},
+		{
+			name:       "secret in the cluster",
+			secretName: "clustersecret",
+			kubeClient: kubeClient,
+		},
+		{
+			name:       "secret missing in the cluster",
+			secretName: "othersecret",
+			kubeClient: kubeClient,
+			wantErr:    true,
+		},
+		{
+			name:       "secret missing without client",
+			secretName: "clustersecret",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := &Options{ValidateIngressTLS: true}
+			if tt.kubeClient != nil {
+				options.KubeClient = tt.kubeClient
+			}
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+				"test/secret": `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: renderedsecret
+  namespace: myns
+type: kubernetes.io/tls`,
+				"test/ingress": `
+apiVersion: networking.k8s.io/v1beta1
+kind: Ingress
+metadata:
+  name: myingress
+  namespace: myns
+spec:
+  tls:
+  - hosts:
+    - myapp.example.com
+    secretName: {{ .SecretName }}`,
+			}), WithOptions(options))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, map[string]string{"SecretName": tt.secretName})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TemplateResourcesInPathUnstructured() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				return
+			}
+			e, ok := err.(*IngressTLSSecretMissingError)
+			if !ok {
+				t.Fatalf("Expecting an IngressTLSSecretMissingError got %T", err)
+			}
+			if e.Host != "myapp.example.com" || e.SecretName != tt.secretName {
+				t.Errorf("Unexpected error %v", e)
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_analyzeRBAC(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/clusterrole": `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: admin
+rules:
+- apiGroups: [""]
+  resources: ["pods"]
+  verbs: ["get"]
+- apiGroups: ["*"]
+  resources: ["*"]
+  verbs: ["*"]`,
+		"test/role": `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: editor
+  namespace: myns
+rules:
+- apiGroups: [""]
+  resources: ["configmaps"]
+  verbs: ["*"]`,
+	}), WithOptions(&Options{AnalyzeRBAC: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := []RBACWildcardWarning{
+		{Kind: "ClusterRole", Name: "admin", Rule: 1, Field: "verbs"},
+		{Kind: "ClusterRole", Name: "admin", Rule: 1, Field: "resources"},
+		{Kind: "Role", Namespace: "myns", Name: "editor", Rule: 0, Field: "verbs"},
+	}
+	warnings := tp.Warnings()
+	if len(warnings) != len(want) {
+		t.Fatalf("Expecting %d warnings got %v", len(want), warnings)
+	}
+	got := make(map[RBACWildcardWarning]bool)
+	for _, w := range warnings {
+		rw, ok := w.(*RBACWildcardWarning)
+		if !ok {
+			t.Fatalf("Expecting an RBACWildcardWarning got %T", w)
+		}
+		got[*rw] = true
+	}
+	for _, w := range want {
+		if !got[w] {
+			t.Errorf("Expecting warning %v got %v", w, warnings)
+		}
+	}
+}
+
+func TestTemplateProcessor_validateServiceSelectors(t *testing.T) {
+	tests := []struct {
+		name         string
+		app          string
+		wantWarnings int
+	}{
+		{
+			name: "selector matching",
+			app:  "myapp",
+		},
+		{
+			name:         "selector not matching",
+			app:          "otherapp",
+			wantWarnings: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+				"test/deployment": assetDeployment,
+				"test/service": `
+apiVersion: v1
+kind: Service
+metadata:
+  name: myservice
+  namespace: myns
+spec:
+  selector:
+    app: {{ .App }}
+  ports:
+  - port: 80`,
+			}), WithOptions(&Options{ValidateServiceSelectors: true}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, map[string]string{"App": tt.app})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tp.Warnings()) != tt.wantWarnings {
+				t.Errorf("Expecting %d warnings got %v", tt.wantWarnings, tp.Warnings())
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_validateResourceNameLength(t *testing.T) {
+	tests := []struct {
+		name    string
+		kind    string
+		length  int
+		options *Options
+		wantErr bool
+	}{
+		{
+			name:    "disabled by default",
+			kind:    "Service",
+			length:  300,
+			options: &Options{},
+		},
+		{
+			name:    "configmap within DNS subdomain",
+			kind:    "ConfigMap",
+			length:  253,
+			options: &Options{MaxResourceNameLength: 253},
+		},
+		{
+			name:    "configmap too long",
+			kind:    "ConfigMap",
+			length:  254,
+			options: &Options{MaxResourceNameLength: 253},
+			wantErr: true,
+		},
+		{
+			name:    "service within DNS label",
+			kind:    "Service",
+			length:  63,
+			options: &Options{MaxResourceNameLength: 253},
+		},
+		{
+			name:    "service too long",
+			kind:    "Service",
+			length:  64,
+			options: &Options{MaxResourceNameLength: 253},
+			wantErr: true,
+		},
+		{
+			name:    "configmap over custom limit",
+			kind:    "ConfigMap",
+			length:  41,
+			options: &Options{MaxResourceNameLength: 40},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+				"test/resource": `
+apiVersion: v1
+kind: {{ .Kind }}
+metadata:
+  name: {{ .Name }}
+  namespace: myns`,
+			}), WithOptions(tt.options))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, map[string]string{
+				"Kind": tt.kind,
+				"Name": strings.Repeat("a", tt.length),
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TemplateResourcesInPathUnstructured() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if e, ok := err.(*ResourceNameTooLongError); err != nil && (!ok || e.Length != tt.length) {
+				t.Errorf("Expecting a ResourceNameTooLongError with length %d got %v", tt.length, err)
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_validateAnnotationsSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *Options
+		wantErr bool
+	}{
+		{
+			name:    "disabled",
+			options: &Options{},
+		},
+		{
+			name:    "within limits",
+			options: &Options{MaxAnnotationValueLength: 10, MaxAnnotationsSize: 22},
+		},
+		{
+			name:    "value too long",
+			options: &Options{MaxAnnotationValueLength: 9},
+			wantErr: true,
+		},
+		{
+			name:    "total too large",
+			options: &Options{MaxAnnotationsSize: 21},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+				"test/cm": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: mycm
+  namespace: myns
+  annotations:
+    a: "0123456789"
+    b: "0123456789"`,
+			}), WithOptions(tt.options))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TemplateResourcesInPathUnstructured() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_validateResourcesPerNamespace(t *testing.T) {
+	tests := []struct {
+		name    string
+		max     int
+		wantErr bool
+	}{
+		{
+			name: "disabled",
+			max:  0,
+		},
+		{
+			name: "within the limit",
+			max:  2,
+		},
+		{
+			name:    "over the limit",
+			max:     1,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+				"test/deployment": assetDeployment,
+				"test/sa": `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: mysa
+  namespace: myns`,
+				"test/clusterrole": `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: myclusterrole`,
+			}), WithOptions(&Options{MaxResourcesPerNamespace: tt.max}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TemplateResourcesInPathUnstructured() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_validateCrossReferences(t *testing.T) {
+	assets := map[string]string{
+		"test/sa": `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: mysa
+  namespace: myns
+imagePullSecrets:
+- name: pullsecret`,
+		"test/rolebinding": `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: myrolebinding
+  namespace: myns
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: myrole
+subjects:
+- kind: ServiceAccount
+  name: mysa
+- kind: ServiceAccount
+  name: {{ .SubjectName }}
+  namespace: myns
+- kind: User
+  name: myuser`,
+		"test/pod": `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: mypod
+  namespace: myns
+spec:
+  volumes:
+  - name: config
+    configMap:
+      name: mycm
+  - name: optional
+    secret:
+      secretName: optionalsecret
+      optional: true
+  containers:
+  - name: app
+    image: app`,
+		"test/configmap": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: mycm
+  namespace: myns`,
+		"test/secret": `
+{{- if .PullSecret }}
+apiVersion: v1
+kind: Secret
+metadata:
+  name: pullsecret
+  namespace: myns
+{{- end }}`,
+	}
+	tests := []struct {
+		name           string
+		values         map[string]interface{}
+		wantReferences []string
+	}{
+		{
+			name:   "all satisfied",
+			values: map[string]interface{}{"SubjectName": "mysa", "PullSecret": true},
+		},
+		{
+			name:   "unsatisfied",
+			values: map[string]interface{}{"SubjectName": "othersa", "PullSecret": false},
+			wantReferences: []string{
+				"ServiceAccount/myns/mysa -> Secret/myns/pullsecret",
+				"RoleBinding/myns/myrolebinding -> ServiceAccount/myns/othersa",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(assets), WithOptions(&Options{ValidateCrossReferences: true}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, tt.values)
+			if len(tt.wantReferences) == 0 {
+				if err != nil {
+					t.Errorf("Unexpected error %v", err)
+				}
+				return
+			}
+			e, ok := err.(*CrossReferenceError)
+			if !ok {
+				t.Fatalf("Expecting a CrossReferenceError got %v", err)
+			}
+			got := make(map[string]bool)
+			for _, r := range e.References {
+				got[r] = true
+			}
+			if len(got) != len(tt.wantReferences) {
+				t.Errorf("Expecting references %v got %v", tt.wantReferences, e.References)
+			}
+			for _, r := range tt.wantReferences {
+				if !got[r] {
+					t.Errorf("Expecting reference %s got %v", r, e.References)
+				}
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_validateConfigMapDataSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *Options
+		size    int
+		wantErr bool
+	}{
+		{
+			name:    "disabled by default",
+			options: &Options{},
+			size:    1024 * 1024,
+		},
+		{
+			name:    "exceeds 1MiB",
+			options: &Options{MaxConfigMapDataSize: 1024 * 1024},
+			size:    1024 * 1024,
+			wantErr: true,
+		},
+		{
+			name:    "within the limit",
+			options: &Options{MaxConfigMapDataSize: 13},
+			size:    10,
+		},
+		{
+			name:    "exceeds the limit",
+			options: &Options{MaxConfigMapDataSize: 12},
+			size:    10,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+				"test/cm": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: mycm
+  namespace: myns
+data:
+  key: {{ repeat .Size "a" }}
+binaryData:
+  bin: AAAA`,
+			}), WithOptions(tt.options))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, map[string]int{"Size": tt.size})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TemplateResourcesInPathUnstructured() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, ok := err.(*ConfigMapSizeExceededError); err != nil && !ok {
+				t.Errorf("Expecting a ConfigMapSizeExceededError got %T", err)
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_validatePDBCoverage(t *testing.T) {
+	tests := []struct {
+		name         string
+		pdbSelector  string
+		wantWarnings int
+	}{
+		{
+			name:        "covered",
+			pdbSelector: "myapp",
+		},
+		{
+			name:         "not covered",
+			pdbSelector:  "otherapp",
+			wantWarnings: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+				"test/deployment": assetDeployment,
+				"test/pdb": `
+apiVersion: policy/v1beta1
+kind: PodDisruptionBudget
+metadata:
+  name: mypdb
+  namespace: myns
+spec:
+  minAvailable: 1
+  selector:
+    matchLabels:
+      app: {{ .App }}`,
+			}), WithOptions(&Options{ValidatePDBCoverage: true}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, map[string]string{"App": tt.pdbSelector})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tp.Warnings()) != tt.wantWarnings {
+				t.Errorf("Expecting %d warnings got %v", tt.wantWarnings, tp.Warnings())
+			}
+			for _, w := range tp.Warnings() {
+				if _, ok := w.(*PDBMissingWarning); !ok {
+					t.Errorf("Expecting a PDBMissingWarning got %T", w)
+				}
+			}
+		})
+	}
+}
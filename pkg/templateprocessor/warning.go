@@ -0,0 +1,18 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+//Warnings returns a copy of the warnings raised by the last rendering.
+//A warning reports an issue in the rendered resources which doesn't fail the rendering.
+func (tp *TemplateProcessor) Warnings() []error {
+	tp.mutex.Lock()
+	defer tp.mutex.Unlock()
+	return append([]error(nil), tp.warnings...)
+}
+
+//setWarnings records the warnings of the last rendering
+func (tp *TemplateProcessor) setWarnings(warnings []error) {
+	tp.mutex.Lock()
+	defer tp.mutex.Unlock()
+	tp.warnings = warnings
+}
@@ -0,0 +1,43 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestTemplateProcessor_Warnings_concurrentRenderings(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"test/configmap": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: My_ConfigMap
+  namespace: myns`,
+	}), WithOptions(&Options{NormalizeResourceNames: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := tp.TemplateResourcesInPathUnstructured(context.TODO(), "test", nil, false, nil); err != nil {
+				t.Error(err)
+			}
+			tp.Warnings()
+		}()
+	}
+	wg.Wait()
+	warnings := tp.Warnings()
+	if len(warnings) != 1 {
+		t.Fatalf("Expecting the warning of the last rendering only got %v", warnings)
+	}
+	warnings[0] = nil
+	if tp.Warnings()[0] == nil {
+		t.Error("Expecting Warnings to return a copy")
+	}
+}
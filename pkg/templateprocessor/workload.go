@@ -0,0 +1,88 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+//podSpecFields returns the path to the pod spec of a workload resource, nil if the resource has no pod spec
+func podSpecFields(u *unstructured.Unstructured) []string {
+	switch u.GetKind() {
+	case "Pod":
+		return []string{"spec"}
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "ReplicationController", "Job":
+		return []string{"spec", "template", "spec"}
+	case "CronJob":
+		return []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	}
+	return nil
+}
+
+//podTemplateLabels returns the labels of the pods of a workload resource
+func podTemplateLabels(u *unstructured.Unstructured) (map[string]string, bool) {
+	fields := podSpecFields(u)
+	if fields == nil {
+		return nil, false
+	}
+	fields = append(fields[:len(fields)-1], "metadata", "labels")
+	labels, _, _ := unstructured.NestedStringMap(u.Object, fields...)
+	return labels, true
+}
+
+//nestedMapNoCopy returns the map at the fields path without copying it, so it can be modified in place
+func nestedMapNoCopy(obj map[string]interface{}, fields ...string) (map[string]interface{}, bool) {
+	m := obj
+	for _, f := range fields {
+		next, ok := m[f].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		m = next
+	}
+	return m, true
+}
+
+//podSpec returns the pod spec of a workload resource, the returned map can be modified in place
+func podSpec(u *unstructured.Unstructured) (map[string]interface{}, bool) {
+	fields := podSpecFields(u)
+	if fields == nil {
+		return nil, false
+	}
+	return nestedMapNoCopy(u.Object, fields...)
+}
+
+//podContainers returns the init containers and the containers of a pod spec,
+//the returned maps can be modified in place
+func podContainers(spec map[string]interface{}) []map[string]interface{} {
+	return containersIn(spec, "initContainers", "containers")
+}
+
+//podAppContainers returns the containers of a pod spec without the init containers,
+//the returned maps can be modified in place
+func podAppContainers(spec map[string]interface{}) []map[string]interface{} {
+	return containersIn(spec, "containers")
+}
+
+func containersIn(spec map[string]interface{}, fields ...string) []map[string]interface{} {
+	containers := make([]map[string]interface{}, 0)
+	for _, field := range fields {
+		containers = append(containers, mapsIn(spec[field])...)
+	}
+	return containers
+}
+
+//mapsIn returns the maps of a list, the returned maps can be modified in place
+func mapsIn(list interface{}) []map[string]interface{} {
+	maps := make([]map[string]interface{}, 0)
+	l, ok := list.([]interface{})
+	if !ok {
+		return maps
+	}
+	for _, e := range l {
+		if m, ok := e.(map[string]interface{}); ok {
+			maps = append(maps, m)
+		}
+	}
+	return maps
+}